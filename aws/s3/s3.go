@@ -2,7 +2,7 @@ package s3
 
 import (
 	"bytes"
-	"flag"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -21,6 +21,7 @@ import (
 type Manager struct {
 	bucketName string
 	region     string
+	ctx        context.Context
 }
 
 // NewManager initiates a new s3 manager
@@ -31,36 +32,37 @@ func NewManager(bucket string, region string) *Manager {
 	}
 }
 
+// WithContext returns a copy of the manager whose s3 calls are cancelled with ctx
+func (m *Manager) WithContext(ctx context.Context) *Manager {
+	cp := *m
+	cp.ctx = ctx
+	return &cp
+}
+
+// context returns the manager's context, context.Background() if not set
+func (m *Manager) context() context.Context {
+	if m.ctx == nil {
+		return context.Background()
+	}
+	return m.ctx
+}
+
 // Save data as a object in s3
 func (m *Manager) Save(payload []byte) error {
 
-	var bucket, key string
-	var timeout time.Duration
-
 	// generating hash and create object name
 	md := ripemd160.New()
 	keyName, err := io.WriteString(md, string(payload[:]))
 
 	objName := fmt.Sprintf("%v-%x", time.Now().Unix(), keyName)
-	b := flag.Lookup("b")
-	k := flag.Lookup("k")
-	d := flag.Lookup("d")
-
-	if b == nil && k == nil && d == nil {
-		flag.StringVar(&bucket, "b", m.bucketName, "Bucket name.")
-		flag.StringVar(&key, "k", objName, "Object key name.")
-		flag.DurationVar(&timeout, "d", 0, "Upload timeout.")
-		flag.Parse()
-	}
-
 	sess := session.Must(session.NewSession(&aws.Config{Region: aws.String(m.region)}))
 	svc := s3.New(sess)
 
 	r := bytes.NewReader(payload)
 
-	// Uploads the object to S3. The Context will interrupt the request if the
-	// timeout expires.
-	_, err = svc.PutObject(&s3.PutObjectInput{
+	// Uploads the object to S3. The manager's context (see WithContext) will
+	// interrupt the request when it is cancelled or its deadline expires.
+	_, err = svc.PutObjectWithContext(m.context(), &s3.PutObjectInput{
 		Bucket: aws.String(m.bucketName),
 		Key:    aws.String(objName),
 		Body:   r,
@@ -76,7 +78,7 @@ func (m *Manager) GetKeys() ([]string, error) {
 	svc := s3.New(sess)
 
 	var objects []string
-	err := svc.ListObjectsPages(&s3.ListObjectsInput{
+	err := svc.ListObjectsPagesWithContext(m.context(), &s3.ListObjectsInput{
 		Bucket: aws.String(m.bucketName),
 	}, func(p *s3.ListObjectsOutput, lastPage bool) bool {
 		for _, o := range p.Contents {
@@ -97,7 +99,7 @@ func (m *Manager) Get(key string) ([]byte, error) {
 	sess := session.Must(session.NewSession(&aws.Config{Region: aws.String(m.region)}))
 
 	svc := s3.New(sess)
-	obj, err := svc.GetObject(&s3.GetObjectInput{
+	obj, err := svc.GetObjectWithContext(m.context(), &s3.GetObjectInput{
 		Bucket: aws.String(m.bucketName),
 		Key:    aws.String(key),
 	})
@@ -115,7 +117,7 @@ func (m *Manager) Delete(key string) error {
 	sess := session.Must(session.NewSession(&aws.Config{Region: aws.String(m.region)}))
 
 	svc := s3.New(sess)
-	_, err := svc.DeleteObject(&s3.DeleteObjectInput{
+	_, err := svc.DeleteObjectWithContext(m.context(), &s3.DeleteObjectInput{
 		Bucket: aws.String(m.bucketName),
 		Key:    aws.String(key),
 	})
@@ -128,28 +130,14 @@ func (m *Manager) Delete(key string) error {
 
 // SaveWithKey save data with specific key/path as an object in s3
 func (m *Manager) SaveWithKey(payload []byte, objectKey string) error {
-	var bucket, key string
-	var timeout time.Duration
-
-	b := flag.Lookup("b")
-	k := flag.Lookup("k")
-	d := flag.Lookup("d")
-
-	if b == nil && k == nil && d == nil {
-		flag.StringVar(&bucket, "b", m.bucketName, "Bucket name.")
-		flag.StringVar(&key, "k", objectKey, "Object key name.")
-		flag.DurationVar(&timeout, "d", 0, "Upload timeout.")
-		flag.Parse()
-	}
-
 	sess := session.Must(session.NewSession(&aws.Config{Region: aws.String(m.region)}))
 	svc := s3.New(sess)
 
 	r := bytes.NewReader(payload)
 
-	// Uploads the object to S3. The Context will interrupt the request if the
-	// timeout expires.
-	_, err := svc.PutObject(&s3.PutObjectInput{
+	// Uploads the object to S3. The manager's context (see WithContext) will
+	// interrupt the request when it is cancelled or its deadline expires.
+	_, err := svc.PutObjectWithContext(m.context(), &s3.PutObjectInput{
 		Bucket: aws.String(m.bucketName),
 		Key:    aws.String(objectKey),
 		Body:   r,
@@ -163,7 +151,7 @@ func (m *Manager) GetFilesFromSubFolder(folder string) ([]string, error) {
 	svc := s3.New(sess)
 
 	var objects []string
-	err := svc.ListObjectsPages(&s3.ListObjectsInput{
+	err := svc.ListObjectsPagesWithContext(m.context(), &s3.ListObjectsInput{
 		Bucket: aws.String(m.bucketName),
 		Prefix: aws.String(folder),
 	}, func(p *s3.ListObjectsOutput, lastPage bool) bool {
@@ -204,7 +192,7 @@ func (m *Manager) UploadMultipart(fileName string, path string) error {
 		ContentType: aws.String(fileType),
 	}
 
-	resp, err := svc.CreateMultipartUpload(input)
+	resp, err := svc.CreateMultipartUploadWithContext(m.context(), input)
 	if err != nil {
 		return err
 	}
@@ -219,7 +207,7 @@ func (m *Manager) UploadMultipart(fileName string, path string) error {
 		} else {
 			partLength = maxPartSize
 		}
-		completedPart, err := uploadPart(svc, resp, file, partNumber, maxRetries)
+		completedPart, err := uploadPart(m.context(), svc, resp, file, partNumber, maxRetries)
 		if err != nil {
 			fmt.Println(err.Error())
 			err := abortMultipartUpload(svc, resp)
@@ -233,7 +221,7 @@ func (m *Manager) UploadMultipart(fileName string, path string) error {
 		completedParts = append(completedParts, completedPart)
 	}
 
-	_, err = completeMultipartUpload(svc, resp, completedParts)
+	_, err = completeMultipartUpload(m.context(), svc, resp, completedParts)
 	if err != nil {
 		return err
 	}
@@ -242,7 +230,7 @@ func (m *Manager) UploadMultipart(fileName string, path string) error {
 	return nil
 }
 
-func completeMultipartUpload(svc *s3.S3, resp *s3.CreateMultipartUploadOutput, completedParts []*s3.CompletedPart) (*s3.CompleteMultipartUploadOutput, error) {
+func completeMultipartUpload(ctx context.Context, svc *s3.S3, resp *s3.CreateMultipartUploadOutput, completedParts []*s3.CompletedPart) (*s3.CompleteMultipartUploadOutput, error) {
 	completeInput := &s3.CompleteMultipartUploadInput{
 		Bucket:   resp.Bucket,
 		Key:      resp.Key,
@@ -251,10 +239,10 @@ func completeMultipartUpload(svc *s3.S3, resp *s3.CreateMultipartUploadOutput, c
 			Parts: completedParts,
 		},
 	}
-	return svc.CompleteMultipartUpload(completeInput)
+	return svc.CompleteMultipartUploadWithContext(ctx, completeInput)
 }
 
-func uploadPart(svc *s3.S3, resp *s3.CreateMultipartUploadOutput, file *os.File, partNumber int, maxRetries int) (*s3.CompletedPart, error) {
+func uploadPart(ctx context.Context, svc *s3.S3, resp *s3.CreateMultipartUploadOutput, file *os.File, partNumber int, maxRetries int) (*s3.CompletedPart, error) {
 	tryNum := 1
 	partInput := &s3.UploadPartInput{
 		Body:       file,
@@ -265,9 +253,9 @@ func uploadPart(svc *s3.S3, resp *s3.CreateMultipartUploadOutput, file *os.File,
 	}
 
 	for tryNum <= maxRetries {
-		uploadResult, err := svc.UploadPart(partInput)
+		uploadResult, err := svc.UploadPartWithContext(ctx, partInput)
 		if err != nil {
-			if tryNum == maxRetries {
+			if tryNum == maxRetries || ctx.Err() != nil {
 				if aerr, ok := err.(awserr.Error); ok {
 					return nil, aerr
 				}
@@ -293,6 +281,7 @@ func abortMultipartUpload(svc *s3.S3, resp *s3.CreateMultipartUploadOutput) erro
 		Key:      resp.Key,
 		UploadId: resp.UploadId,
 	}
+	// not using manager's context: upload must be aborted even when it was cancelled
 	_, err := svc.AbortMultipartUpload(abortInput)
 	return err
 }
@@ -0,0 +1,380 @@
+package ds
+
+import (
+	"container/list"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	s3util "github.com/LF-Engineering/insights-datasource-shared/aws/s3"
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	// CacheBackendL2 - default HTTP cache backend: process memory backed by ES dads_cache index
+	CacheBackendL2 = "l2"
+	// CacheBackendMem - in-memory LRU HTTP cache backend (not persistent)
+	CacheBackendMem = "mem"
+	// CacheBackendDisk - local directory HTTP cache backend
+	CacheBackendDisk = "disk"
+	// CacheBackendES - ES dads_cache index HTTP cache backend
+	CacheBackendES = "es"
+	// CacheBackendS3 - S3 bucket HTTP cache backend
+	CacheBackendS3 = "s3"
+	// DefaultCacheDir - default directory used by disk cache backend
+	DefaultCacheDir = ".dads_cache"
+	// DefaultCacheRegion - default AWS region used by S3 cache backend
+	DefaultCacheRegion = "us-east-2"
+	// DefaultMemCacheMaxEntries - default max number of entries kept by in-memory LRU cache
+	DefaultMemCacheMaxEntries = 0x4000
+	// DefaultCacheRevalidateFor - how long stale cache entries having ETag/Last-Modified are kept for revalidation
+	DefaultCacheRevalidateFor = 7 * 24 * time.Hour
+	// CacheFreshSuffix - cache key suffix of the marker telling that entry with validators is still fresh
+	CacheFreshSuffix = "-fresh"
+)
+
+var (
+	requestCacheMtx = &sync.Mutex{}
+)
+
+// RequestCache - cache backend used by Request to store HTTP responses
+// Get returns cached data for a given key if present and not expired
+// Set stores data under a given key with a tag (used for debugging) and expiration
+type RequestCache interface {
+	Get(ctx *Ctx, k string) (b []byte, ok bool)
+	Set(ctx *Ctx, k, tg string, b []byte, expires time.Duration)
+}
+
+// CacheS3Manager - subset of aws/s3.Manager used by S3 cache backend
+type CacheS3Manager interface {
+	Get(key string) ([]byte, error)
+	SaveWithKey(payload []byte, key string) error
+	Delete(key string) error
+}
+
+// GetRequestCache - returns cache backend configured for a given context
+// If ctx.Cache is not set, it is created from ctx.CacheBackend on the first call
+func GetRequestCache(ctx *Ctx) RequestCache {
+	requestCacheMtx.Lock()
+	defer requestCacheMtx.Unlock()
+	if ctx.Cache == nil {
+		ctx.Cache = NewRequestCache(ctx)
+	}
+	return ctx.Cache
+}
+
+// NewRequestCache - creates cache backend specified by ctx.CacheBackend
+func NewRequestCache(ctx *Ctx) RequestCache {
+	switch ctx.CacheBackend {
+	case "", CacheBackendL2:
+		return &L2RequestCache{}
+	case CacheBackendMem:
+		return NewMemRequestCache(DefaultMemCacheMaxEntries)
+	case CacheBackendDisk:
+		dir := ctx.CacheDir
+		if dir == "" {
+			dir = DefaultCacheDir
+		}
+		return NewDiskRequestCache(dir)
+	case CacheBackendES:
+		return &ESRequestCache{}
+	case CacheBackendS3:
+		region := ctx.CacheRegion
+		if region == "" {
+			region = DefaultCacheRegion
+		}
+		return NewS3RequestCache(s3util.NewManager(ctx.CacheBucket, region).WithContext(GetContext(ctx)), ctx.DS)
+	}
+	Printf("unknown cache backend '%s', using '%s'\n", ctx.CacheBackend, CacheBackendL2)
+	return &L2RequestCache{}
+}
+
+// CacheValidators - returns ETag and Last-Modified response header values
+func CacheValidators(headers map[string][]string) (etag, lastModified string) {
+	h := http.Header(headers)
+	etag, lastModified = h.Get("ETag"), h.Get("Last-Modified")
+	return
+}
+
+// ConditionalHeaders - returns copy of request headers with If-None-Match/If-Modified-Since set from validators
+func ConditionalHeaders(headers map[string]string, etag, lastModified string) map[string]string {
+	conditional := make(map[string]string)
+	for k, v := range headers {
+		conditional[k] = v
+	}
+	if etag != "" {
+		conditional["If-None-Match"] = etag
+	}
+	if lastModified != "" {
+		conditional["If-Modified-Since"] = lastModified
+	}
+	return conditional
+}
+
+// IsConditionalRequest - do request headers contain If-None-Match or If-Modified-Since
+func IsConditionalRequest(headers map[string]string) bool {
+	for k := range headers {
+		switch http.CanonicalHeaderKey(k) {
+		case "If-None-Match", "If-Modified-Since":
+			return true
+		}
+	}
+	return false
+}
+
+// MergeNotModifiedHeaders - update cached response headers with headers sent in 304 Not Modified response
+func MergeNotModifiedHeaders(cached, notModified map[string][]string) map[string][]string {
+	merged := make(map[string][]string)
+	for k, v := range cached {
+		merged[k] = v
+	}
+	for k, v := range notModified {
+		merged[k] = v
+	}
+	return merged
+}
+
+// L2RequestCache - process memory cache backed by ES dads_cache index (GetL2Cache/SetL2Cache)
+type L2RequestCache struct{}
+
+// Get - get value from cache
+func (c *L2RequestCache) Get(ctx *Ctx, k string) ([]byte, bool) {
+	return GetL2Cache(ctx, k)
+}
+
+// Set - set cache value
+func (c *L2RequestCache) Set(ctx *Ctx, k, tg string, b []byte, expires time.Duration) {
+	SetL2Cache(ctx, k, tg, b, expires)
+}
+
+// ESRequestCache - ES dads_cache index only cache (GetESCache/SetESCache)
+type ESRequestCache struct{}
+
+// Get - get value from cache
+func (c *ESRequestCache) Get(ctx *Ctx, k string) (b []byte, ok bool) {
+	b, _, _, ok = GetESCache(ctx, k)
+	return
+}
+
+// Set - set cache value
+func (c *ESRequestCache) Set(ctx *Ctx, k, tg string, b []byte, expires time.Duration) {
+	SetESCache(ctx, k, tg, b, expires)
+}
+
+// MemRequestCache - in-memory LRU cache holding no more than maxEntries items
+type MemRequestCache struct {
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List
+	mtx        *sync.Mutex
+}
+
+type memRequestCacheItem struct {
+	k     string
+	entry MemCacheEntry
+}
+
+// NewMemRequestCache - creates in-memory LRU cache, maxEntries <= 0 means no limit
+func NewMemRequestCache(maxEntries int) *MemRequestCache {
+	return &MemRequestCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		mtx:        &sync.Mutex{},
+	}
+}
+
+// Get - get value from cache
+func (c *MemRequestCache) Get(ctx *Ctx, k string) (b []byte, ok bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	el, ok := c.entries[k]
+	if !ok {
+		if ctx.Debug > 1 {
+			Printf("MemRequestCache(%s): miss\n", k)
+		}
+		return
+	}
+	item := el.Value.(*memRequestCacheItem)
+	if time.Now().After(item.entry.E) {
+		c.lru.Remove(el)
+		delete(c.entries, k)
+		ok = false
+		if ctx.Debug > 1 {
+			Printf("MemRequestCache(%s,%s): expired %v\n", k, item.entry.G, item.entry.E)
+		}
+		return
+	}
+	c.lru.MoveToFront(el)
+	b = item.entry.B
+	if ctx.Debug > 1 {
+		Printf("MemRequestCache(%s,%s): hit (%v)\n", k, item.entry.G, item.entry.E)
+	}
+	return
+}
+
+// Set - set cache value, evicts least recently used entries when full
+func (c *MemRequestCache) Set(ctx *Ctx, k, tg string, b []byte, expires time.Duration) {
+	t := time.Now()
+	entry := MemCacheEntry{G: tg, B: b, T: t, E: t.Add(expires)}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	el, ok := c.entries[k]
+	if ok {
+		el.Value.(*memRequestCacheItem).entry = entry
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[k] = c.lru.PushFront(&memRequestCacheItem{k: k, entry: entry})
+	for c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		last := c.lru.Back()
+		c.lru.Remove(last)
+		delete(c.entries, last.Value.(*memRequestCacheItem).k)
+	}
+}
+
+// DiskRequestCache - local directory cache, one file per key
+type DiskRequestCache struct {
+	dir string
+}
+
+// NewDiskRequestCache - creates local directory cache in dir
+func NewDiskRequestCache(dir string) *DiskRequestCache {
+	return &DiskRequestCache{dir: dir}
+}
+
+func (c *DiskRequestCache) path(k string) string {
+	k = strings.Replace(k, string(filepath.Separator), "_", -1)
+	if len(k) > 2 {
+		return filepath.Join(c.dir, k[:2], k)
+	}
+	return filepath.Join(c.dir, k)
+}
+
+// Get - get value from cache
+func (c *DiskRequestCache) Get(ctx *Ctx, k string) (b []byte, ok bool) {
+	fn := c.path(k)
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		if ctx.Debug > 1 {
+			Printf("DiskRequestCache(%s): miss\n", k)
+		}
+		return
+	}
+	var entry MemCacheEntry
+	err = jsoniter.Unmarshal(data, &entry)
+	if err != nil {
+		Printf("DiskRequestCache(%s): cannot decode %s: %+v\n", k, fn, err)
+		_ = os.Remove(fn)
+		return
+	}
+	if time.Now().After(entry.E) {
+		_ = os.Remove(fn)
+		if ctx.Debug > 1 {
+			Printf("DiskRequestCache(%s,%s): expired %v\n", k, entry.G, entry.E)
+		}
+		return
+	}
+	b = entry.B
+	ok = true
+	if ctx.Debug > 1 {
+		Printf("DiskRequestCache(%s,%s): hit (%v)\n", k, entry.G, entry.E)
+	}
+	return
+}
+
+// Set - set cache value, file is written to a temporary name first and then renamed
+func (c *DiskRequestCache) Set(ctx *Ctx, k, tg string, b []byte, expires time.Duration) {
+	t := time.Now()
+	data, err := jsoniter.Marshal(&MemCacheEntry{G: tg, B: b, T: t, E: t.Add(expires)})
+	if err != nil {
+		Printf("DiskRequestCache(%s,%s): marshal error: %+v\n", k, tg, err)
+		return
+	}
+	fn := c.path(k)
+	err = os.MkdirAll(filepath.Dir(fn), 0755)
+	if err != nil {
+		Printf("DiskRequestCache(%s,%s): cannot create directory for %s: %+v\n", k, tg, fn, err)
+		return
+	}
+	tmp := fmt.Sprintf("%s.%d.tmp", fn, t.UnixNano())
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		Printf("DiskRequestCache(%s,%s): cannot write %s: %+v\n", k, tg, tmp, err)
+		return
+	}
+	err = os.Rename(tmp, fn)
+	if err != nil {
+		_ = os.Remove(tmp)
+		Printf("DiskRequestCache(%s,%s): cannot rename %s: %+v\n", k, tg, tmp, err)
+		return
+	}
+	if ctx.Debug > 1 {
+		Printf("DiskRequestCache(%s,%s): added (%v)\n", k, tg, t.Add(expires))
+	}
+}
+
+// S3RequestCache - S3 bucket cache, one object per key stored under prefix
+type S3RequestCache struct {
+	manager CacheS3Manager
+	prefix  string
+}
+
+// NewS3RequestCache - creates S3 cache using manager, objects are stored as "dads_cache/{prefix}/{key}"
+func NewS3RequestCache(manager CacheS3Manager, prefix string) *S3RequestCache {
+	return &S3RequestCache{manager: manager, prefix: "dads_cache/" + strings.Replace(prefix, " ", "_", -1) + "/"}
+}
+
+// Get - get value from cache
+func (c *S3RequestCache) Get(ctx *Ctx, k string) (b []byte, ok bool) {
+	key := c.prefix + k
+	data, err := c.manager.Get(key)
+	if err != nil || len(data) == 0 {
+		if ctx.Debug > 1 {
+			Printf("S3RequestCache(%s): miss\n", k)
+		}
+		return
+	}
+	var entry MemCacheEntry
+	err = jsoniter.Unmarshal(data, &entry)
+	if err != nil {
+		Printf("S3RequestCache(%s): cannot decode %s: %+v\n", k, key, err)
+		return
+	}
+	if time.Now().After(entry.E) {
+		_ = c.manager.Delete(key)
+		if ctx.Debug > 1 {
+			Printf("S3RequestCache(%s,%s): expired %v\n", k, entry.G, entry.E)
+		}
+		return
+	}
+	b = entry.B
+	ok = true
+	if ctx.Debug > 1 {
+		Printf("S3RequestCache(%s,%s): hit (%v)\n", k, entry.G, entry.E)
+	}
+	return
+}
+
+// Set - set cache value
+func (c *S3RequestCache) Set(ctx *Ctx, k, tg string, b []byte, expires time.Duration) {
+	t := time.Now()
+	data, err := jsoniter.Marshal(&MemCacheEntry{G: tg, B: b, T: t, E: t.Add(expires)})
+	if err != nil {
+		Printf("S3RequestCache(%s,%s): marshal error: %+v\n", k, tg, err)
+		return
+	}
+	err = c.manager.SaveWithKey(data, c.prefix+k)
+	if err != nil {
+		Printf("S3RequestCache(%s,%s): save error: %+v\n", k, tg, err)
+		return
+	}
+	if ctx.Debug > 1 {
+		Printf("S3RequestCache(%s,%s): added (%v)\n", k, tg, t.Add(expires))
+	}
+}
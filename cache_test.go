@@ -0,0 +1,130 @@
+package ds
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConditionalHeaders(t *testing.T) {
+	headers := map[string]string{"Accept": "application/json"}
+	etag, lastModified := CacheValidators(map[string][]string{"Etag": {`W/"123"`}, "Last-Modified": {"Tue, 01 Jun 2021 13:00:00 GMT"}})
+	conditional := ConditionalHeaders(headers, etag, lastModified)
+	assert.Equal(t, `W/"123"`, conditional["If-None-Match"])
+	assert.Equal(t, "Tue, 01 Jun 2021 13:00:00 GMT", conditional["If-Modified-Since"])
+	assert.Equal(t, "application/json", conditional["Accept"])
+	assert.False(t, IsConditionalRequest(headers))
+	assert.True(t, IsConditionalRequest(conditional))
+	assert.True(t, IsConditionalRequest(map[string]string{"if-none-match": "x"}))
+}
+
+func TestMemRequestCache(t *testing.T) {
+	ctx := &Ctx{}
+	c := NewMemRequestCache(2)
+	c.Set(ctx, "a", "tag", []byte("1"), time.Hour)
+	c.Set(ctx, "b", "tag", []byte("2"), time.Hour)
+	// Use "a", so "b" is the least recently used one and is evicted by "c"
+	b, ok := c.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), b)
+	c.Set(ctx, "c", "tag", []byte("3"), time.Hour)
+	_, ok = c.Get(ctx, "b")
+	assert.False(t, ok)
+	b, ok = c.Get(ctx, "c")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("3"), b)
+	// Replacing existing entry doesn't evict anything
+	c.Set(ctx, "a", "tag", []byte("4"), time.Hour)
+	b, ok = c.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("4"), b)
+	_, ok = c.Get(ctx, "c")
+	assert.True(t, ok)
+	// Expired entries are removed
+	c.Set(ctx, "d", "tag", []byte("5"), -time.Second)
+	_, ok = c.Get(ctx, "d")
+	assert.False(t, ok)
+	assert.Equal(t, 1, c.lru.Len())
+}
+
+func TestDiskRequestCache(t *testing.T) {
+	ctx := &Ctx{}
+	dir, err := ioutil.TempDir("", "dads_cache")
+	assert.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	c := NewDiskRequestCache(dir)
+	_, ok := c.Get(ctx, "missing")
+	assert.False(t, ok)
+	c.Set(ctx, "abcdef", "tag", []byte("data"), time.Hour)
+	_, err = os.Stat(filepath.Join(dir, "ab", "abcdef"))
+	assert.NoError(t, err)
+	// Another instance reads what the first one wrote
+	b, ok := NewDiskRequestCache(dir).Get(ctx, "abcdef")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("data"), b)
+	// Expired and corrupted entries are removed
+	c.Set(ctx, "expired", "tag", []byte("data"), -time.Second)
+	_, ok = c.Get(ctx, "expired")
+	assert.False(t, ok)
+	_, err = os.Stat(c.path("expired"))
+	assert.True(t, os.IsNotExist(err))
+	assert.NoError(t, ioutil.WriteFile(c.path("abcdef"), []byte("garbage"), 0644))
+	_, ok = c.Get(ctx, "abcdef")
+	assert.False(t, ok)
+	_, err = os.Stat(c.path("abcdef"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+type testCacheS3Manager struct {
+	mtx     sync.Mutex
+	objects map[string][]byte
+}
+
+func (m *testCacheS3Manager) Get(key string) ([]byte, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("no such key: %s", key)
+	}
+	return data, nil
+}
+
+func (m *testCacheS3Manager) SaveWithKey(payload []byte, key string) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.objects[key] = payload
+	return nil
+}
+
+func (m *testCacheS3Manager) Delete(key string) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+func TestS3RequestCache(t *testing.T) {
+	ctx := &Ctx{}
+	manager := &testCacheS3Manager{objects: make(map[string][]byte)}
+	c := NewS3RequestCache(manager, "my ds")
+	_, ok := c.Get(ctx, "missing")
+	assert.False(t, ok)
+	c.Set(ctx, "key", "tag", []byte("data"), time.Hour)
+	_, ok = manager.objects["dads_cache/my_ds/key"]
+	assert.True(t, ok)
+	b, ok := c.Get(ctx, "key")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("data"), b)
+	c.Set(ctx, "expired", "tag", []byte("data"), -time.Second)
+	_, ok = c.Get(ctx, "expired")
+	assert.False(t, ok)
+	_, ok = manager.objects["dads_cache/my_ds/expired"]
+	assert.False(t, ok)
+}
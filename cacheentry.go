@@ -0,0 +1,265 @@
+package ds
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	// CacheEntryVersion - current version of binary cache entry format
+	CacheEntryVersion = 1
+	// CacheCompressionNone - store cache entries uncompressed
+	CacheCompressionNone = "none"
+	// CacheCompressionGzip - gzip cache entries bodies (default)
+	CacheCompressionGzip = "gzip"
+	// CacheCompressMinSize - entries smaller than this are never compressed
+	CacheCompressMinSize = 0x400
+	// cache entry header compression byte values
+	cacheEntryPlain = 0
+	cacheEntryGzip  = 1
+)
+
+var (
+	// CacheEntryMagic - binary cache entry prefix, legacy entries always start with a decimal HTTP status
+	CacheEntryMagic = []byte{0xda, 0xce}
+)
+
+// CachedResponse - HTTP response stored in Request cache, Data is either a raw body or a marshalled JSON result
+type CachedResponse struct {
+	Status  int
+	IsJSON  bool
+	Cookies []string
+	Headers map[string][]string
+	Data    []byte
+}
+
+// CheckCacheCompression - checks if compression is supported, empty means default (gzip)
+func CheckCacheCompression(compression string) error {
+	switch compression {
+	case "", CacheCompressionNone, CacheCompressionGzip:
+		return nil
+	}
+	return fmt.Errorf("unsupported cache compression '%s', supported: %s, %s", compression, CacheCompressionNone, CacheCompressionGzip)
+}
+
+// EncodeCachedResponse - encode response as a versioned binary cache entry
+// Entry is: magic (2 bytes), version (1 byte), compression (1 byte) and then (optionally compressed) payload
+// Payload is: uvarint status, isJSON byte, cookies, headers and data, all strings/byte arrays are uvarint length-prefixed
+func EncodeCachedResponse(r CachedResponse, compression string) (data []byte, err error) {
+	err = CheckCacheCompression(compression)
+	if err != nil {
+		return
+	}
+	var payload bytes.Buffer
+	putUvarint(&payload, uint64(r.Status))
+	if r.IsJSON {
+		payload.WriteByte(1)
+	} else {
+		payload.WriteByte(0)
+	}
+	putUvarint(&payload, uint64(len(r.Cookies)))
+	for _, cookie := range r.Cookies {
+		putBytes(&payload, []byte(cookie))
+	}
+	putUvarint(&payload, uint64(len(r.Headers)))
+	for k, vs := range r.Headers {
+		putBytes(&payload, []byte(k))
+		putUvarint(&payload, uint64(len(vs)))
+		for _, v := range vs {
+			putBytes(&payload, []byte(v))
+		}
+	}
+	putBytes(&payload, r.Data)
+	kind := byte(cacheEntryPlain)
+	if compression != CacheCompressionNone && len(r.Data) >= CacheCompressMinSize {
+		kind = cacheEntryGzip
+	}
+	data = append(data, CacheEntryMagic...)
+	data = append(data, CacheEntryVersion, kind)
+	if kind == cacheEntryPlain {
+		data = append(data, payload.Bytes()...)
+		return
+	}
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	_, err = w.Write(payload.Bytes())
+	if err != nil {
+		return
+	}
+	err = w.Close()
+	if err != nil {
+		return
+	}
+	data = append(data, compressed.Bytes()...)
+	return
+}
+
+// DecodeCachedResponse - decode cache entry, both binary and legacy 'status:isJson:b64cookies:b64headers:data' entries are supported
+func DecodeCachedResponse(data []byte) (r CachedResponse, err error) {
+	if !bytes.HasPrefix(data, CacheEntryMagic) {
+		return decodeLegacyCachedResponse(data)
+	}
+	n := len(CacheEntryMagic)
+	if len(data) < n+2 {
+		err = fmt.Errorf("truncated cache entry header")
+		return
+	}
+	version, kind := data[n], data[n+1]
+	if version != CacheEntryVersion {
+		err = fmt.Errorf("unsupported cache entry version %d", version)
+		return
+	}
+	payload := data[n+2:]
+	switch kind {
+	case cacheEntryPlain:
+	case cacheEntryGzip:
+		var gr *gzip.Reader
+		gr, err = gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return
+		}
+		payload, err = ioutil.ReadAll(gr)
+		_ = gr.Close()
+		if err != nil {
+			return
+		}
+	default:
+		err = fmt.Errorf("unsupported cache entry compression %d", kind)
+		return
+	}
+	rd := bytes.NewReader(payload)
+	status, err := binary.ReadUvarint(rd)
+	if err != nil {
+		return
+	}
+	r.Status = int(status)
+	isJSON, err := rd.ReadByte()
+	if err != nil {
+		return
+	}
+	r.IsJSON = isJSON != 0
+	nCookies, err := readCount(rd)
+	if err != nil {
+		return
+	}
+	for i := 0; i < nCookies; i++ {
+		var cookie []byte
+		cookie, err = readBytes(rd)
+		if err != nil {
+			return
+		}
+		r.Cookies = append(r.Cookies, string(cookie))
+	}
+	nHeaders, err := readCount(rd)
+	if err != nil {
+		return
+	}
+	r.Headers = make(map[string][]string)
+	for i := 0; i < nHeaders; i++ {
+		var (
+			k       []byte
+			nValues int
+		)
+		k, err = readBytes(rd)
+		if err != nil {
+			return
+		}
+		nValues, err = readCount(rd)
+		if err != nil {
+			return
+		}
+		vs := []string{}
+		for j := 0; j < nValues; j++ {
+			var v []byte
+			v, err = readBytes(rd)
+			if err != nil {
+				return
+			}
+			vs = append(vs, string(v))
+		}
+		r.Headers[string(k)] = vs
+	}
+	r.Data, err = readBytes(rd)
+	return
+}
+
+// decodeLegacyCachedResponse - decode legacy cache entry 'status:isJson:b64cookies:b64headers:data'
+func decodeLegacyCachedResponse(data []byte) (r CachedResponse, err error) {
+	ary := bytes.Split(data, []byte(":"))
+	if len(ary) < 5 {
+		err = fmt.Errorf("malformed cache entry, %d fields", len(ary))
+		return
+	}
+	r.Status, err = strconv.Atoi(string(ary[0]))
+	if err != nil {
+		return
+	}
+	var iJSON int
+	iJSON, err = strconv.Atoi(string(ary[1]))
+	if err != nil {
+		return
+	}
+	r.IsJSON = iJSON != 0
+	r.Cookies, err = Base64DecodeCookies(ary[2])
+	if err != nil {
+		return
+	}
+	r.Headers, err = Base64DecodeHeaders(ary[3])
+	if err != nil {
+		return
+	}
+	r.Data = bytes.Join(ary[4:], []byte(":"))
+	return
+}
+
+// Result - cached response result: raw body or unmarshalled JSON
+func (r CachedResponse) Result() (result interface{}, err error) {
+	if !r.IsJSON {
+		result = r.Data
+		return
+	}
+	err = jsoniter.Unmarshal(r.Data, &result)
+	return
+}
+
+func putUvarint(buf *bytes.Buffer, v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func putBytes(buf *bytes.Buffer, b []byte) {
+	putUvarint(buf, uint64(len(b)))
+	buf.Write(b)
+}
+
+// readCount - read uvarint count, it cannot exceed number of bytes left (each item takes at least one byte)
+func readCount(rd *bytes.Reader) (n int, err error) {
+	v, err := binary.ReadUvarint(rd)
+	if err != nil {
+		return
+	}
+	if v > uint64(rd.Len()) {
+		err = fmt.Errorf("corrupted cache entry, count %d exceeds %d bytes left", v, rd.Len())
+		return
+	}
+	n = int(v)
+	return
+}
+
+func readBytes(rd *bytes.Reader) (b []byte, err error) {
+	n, err := readCount(rd)
+	if err != nil {
+		return
+	}
+	b = make([]byte, n)
+	if n > 0 {
+		_, err = rd.Read(b)
+	}
+	return
+}
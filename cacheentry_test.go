@@ -0,0 +1,59 @@
+package ds
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachedResponseRoundTrip(t *testing.T) {
+	big := bytes.Repeat([]byte(`{"key":"value"},`), 0x100)
+	tests := []struct {
+		name        string
+		compression string
+		entry       CachedResponse
+	}{
+		{"Raw body", "", CachedResponse{Status: 200, Cookies: []string{"a===1"}, Headers: map[string][]string{"Etag": {`"abc"`}}, Data: []byte("plain text")}},
+		{"JSON body with colons", CacheCompressionNone, CachedResponse{Status: 200, IsJSON: true, Headers: map[string][]string{}, Data: []byte(`{"url":"http://x:80"}`)}},
+		{"Empty body", CacheCompressionGzip, CachedResponse{Status: 204, Headers: map[string][]string{"X-Empty": {""}}, Data: []byte{}}},
+		{"Compressed", CacheCompressionGzip, CachedResponse{Status: 200, IsJSON: true, Headers: map[string][]string{"Link": {"<a>", "<b>"}}, Data: big}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := EncodeCachedResponse(tt.entry, tt.compression)
+			assert.NoError(t, err)
+			assert.True(t, bytes.HasPrefix(data, CacheEntryMagic))
+			got, err := DecodeCachedResponse(data)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.entry.Status, got.Status)
+			assert.Equal(t, tt.entry.IsJSON, got.IsJSON)
+			assert.Equal(t, tt.entry.Cookies, got.Cookies)
+			assert.Equal(t, tt.entry.Headers, got.Headers)
+			assert.Equal(t, tt.entry.Data, got.Data)
+		})
+	}
+	data, err := EncodeCachedResponse(CachedResponse{Status: 200, Data: big}, CacheCompressionGzip)
+	assert.NoError(t, err)
+	assert.True(t, len(data) < len(big))
+	_, err = EncodeCachedResponse(CachedResponse{}, "lzma")
+	assert.Error(t, err)
+}
+
+func TestDecodeCachedResponseLegacy(t *testing.T) {
+	legacy := []byte("200:1:")
+	legacy = append(legacy, Base64EncodeCookies([]string{"a===1"})...)
+	legacy = append(legacy, ':')
+	legacy = append(legacy, Base64EncodeHeaders(map[string][]string{"Etag": {`"abc"`}})...)
+	legacy = append(legacy, []byte(`:{"url":"http://x:80"}`)...)
+	got, err := DecodeCachedResponse(legacy)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, got.Status)
+	assert.True(t, got.IsJSON)
+	assert.Equal(t, map[string][]string{"Etag": {`"abc"`}}, got.Headers)
+	assert.Equal(t, []byte(`{"url":"http://x:80"}`), got.Data)
+	for _, bad := range [][]byte{[]byte("200:1"), CacheEntryMagic, append(append([]byte{}, CacheEntryMagic...), 9, 0), append(append([]byte{}, CacheEntryMagic...), CacheEntryVersion, 0, 200, 1, 0, 0, 99)} {
+		_, err = DecodeCachedResponse(bad)
+		assert.Error(t, err)
+	}
+}
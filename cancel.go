@@ -0,0 +1,55 @@
+package ds
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// InitContext - create cancellable context.Context carried by ctx, it is cancelled on SIGTERM
+// If ctx.Context is already set (for example with a deadline), it is used as a parent
+// All HTTP requests, retries, rate limit waits and commands started by the library are cancelled with it
+func InitContext(ctx *Ctx) {
+	parent := ctx.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx.Context, ctx.Cancel = context.WithCancel(parent)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM)
+	go func(c context.Context, cancel context.CancelFunc) {
+		select {
+		case sig := <-sigs:
+			Printf("received %v signal, cancelling all operations\n", sig)
+			cancel()
+		case <-c.Done():
+		}
+		signal.Stop(sigs)
+	}(ctx.Context, ctx.Cancel)
+}
+
+// GetContext - returns context.Context carried by ctx, context.Background() if not set
+func GetContext(ctx *Ctx) context.Context {
+	if ctx.Context == nil {
+		return context.Background()
+	}
+	return ctx.Context
+}
+
+// Sleep - sleep for a given duration, returns context error early when ctx is cancelled
+func Sleep(ctx *Ctx, d time.Duration) error {
+	c := GetContext(ctx)
+	if d <= 0 {
+		return c.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-c.Done():
+		return c.Err()
+	}
+}
@@ -0,0 +1,24 @@
+package ds
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSleep(t *testing.T) {
+	ctx := &Ctx{}
+	assert.NoError(t, Sleep(ctx, time.Millisecond))
+	c, cancel := context.WithCancel(context.Background())
+	ctx.Context = c
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	assert.Equal(t, context.Canceled, Sleep(ctx, time.Minute))
+	assert.True(t, time.Since(start) < time.Minute)
+	assert.Equal(t, context.Canceled, Sleep(ctx, 0))
+}
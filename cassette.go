@@ -0,0 +1,29 @@
+package ds
+
+import libHttp "github.com/LF-Engineering/insights-datasource-shared/http"
+
+// InitCassette - set up HTTP record/replay mode from ctx.HTTPRecord/ctx.HTTPReplay directories
+// Cassette is used by Request and by all http.ClientProviders created after this call
+// Secrets are scrubbed using FilterRedacted before writing cassette files, replay mode has a priority over record mode
+func InitCassette(ctx *Ctx) (err error) {
+	mode, dir := "", ""
+	if ctx.HTTPReplay != "" {
+		mode, dir = libHttp.CassetteReplay, ctx.HTTPReplay
+	} else if ctx.HTTPRecord != "" {
+		mode, dir = libHttp.CassetteRecord, ctx.HTTPRecord
+	}
+	if mode == "" {
+		return
+	}
+	cassette, err := libHttp.NewCassette(mode, dir, FilterRedacted)
+	if err != nil {
+		return
+	}
+	cassette.Transport = transport(ctx)
+	ctx.HTTPCassette = cassette
+	libHttp.SetDefaultCassette(cassette)
+	if ctx.Debug > 0 {
+		Printf("HTTP %s mode using %s\n", mode, dir)
+	}
+	return
+}
@@ -0,0 +1,104 @@
+package ds
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadConfigFile - read YAML or JSON config file into key -> value map
+// Keys are flag names without data source prefix (for example "es-url" for --dsname-es-url)
+// Lists (for example categories or tags) are joined using "," and dates are formatted as RFC3339
+func LoadConfigFile(path string) (config map[string]string, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var raw map[string]interface{}
+	err = yaml.Unmarshal(data, &raw)
+	if err != nil {
+		err = fmt.Errorf("cannot parse config file %s: %v", path, err)
+		return
+	}
+	config = make(map[string]string)
+	for k, v := range raw {
+		var s string
+		s, err = configValue(v)
+		if err != nil {
+			err = fmt.Errorf("config file %s key %s: %v", path, k, err)
+			return
+		}
+		config[k] = s
+	}
+	return
+}
+
+func configValue(v interface{}) (string, error) {
+	switch value := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	case time.Time:
+		return value.Format(time.RFC3339Nano), nil
+	case []interface{}:
+		items := []string{}
+		for _, item := range value {
+			s, err := configValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	case map[string]interface{}:
+		return "", fmt.Errorf("nested objects are not supported")
+	}
+	return fmt.Sprintf("%v", v), nil
+}
+
+// ApplyConfigFile - set flags from config file, unless they were passed on the command line
+// This gives precedence: defaults < config file < command line flags < environment variables
+// Unknown keys are an error, so typos in config files don't go unnoticed
+// Values set from config file are reported by FlagConfigured, but not by FlagPassed
+func ApplyConfigFile(ctx *Ctx, path string) (err error) {
+	config, err := LoadConfigFile(path)
+	if err != nil {
+		return
+	}
+	fs := ctx.FlagSet()
+	passed := make(map[string]struct{})
+	fs.Visit(func(f *flag.Flag) {
+		passed[f.Name] = struct{}{}
+	})
+	keys := []string{}
+	for k := range config {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		name := ctx.DSFlag + k
+		if fs.Lookup(name) == nil {
+			err = fmt.Errorf("config file %s: unknown key %s", path, k)
+			return
+		}
+		if _, ok := passed[name]; ok {
+			continue
+		}
+		err = fs.Set(name, config[k])
+		if err != nil {
+			err = fmt.Errorf("config file %s key %s: %v", path, k, err)
+			return
+		}
+		if ctx.fileFlags == nil {
+			ctx.fileFlags = make(map[string]struct{})
+		}
+		ctx.fileFlags[name] = struct{}{}
+	}
+	return
+}
@@ -0,0 +1,73 @@
+package ds
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	assert.Nil(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	var testCases = []struct {
+		name     string
+		data     string
+		expected map[string]string
+		err      bool
+	}{
+		{
+			name:     "config.yaml",
+			data:     "debug: 2\nes-url: http://localhost:9200\ncategories:\n  - issue\n  - pull_request\nno-cache: true\ndate-from: 2020-01-02T03:04:05Z\n",
+			expected: map[string]string{"debug": "2", "es-url": "http://localhost:9200", "categories": "issue,pull_request", "no-cache": "true", "date-from": "2020-01-02T03:04:05Z"},
+		},
+		{
+			name:     "config.json",
+			data:     `{"debug": 1, "tags": ["a", "b"], "project": "p"}`,
+			expected: map[string]string{"debug": "1", "tags": "a,b", "project": "p"},
+		},
+		{
+			name: "nested.yaml",
+			data: "es:\n  url: x\n",
+			err:  true,
+		},
+	}
+	for _, tc := range testCases {
+		path := filepath.Join(dir, tc.name)
+		assert.Nil(t, ioutil.WriteFile(path, []byte(tc.data), 0644))
+		config, err := LoadConfigFile(path)
+		if tc.err {
+			assert.NotNil(t, err, tc.name)
+			continue
+		}
+		assert.Nil(t, err, tc.name)
+		assert.Equal(t, tc.expected, config, tc.name)
+	}
+}
+
+func TestApplyConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	assert.Nil(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "config.yaml")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("debug: 2\nproject: from-file\n"), 0644))
+	var ctx Ctx
+	ctx.InitEnv("config file ds")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	ctx.InitFlagSet(fs, []string{"--config-file-ds-config", path, "--config-file-ds-project", "from-flag"})
+	ctx.Cancel()
+	// Command line flags take precedence over config file
+	assert.Equal(t, 2, ctx.Debug)
+	assert.Equal(t, "from-flag", ctx.Project)
+	assert.False(t, FlagPassed(&ctx, "debug"))
+	assert.True(t, FlagConfigured(&ctx, "debug"))
+	assert.True(t, FlagPassed(&ctx, "project"))
+	assert.True(t, FlagConfigured(&ctx, "project"))
+	assert.False(t, FlagConfigured(&ctx, "log-level"))
+	assert.Equal(t, ConfigSourceFile, ctx.ConfigSource("debug"))
+	assert.Equal(t, ConfigSourceFlag, ctx.ConfigSource("project"))
+}
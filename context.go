@@ -1,12 +1,17 @@
 package ds
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"strconv"
 	"strings"
 	"time"
+
+	libErrs "github.com/LF-Engineering/insights-datasource-shared/errs"
+	libHttp "github.com/LF-Engineering/insights-datasource-shared/http"
 )
 
 const (
@@ -15,33 +20,95 @@ const (
 )
 
 // Ctx - environment context packed in structure
-// It gets configuration (named, say: xyz abc) from command line (--dsname-xyz-abc) or from env (DSNAME_XYZ_ABC), env value has higher priority than commandline flag
+// It gets configuration (named, say: xyz abc) from config file (xyz-abc key), command line (--dsname-xyz-abc) or from env (DSNAME_XYZ_ABC)
+// Precedence is: defaults < config file (--dsname-config or DSNAME_CONFIG, YAML or JSON) < commandline flag < env value
+// Values can be secret references: ssm://param-name, file:///run/secrets/x or env://OTHER_VAR, they are resolved during Init and redacted
 type Ctx struct {
-	DS            string              // original data source name
-	DSEnv         string              // prefix for env variables: "abc xyz" -> "ABC_XYZ_"
-	DSFlag        string              // prefix for commanding flags: "abc xyz" -> "--abc-xyz"
-	Debug         int                 // debug level: 0-no, 1-info, 2-verbose
-	Retry         int                 // how many times retry failed operatins, default 5
-	ST            bool                // use single threaded version, false: use multi threaded version, default false
-	NCPUs         int                 // set to override number of CPUs to run, this overwrites --st, default 0 (which means do not use it, use all CPU reported by go library)
-	NCPUsScale    float64             // scale number of CPUs, for example 2.0 will report number of cpus 2.0 the number of actually available CPUs
-	Tags          []string            // tags 'tag1,tag2,...,tagN'
-	DryRun        bool                // only output data to console
-	Project       string              // set project can be for example "ONAP"
-	ProjectFilter bool                // set project filter (normally you only specify project, if you add project-filter flag, DS will try to filter by this project on an actual data source level)
-	PackSize      int                 // data sources are outputting events in packs - here you can specify pack size, default is 1000
-	ESURL         string              // set ES cluster URL (optional but rather recommended)
-	NoCache       bool                // do not cache *any* HTTP requests
-	NoIncremental bool                // do not use incremental sync, always process full data instead
-	Categories    map[string]struct{} // some data sources allow specifying categories, you can pass them with --dsname-categories 'category1,category2,...' flag, it will keep unique set of them.
-	DateFrom      *time.Time          // date from (for resuming)
-	DateTo        *time.Time          // date to (for limiting)
+	DS                      string                // original data source name
+	DSEnv                   string                // prefix for env variables: "abc xyz" -> "ABC_XYZ_"
+	DSFlag                  string                // prefix for commanding flags: "abc xyz" -> "--abc-xyz"
+	Flags                   *flag.FlagSet         // flag set used by Init, nil means global flag.CommandLine
+	ConfigFile              string                // YAML or JSON config file used by Init (--dsname-config)
+	PrintConfigAndExit      bool                  // print redacted configuration description with validation errors and exit (--dsname-print-config)
+	LogLevel                string                // min level of messages logged by Logger: debug, info, warn, error, default debug when Debug > 0, info otherwise
+	LogFormat               string                // log format: text (default) or json, applies to Printf too
+	LogSinks                []string              // log sinks 'stdout,file,es,s3', default is console and ES (when logger was added)
+	LogFile                 string                // log file used by file sink and as ES sink fallback, default {dsname}.log
+	LogFileMaxSize          int                   // max log file size in MB, it is rotated when exceeded, default 100
+	LogFileBackups          int                   // number of rotated log files kept, default 5, 0 means no backups
+	LogBucket               string                // S3 bucket used by s3 log sink
+	LogRegion               string                // AWS region used by s3 log sink, default us-east-2
+	Debug                   int                   // debug level: 0-no, 1-info, 2-verbose
+	Retry                   int                   // how many times retry failed operatins, default 5
+	ST                      bool                  // use single threaded version, false: use multi threaded version, default false
+	NCPUs                   int                   // set to override number of CPUs to run, this overwrites --st, default 0 (which means do not use it, use all CPU reported by go library)
+	NCPUsScale              float64               // scale number of CPUs, for example 2.0 will report number of cpus 2.0 the number of actually available CPUs
+	Tags                    []string              // tags 'tag1,tag2,...,tagN'
+	DryRun                  bool                  // only output data to console
+	Project                 string                // set project can be for example "ONAP"
+	ProjectFilter           bool                  // set project filter (normally you only specify project, if you add project-filter flag, DS will try to filter by this project on an actual data source level)
+	PackSize                int                   // data sources are outputting events in packs - here you can specify pack size, default is 1000
+	ESURL                   string                // set ES cluster URL (optional but rather recommended)
+	NoCache                 bool                  // do not cache *any* HTTP requests
+	CacheBackend            string                // HTTP requests cache backend: l2 (memory + ES, default), mem, disk, es, s3
+	CacheDir                string                // directory used by disk cache backend, default .dads_cache
+	CacheBucket             string                // S3 bucket used by s3 cache backend
+	CacheRegion             string                // AWS region used by s3 cache backend, default us-east-2
+	Cache                   RequestCache          // HTTP requests cache backend instance, created from CacheBackend on first use when not set
+	CacheCompression        string                // HTTP requests cache entries compression: gzip (default), none
+	CacheRevalidateFor      time.Duration         // keep stale cache entries having ETag/Last-Modified that long and revalidate them using conditional requests, default 168h, 0 disables
+	NoIncremental           bool                  // do not use incremental sync, always process full data instead
+	RateLimitHeader         string                // rate limit remaining quota response header, default X-RateLimit-Remaining
+	RateLimitResetHeader    string                // rate limit reset response header, default X-RateLimit-Reset
+	MinRateLimit            int                   // wait for rate limit reset when remaining quota is <= this value, default 0
+	TokenPools              map[string]*TokenPool // API token pools keyed by host, see AddTokenPool
+	Context                 context.Context       // cancelled on SIGTERM (see InitContext), cancels HTTP requests, retries, waits and commands, can be set with a deadline before Init
+	Cancel                  context.CancelFunc    // cancels Context
+	HTTPTimeout             time.Duration         // whole HTTP request timeout (including reading body), default 0 (no timeout)
+	HTTPConnectTimeout      time.Duration         // HTTP connection timeout, default 30s
+	HTTPProxy               string                // HTTP proxy URL, default is to use HTTP_PROXY/HTTPS_PROXY/NO_PROXY env variables
+	HTTPCABundle            string                // PEM file with additional CA certificates to trust
+	HTTPClientCert          string                // PEM file with client certificate (mutual TLS)
+	HTTPClientKey           string                // PEM file with client certificate key (mutual TLS)
+	HTTPMaxIdleConnsPerHost int                   // max idle (keep-alive) connections per host, default 2
+	HTTPMaxConnsPerHost     int                   // max connections per host, default 0 (no limit)
+	HTTPNoSSLVerify         bool                  // do not verify TLS certificates of any host
+	HTTPInsecureHosts       []string              // do not verify TLS certificates of those hosts 'host1,host2,...,hostN'
+	HTTPTransport           http.RoundTripper     // HTTP transport created by Init from HTTP* settings, nil means shared default transport
+	BreakerThreshold        int                   // consecutive failures (network errors, 5xx) to a host opening its circuit (requests are rejected), default 5, 0 disables
+	BreakerTimeout          time.Duration         // how long host's circuit stays open before a probe request is allowed, default 1m
+	MaxInFlight             int                   // max concurrent HTTP requests to a single host, default 0 (no limit)
+	HTTPRecord              string                // record all HTTP requests/responses to cassette files in this directory
+	HTTPReplay              string                // serve all HTTP requests from cassette files in this directory (offline mode)
+	HTTPCassette            *libHttp.Cassette     // HTTP record/replay transport, set by Init when HTTPRecord or HTTPReplay is used
+	fileFlags               map[string]struct{}   // flags set from config file
+	secretOptions           map[string]struct{}   // options declared by AddSecretOptions
+	Categories              map[string]struct{}   // some data sources allow specifying categories, you can pass them with --dsname-categories 'category1,category2,...' flag, it will keep unique set of them.
+	DateFrom                *time.Time            // date from (for resuming)
+	DateTo                  *time.Time            // date to (for limiting)
 }
 
 // Env - get env value using current DS prefix
 // Used for extracting data from environment, Ctx.Env must be set first
+// Secret references (ssm://name, file:///path, env://NAME) are resolved for secret options, see IsSecretOption
+// It exits when secret reference cannot be resolved, use EnvE to handle that error
 func (ctx *Ctx) Env(k string) string {
-	return os.Getenv(ctx.DSEnv + k)
+	v, err := ctx.EnvE(k)
+	FatalOnError(err)
+	return v
+}
+
+// EnvE - like Env but returns config error (errs.IsConfig) when secret reference cannot be resolved
+func (ctx *Ctx) EnvE(k string) (string, error) {
+	v := os.Getenv(ctx.DSEnv + k)
+	if !ctx.IsSecretOption(k) {
+		return v, nil
+	}
+	v, err := ResolveSecret(v)
+	if err != nil {
+		return "", configError(ctx.DSEnv+k, err)
+	}
+	return v, nil
 }
 
 // BoolEnv - parses env variable as bool
@@ -68,6 +135,14 @@ func (ctx *Ctx) EnvSet(k string) bool {
 	return present
 }
 
+// FlagSet - flag set used by Init/InitFlagSet, global flag.CommandLine when context was not initialized with a flag set
+func (ctx *Ctx) FlagSet() *flag.FlagSet {
+	if ctx.Flags == nil {
+		return flag.CommandLine
+	}
+	return ctx.Flags
+}
+
 // InitEnv - initialize environment variables parser
 func (ctx *Ctx) InitEnv(dsName string) {
 	ctx.DS = dsName
@@ -78,48 +153,228 @@ func (ctx *Ctx) InitEnv(dsName string) {
 
 // Init - get context from environment variables
 // Configuration can be specified by both cmd line flags and by ENV variables
+// It registers flags on the global flag set and parses os.Args, use InitFlagSet to have multiple contexts in one process
 func (ctx *Ctx) Init() {
+	ctx.InitFlagSet(flag.CommandLine, os.Args[1:])
+}
+
+// InitFlagSet - get context from environment variables, registering flags on fs and parsing args
+// Data source specific flags can be registered on fs before calling this, they are parsed together with context flags
+func (ctx *Ctx) InitFlagSet(fs *flag.FlagSet, args []string) {
+	FatalOnError(ctx.InitFlagSetE(fs, args))
+	if ctx.PrintConfigAndExit {
+		if !ctx.PrintConfig() {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+}
+
+// InitFlagSetE - like InitFlagSet but returns config error (see errs package) instead of exiting
+// It doesn't exit when print config is requested, caller should check ctx.PrintConfigAndExit
+func (ctx *Ctx) InitFlagSetE(fs *flag.FlagSet, args []string) (err error) {
+	ctx.Flags = fs
 	// Flags
-	flagDebug := flag.Int(ctx.DSFlag+"debug", 0, "debug level: 0-no, 1-info, 2-verbose")
-	flagRetry := flag.Int(ctx.DSFlag+"retry", 5, "how many times retry failed operatins, default 5")
-	flagST := flag.Bool(ctx.DSFlag+"st", false, "use single threaded version")
-	flagNCPUs := flag.Int(ctx.DSFlag+"ncpus", 0, "set to override number of CPUs to run, this overwrites --st, default 0 (which means do not use it, use all CPU reported by go library)")
-	flagNCPUsScale := flag.Float64(ctx.DSFlag+"ncpus-scale", 1.0, "scale number of CPUs, for example 2.0 will report number of cpus 2.0 the number of actually available CPUs")
-	flagTags := flag.String(ctx.DSFlag+"tags", "", "'tag1,tag2,...,tagN'")
-	flagDryRun := flag.Bool(ctx.DSFlag+"dry-run", false, "only output data to console")
-	flagProject := flag.String(ctx.DSFlag+"project", "", "set project can be for example \"ONAP\"")
-	flagProjectFilter := flag.Bool(ctx.DSFlag+"project-filter", false, "set project filter (normally you only specify project, if you add project-filter flag, DS will try to filter by this project on an actual data source level)")
-	flagPackSize := flag.Int(ctx.DSFlag+"pack-size", 1000, "data sources are outputting events in packs - here you can specify pack size, default is 1000")
-	flagESURL := flag.String(ctx.DSFlag+"es-url", "", "ElasticSearch URL (optional but recommended)")
-	flagNoCache := flag.Bool(ctx.DSFlag+"no-cache", false, "do *NOT* cache any HTTP requests")
-	flagNoIncremental := flag.Bool(ctx.DSFlag+"no-incremental", false, "do not use incremental sync")
-	flagDateFrom := flag.String(ctx.DSFlag+"date-from", "", "date-from (for resuming)")
-	flagDateTo := flag.String(ctx.DSFlag+"date-to", "", "date-to (for limiting)")
-	flagCategories := flag.String(ctx.DSFlag+"categories", "", "some data sources allow specifying categories, you can pass them with --dsname-categories 'category1,category2,...' flag, it will keep unique set of them.")
-	flag.Parse()
+	flagDebug := fs.Int(ctx.DSFlag+"debug", 0, "debug level: 0-no, 1-info, 2-verbose")
+	flagRetry := fs.Int(ctx.DSFlag+"retry", 5, "how many times retry failed operatins, default 5")
+	flagST := fs.Bool(ctx.DSFlag+"st", false, "use single threaded version")
+	flagNCPUs := fs.Int(ctx.DSFlag+"ncpus", 0, "set to override number of CPUs to run, this overwrites --st, default 0 (which means do not use it, use all CPU reported by go library)")
+	flagNCPUsScale := fs.Float64(ctx.DSFlag+"ncpus-scale", 1.0, "scale number of CPUs, for example 2.0 will report number of cpus 2.0 the number of actually available CPUs")
+	flagTags := fs.String(ctx.DSFlag+"tags", "", "'tag1,tag2,...,tagN'")
+	flagDryRun := fs.Bool(ctx.DSFlag+"dry-run", false, "only output data to console")
+	flagProject := fs.String(ctx.DSFlag+"project", "", "set project can be for example \"ONAP\"")
+	flagProjectFilter := fs.Bool(ctx.DSFlag+"project-filter", false, "set project filter (normally you only specify project, if you add project-filter flag, DS will try to filter by this project on an actual data source level)")
+	flagPackSize := fs.Int(ctx.DSFlag+"pack-size", 1000, "data sources are outputting events in packs - here you can specify pack size, default is 1000")
+	flagESURL := fs.String(ctx.DSFlag+"es-url", "", "ElasticSearch URL (optional but recommended)")
+	flagNoCache := fs.Bool(ctx.DSFlag+"no-cache", false, "do *NOT* cache any HTTP requests")
+	flagCacheBackend := fs.String(ctx.DSFlag+"cache-backend", "", "HTTP requests cache backend: l2 (memory + ES, default), mem, disk, es, s3")
+	flagCacheDir := fs.String(ctx.DSFlag+"cache-dir", "", "directory used by disk cache backend, default .dads_cache")
+	flagCacheBucket := fs.String(ctx.DSFlag+"cache-bucket", "", "S3 bucket used by s3 cache backend")
+	flagCacheRegion := fs.String(ctx.DSFlag+"cache-region", "", "AWS region used by s3 cache backend, default us-east-2")
+	flagCacheCompression := fs.String(ctx.DSFlag+"cache-compression", "", "HTTP requests cache entries compression: gzip (default), none")
+	flagCacheRevalidateFor := fs.String(ctx.DSFlag+"cache-revalidate-for", "", "keep stale cache entries having ETag/Last-Modified that long and revalidate them using conditional requests, default 168h, 0 disables")
+	flagNoIncremental := fs.Bool(ctx.DSFlag+"no-incremental", false, "do not use incremental sync")
+	flagRateLimitHeader := fs.String(ctx.DSFlag+"rate-limit-header", "", "rate limit remaining quota response header, default X-RateLimit-Remaining")
+	flagRateLimitResetHeader := fs.String(ctx.DSFlag+"rate-limit-reset-header", "", "rate limit reset response header, default X-RateLimit-Reset")
+	flagMinRateLimit := fs.Int(ctx.DSFlag+"min-rate-limit", 0, "wait for rate limit reset when remaining quota is <= this value, default 0")
+	flagHTTPTimeout := fs.String(ctx.DSFlag+"http-timeout", "", "whole HTTP request timeout (including reading body), default 0 (no timeout)")
+	flagHTTPConnectTimeout := fs.String(ctx.DSFlag+"http-connect-timeout", "", "HTTP connection timeout, default 30s")
+	flagHTTPProxy := fs.String(ctx.DSFlag+"http-proxy", "", "HTTP proxy URL, default is to use HTTP_PROXY/HTTPS_PROXY/NO_PROXY env variables")
+	flagHTTPCABundle := fs.String(ctx.DSFlag+"http-ca-bundle", "", "PEM file with additional CA certificates to trust")
+	flagHTTPClientCert := fs.String(ctx.DSFlag+"http-client-cert", "", "PEM file with client certificate (mutual TLS)")
+	flagHTTPClientKey := fs.String(ctx.DSFlag+"http-client-key", "", "PEM file with client certificate key (mutual TLS)")
+	flagHTTPMaxIdleConnsPerHost := fs.Int(ctx.DSFlag+"http-max-idle-conns-per-host", 0, "max idle (keep-alive) connections per host, default 2")
+	flagHTTPMaxConnsPerHost := fs.Int(ctx.DSFlag+"http-max-conns-per-host", 0, "max connections per host, default 0 (no limit)")
+	flagHTTPNoSSLVerify := fs.Bool(ctx.DSFlag+"no-ssl-verify", false, "do not verify TLS certificates of any host")
+	flagHTTPInsecureHosts := fs.String(ctx.DSFlag+"insecure-hosts", "", "do not verify TLS certificates of those hosts 'host1,host2,...,hostN'")
+	flagBreakerThreshold := fs.Int(ctx.DSFlag+"circuit-breaker-threshold", -1, "consecutive failures (network errors, 5xx) to a host opening its circuit (requests are rejected), default 5, 0 disables")
+	flagBreakerTimeout := fs.String(ctx.DSFlag+"circuit-breaker-timeout", "", "how long host's circuit stays open before a probe request is allowed, default 1m")
+	flagMaxInFlight := fs.Int(ctx.DSFlag+"max-in-flight", 0, "max concurrent HTTP requests to a single host, default 0 (no limit)")
+	flagHTTPRecord := fs.String(ctx.DSFlag+"http-record", "", "record all HTTP requests/responses to cassette files in this directory")
+	flagHTTPReplay := fs.String(ctx.DSFlag+"http-replay", "", "serve all HTTP requests from cassette files in this directory (offline mode)")
+	flagDateFrom := fs.String(ctx.DSFlag+"date-from", "", "date-from (for resuming)")
+	flagDateTo := fs.String(ctx.DSFlag+"date-to", "", "date-to (for limiting)")
+	flagCategories := fs.String(ctx.DSFlag+"categories", "", "some data sources allow specifying categories, you can pass them with --dsname-categories 'category1,category2,...' flag, it will keep unique set of them.")
+	flagConfig := fs.String(ctx.DSFlag+"config", "", "YAML or JSON config file, keys are flag names without data source prefix, for example: es-url")
+	flagLogLevel := fs.String(ctx.DSFlag+"log-level", "", "min level of logged messages: debug, info, warn, error, default debug when debug > 0, info otherwise")
+	flagLogFormat := fs.String(ctx.DSFlag+"log-format", "", "log format: text (default), json")
+	flagLogSinks := fs.String(ctx.DSFlag+"log-sinks", "", "log sinks 'stdout,file,es,s3', default is console and ES (when logger was added)")
+	flagLogFile := fs.String(ctx.DSFlag+"log-file", "", "log file used by file sink and as ES sink fallback, default {dsname}.log")
+	flagLogFileMaxSize := fs.Int(ctx.DSFlag+"log-file-max-size", 0, "max log file size in MB, it is rotated when exceeded, default 100")
+	flagLogFileBackups := fs.Int(ctx.DSFlag+"log-file-backups", -1, "number of rotated log files kept, default 5, 0 means no backups")
+	flagLogBucket := fs.String(ctx.DSFlag+"log-bucket", "", "S3 bucket used by s3 log sink")
+	flagLogRegion := fs.String(ctx.DSFlag+"log-region", "", "AWS region used by s3 log sink, default us-east-2")
+	flagPrintConfig := fs.Bool(ctx.DSFlag+"print-config", false, "print effective configuration (redacted, with sources of values) and validation errors as JSON and exit")
+	err = fs.Parse(args)
+	if err != nil {
+		return libErrs.Wrap(libErrs.ErrConfig, err)
+	}
+
+	// Secret references in env values, they are resolved (and cached) here so Env never fails later
+	err = ResolveSecretEnvs(ctx)
+	if err != nil {
+		return libErrs.Wrap(libErrs.ErrConfig, err)
+	}
+
+	// Config file
+	ctx.ConfigFile = *flagConfig
+	if ctx.EnvSet("CONFIG") {
+		ctx.ConfigFile = ctx.Env("CONFIG")
+	}
+	if ctx.ConfigFile != "" {
+		err = ApplyConfigFile(ctx, ctx.ConfigFile)
+		if err != nil {
+			return libErrs.Wrap(libErrs.ErrConfig, err)
+		}
+	}
+
+	// Secret references passed as flags or in config file, env values are resolved by Env
+	err = ResolveSecretFlags(ctx)
+	if err != nil {
+		return libErrs.Wrap(libErrs.ErrConfig, err)
+	}
+
+	// Cancellation
+	InitContext(ctx)
 
 	// Debug
-	if FlagPassed(ctx, "debug") && *flagDebug != 0 {
+	if FlagConfigured(ctx, "debug") && *flagDebug != 0 {
 		ctx.Debug = *flagDebug
 	}
 	if ctx.EnvSet("DEBUG") {
 		debug, err := strconv.Atoi(ctx.Env("DEBUG"))
-		FatalOnError(err)
+		if err != nil {
+			return configError(ctx.DSEnv+"DEBUG", err)
+		}
 		if debug != 0 {
 			ctx.Debug = debug
 		}
 	}
 
+	// Logging
+	ctx.LogLevel = LogLevelInfo
+	if ctx.Debug > 0 {
+		ctx.LogLevel = LogLevelDebug
+	}
+	if FlagConfigured(ctx, "log-level") && *flagLogLevel != "" {
+		ctx.LogLevel = *flagLogLevel
+	}
+	if ctx.EnvSet("LOG_LEVEL") {
+		ctx.LogLevel = ctx.Env("LOG_LEVEL")
+	}
+	err = SetLogLevel(ctx.LogLevel)
+	if err != nil {
+		return libErrs.Wrap(libErrs.ErrConfig, err)
+	}
+	ctx.LogFormat = LogFormatText
+	if FlagConfigured(ctx, "log-format") && *flagLogFormat != "" {
+		ctx.LogFormat = *flagLogFormat
+	}
+	if ctx.EnvSet("LOG_FORMAT") {
+		ctx.LogFormat = ctx.Env("LOG_FORMAT")
+	}
+	err = SetLogFormat(ctx.LogFormat)
+	if err != nil {
+		return libErrs.Wrap(libErrs.ErrConfig, err)
+	}
+	if ctx.ConfigFile != "" && ctx.Debug > 0 {
+		Printf("applied %d settings from config file %s\n", len(ctx.fileFlags), ctx.ConfigFile)
+	}
+	logSinks := ""
+	if FlagConfigured(ctx, "log-sinks") {
+		logSinks = *flagLogSinks
+	}
+	if ctx.EnvSet("LOG_SINKS") {
+		logSinks = ctx.Env("LOG_SINKS")
+	}
+	ctx.LogSinks = []string{}
+	for _, sink := range strings.Split(logSinks, ",") {
+		sink = strings.TrimSpace(sink)
+		if sink != "" {
+			ctx.LogSinks = append(ctx.LogSinks, sink)
+		}
+	}
+	if FlagConfigured(ctx, "log-file") && *flagLogFile != "" {
+		ctx.LogFile = *flagLogFile
+	}
+	if ctx.EnvSet("LOG_FILE") {
+		ctx.LogFile = ctx.Env("LOG_FILE")
+	}
+	ctx.LogFileMaxSize = DefaultLogFileMaxSize
+	if FlagConfigured(ctx, "log-file-max-size") && *flagLogFileMaxSize > 0 {
+		ctx.LogFileMaxSize = *flagLogFileMaxSize
+	}
+	if ctx.EnvSet("LOG_FILE_MAX_SIZE") {
+		maxSize, err := strconv.Atoi(ctx.Env("LOG_FILE_MAX_SIZE"))
+		if err != nil {
+			return configError(ctx.DSEnv+"LOG_FILE_MAX_SIZE", err)
+		}
+		if maxSize > 0 {
+			ctx.LogFileMaxSize = maxSize
+		}
+	}
+	ctx.LogFileBackups = DefaultLogFileBackups
+	if FlagConfigured(ctx, "log-file-backups") && *flagLogFileBackups >= 0 {
+		ctx.LogFileBackups = *flagLogFileBackups
+	}
+	if ctx.EnvSet("LOG_FILE_BACKUPS") {
+		backups, err := strconv.Atoi(ctx.Env("LOG_FILE_BACKUPS"))
+		if err != nil {
+			return configError(ctx.DSEnv+"LOG_FILE_BACKUPS", err)
+		}
+		if backups >= 0 {
+			ctx.LogFileBackups = backups
+		}
+	}
+	if FlagConfigured(ctx, "log-bucket") && *flagLogBucket != "" {
+		ctx.LogBucket = *flagLogBucket
+	}
+	if ctx.EnvSet("LOG_BUCKET") {
+		ctx.LogBucket = ctx.Env("LOG_BUCKET")
+	}
+	if FlagConfigured(ctx, "log-region") && *flagLogRegion != "" {
+		ctx.LogRegion = *flagLogRegion
+	}
+	if ctx.EnvSet("LOG_REGION") {
+		ctx.LogRegion = ctx.Env("LOG_REGION")
+	}
+	err = InitLogSinks(ctx)
+	if err != nil {
+		return libErrs.Wrap(libErrs.ErrConfig, err)
+	}
+
 	// Retry
-	if FlagPassed(ctx, "retry") && *flagRetry >= 0 {
+	if FlagConfigured(ctx, "retry") && *flagRetry >= 0 {
 		ctx.Retry = *flagRetry
 	}
-	if !FlagPassed(ctx, "retry") {
+	if !FlagConfigured(ctx, "retry") {
 		if !ctx.EnvSet("RETRY") {
 			ctx.Retry = 5
 		} else {
 			retry, err := strconv.Atoi(ctx.Env("RETRY"))
-			FatalOnError(err)
+			if err != nil {
+				return configError(ctx.DSEnv+"RETRY", err)
+			}
 			ctx.Retry = retry
 		}
 	} else {
@@ -130,7 +385,7 @@ func (ctx *Ctx) Init() {
 	}
 
 	// Threading
-	if FlagPassed(ctx, "st") {
+	if FlagConfigured(ctx, "st") {
 		ctx.ST = *flagST
 	}
 	st, present := ctx.BoolEnvSet("ST")
@@ -138,12 +393,14 @@ func (ctx *Ctx) Init() {
 		ctx.ST = st
 	}
 	// NCPUs
-	if FlagPassed(ctx, "ncpus") && *flagNCPUs >= 0 {
+	if FlagConfigured(ctx, "ncpus") && *flagNCPUs >= 0 {
 		ctx.NCPUs = *flagNCPUs
 	}
 	if ctx.EnvSet("NCPUS") {
 		nCPUs, err := strconv.Atoi(ctx.Env("NCPUS"))
-		FatalOnError(err)
+		if err != nil {
+			return configError(ctx.DSEnv+"NCPUS", err)
+		}
 		if nCPUs > 0 {
 			ctx.NCPUs = nCPUs
 			if ctx.NCPUs == 1 {
@@ -157,12 +414,14 @@ func (ctx *Ctx) Init() {
 
 	// NCPUs scale
 	ctx.NCPUsScale = 1.0
-	if FlagPassed(ctx, "ncpus-scale") && *flagNCPUsScale > 0.0 {
+	if FlagConfigured(ctx, "ncpus-scale") && *flagNCPUsScale > 0.0 {
 		ctx.NCPUsScale = *flagNCPUsScale
 	}
 	if ctx.EnvSet("NCPUS_SCALE") {
 		nCPUsScale, err := strconv.ParseFloat(ctx.Env("NCPUS_SCALE"), 64)
-		FatalOnError(err)
+		if err != nil {
+			return configError(ctx.DSEnv+"NCPUS_SCALE", err)
+		}
 		if nCPUsScale > 0.0 {
 			ctx.NCPUsScale = nCPUsScale
 		}
@@ -170,7 +429,7 @@ func (ctx *Ctx) Init() {
 
 	// Tags
 	tags := map[string]interface{}{}
-	if FlagPassed(ctx, "tags") {
+	if FlagConfigured(ctx, "tags") {
 		ary := strings.Split(*flagTags, ",")
 		for _, tag := range ary {
 			tag := strings.TrimSpace(tag)
@@ -191,7 +450,7 @@ func (ctx *Ctx) Init() {
 	}
 
 	// Dry run
-	if FlagPassed(ctx, "dry-run") {
+	if FlagConfigured(ctx, "dry-run") {
 		ctx.DryRun = *flagDryRun
 	}
 	dryRun, present := ctx.BoolEnvSet("DRY_RUN")
@@ -200,7 +459,7 @@ func (ctx *Ctx) Init() {
 	}
 
 	// Project
-	if FlagPassed(ctx, "project") && *flagProject != "" {
+	if FlagConfigured(ctx, "project") && *flagProject != "" {
 		ctx.Project = *flagProject
 	}
 	if ctx.EnvSet("PROJECT") {
@@ -208,7 +467,7 @@ func (ctx *Ctx) Init() {
 	}
 
 	// ProjectFilter
-	if FlagPassed(ctx, "project-filter") {
+	if FlagConfigured(ctx, "project-filter") {
 		ctx.ProjectFilter = *flagProjectFilter
 	}
 	projectFilter, present := ctx.BoolEnvSet("PROJECT_FILTER")
@@ -218,7 +477,7 @@ func (ctx *Ctx) Init() {
 
 	// Categories
 	cats := ""
-	if FlagPassed(ctx, "categories") && *flagCategories != "" {
+	if FlagConfigured(ctx, "categories") && *flagCategories != "" {
 		cats = *flagCategories
 	}
 	if ctx.EnvSet("CATEGORIES") {
@@ -238,7 +497,7 @@ func (ctx *Ctx) Init() {
 	}
 
 	// ES URL
-	if FlagPassed(ctx, "es-url") && *flagESURL != "" {
+	if FlagConfigured(ctx, "es-url") && *flagESURL != "" {
 		ctx.ESURL = *flagESURL
 	}
 	if ctx.EnvSet("ES_URL") {
@@ -249,7 +508,7 @@ func (ctx *Ctx) Init() {
 	}
 
 	// No cache
-	if FlagPassed(ctx, "no-cache") {
+	if FlagConfigured(ctx, "no-cache") {
 		ctx.NoCache = *flagNoCache
 	}
 	noCache, present := ctx.BoolEnvSet("NO_CACHE")
@@ -257,8 +516,59 @@ func (ctx *Ctx) Init() {
 		ctx.NoCache = noCache
 	}
 
+	// Cache backend
+	if FlagConfigured(ctx, "cache-backend") && *flagCacheBackend != "" {
+		ctx.CacheBackend = *flagCacheBackend
+	}
+	if ctx.EnvSet("CACHE_BACKEND") {
+		ctx.CacheBackend = ctx.Env("CACHE_BACKEND")
+	}
+	if FlagConfigured(ctx, "cache-dir") && *flagCacheDir != "" {
+		ctx.CacheDir = *flagCacheDir
+	}
+	if ctx.EnvSet("CACHE_DIR") {
+		ctx.CacheDir = ctx.Env("CACHE_DIR")
+	}
+	if FlagConfigured(ctx, "cache-bucket") && *flagCacheBucket != "" {
+		ctx.CacheBucket = *flagCacheBucket
+	}
+	if ctx.EnvSet("CACHE_BUCKET") {
+		ctx.CacheBucket = ctx.Env("CACHE_BUCKET")
+	}
+	if FlagConfigured(ctx, "cache-region") && *flagCacheRegion != "" {
+		ctx.CacheRegion = *flagCacheRegion
+	}
+	if ctx.EnvSet("CACHE_REGION") {
+		ctx.CacheRegion = ctx.Env("CACHE_REGION")
+	}
+	if FlagConfigured(ctx, "cache-compression") && *flagCacheCompression != "" {
+		ctx.CacheCompression = *flagCacheCompression
+	}
+	if ctx.EnvSet("CACHE_COMPRESSION") {
+		ctx.CacheCompression = ctx.Env("CACHE_COMPRESSION")
+	}
+	err = CheckCacheCompression(ctx.CacheCompression)
+	if err != nil {
+		return libErrs.Wrap(libErrs.ErrConfig, err)
+	}
+	ctx.CacheRevalidateFor = DefaultCacheRevalidateFor
+	if FlagConfigured(ctx, "cache-revalidate-for") && *flagCacheRevalidateFor != "" {
+		revalidateFor, err := time.ParseDuration(*flagCacheRevalidateFor)
+		if err != nil {
+			return configError("--"+ctx.DSFlag+"cache-revalidate-for", err)
+		}
+		ctx.CacheRevalidateFor = revalidateFor
+	}
+	if ctx.EnvSet("CACHE_REVALIDATE_FOR") {
+		revalidateFor, err := time.ParseDuration(ctx.Env("CACHE_REVALIDATE_FOR"))
+		if err != nil {
+			return configError(ctx.DSEnv+"CACHE_REVALIDATE_FOR", err)
+		}
+		ctx.CacheRevalidateFor = revalidateFor
+	}
+
 	// No incremental sync
-	if FlagPassed(ctx, "no-incremental") {
+	if FlagConfigured(ctx, "no-incremental") {
 		ctx.NoIncremental = *flagNoIncremental
 	}
 	noIncremental, present := ctx.BoolEnvSet("NO_INCREMENTAL")
@@ -266,40 +576,259 @@ func (ctx *Ctx) Init() {
 		ctx.NoIncremental = noIncremental
 	}
 
+	// Rate limits
+	if FlagConfigured(ctx, "rate-limit-header") && *flagRateLimitHeader != "" {
+		ctx.RateLimitHeader = *flagRateLimitHeader
+	}
+	if ctx.EnvSet("RATE_LIMIT_HEADER") {
+		ctx.RateLimitHeader = ctx.Env("RATE_LIMIT_HEADER")
+	}
+	if FlagConfigured(ctx, "rate-limit-reset-header") && *flagRateLimitResetHeader != "" {
+		ctx.RateLimitResetHeader = *flagRateLimitResetHeader
+	}
+	if ctx.EnvSet("RATE_LIMIT_RESET_HEADER") {
+		ctx.RateLimitResetHeader = ctx.Env("RATE_LIMIT_RESET_HEADER")
+	}
+	if FlagConfigured(ctx, "min-rate-limit") && *flagMinRateLimit >= 0 {
+		ctx.MinRateLimit = *flagMinRateLimit
+	}
+	if ctx.EnvSet("MIN_RATE_LIMIT") {
+		minRateLimit, err := strconv.Atoi(ctx.Env("MIN_RATE_LIMIT"))
+		if err != nil {
+			return configError(ctx.DSEnv+"MIN_RATE_LIMIT", err)
+		}
+		if minRateLimit >= 0 {
+			ctx.MinRateLimit = minRateLimit
+		}
+	}
+
+	// HTTP transport
+	if FlagConfigured(ctx, "http-timeout") && *flagHTTPTimeout != "" {
+		httpTimeout, err := time.ParseDuration(*flagHTTPTimeout)
+		if err != nil {
+			return configError("--"+ctx.DSFlag+"http-timeout", err)
+		}
+		ctx.HTTPTimeout = httpTimeout
+	}
+	if ctx.EnvSet("HTTP_TIMEOUT") {
+		httpTimeout, err := time.ParseDuration(ctx.Env("HTTP_TIMEOUT"))
+		if err != nil {
+			return configError(ctx.DSEnv+"HTTP_TIMEOUT", err)
+		}
+		ctx.HTTPTimeout = httpTimeout
+	}
+	if FlagConfigured(ctx, "http-connect-timeout") && *flagHTTPConnectTimeout != "" {
+		httpConnectTimeout, err := time.ParseDuration(*flagHTTPConnectTimeout)
+		if err != nil {
+			return configError("--"+ctx.DSFlag+"http-connect-timeout", err)
+		}
+		ctx.HTTPConnectTimeout = httpConnectTimeout
+	}
+	if ctx.EnvSet("HTTP_CONNECT_TIMEOUT") {
+		httpConnectTimeout, err := time.ParseDuration(ctx.Env("HTTP_CONNECT_TIMEOUT"))
+		if err != nil {
+			return configError(ctx.DSEnv+"HTTP_CONNECT_TIMEOUT", err)
+		}
+		ctx.HTTPConnectTimeout = httpConnectTimeout
+	}
+	if FlagConfigured(ctx, "http-proxy") && *flagHTTPProxy != "" {
+		ctx.HTTPProxy = *flagHTTPProxy
+	}
+	if ctx.EnvSet("HTTP_PROXY") {
+		ctx.HTTPProxy = ctx.Env("HTTP_PROXY")
+	}
+	if FlagConfigured(ctx, "http-ca-bundle") && *flagHTTPCABundle != "" {
+		ctx.HTTPCABundle = *flagHTTPCABundle
+	}
+	if ctx.EnvSet("HTTP_CA_BUNDLE") {
+		ctx.HTTPCABundle = ctx.Env("HTTP_CA_BUNDLE")
+	}
+	if FlagConfigured(ctx, "http-client-cert") && *flagHTTPClientCert != "" {
+		ctx.HTTPClientCert = *flagHTTPClientCert
+	}
+	if ctx.EnvSet("HTTP_CLIENT_CERT") {
+		ctx.HTTPClientCert = ctx.Env("HTTP_CLIENT_CERT")
+	}
+	if FlagConfigured(ctx, "http-client-key") && *flagHTTPClientKey != "" {
+		ctx.HTTPClientKey = *flagHTTPClientKey
+	}
+	if ctx.EnvSet("HTTP_CLIENT_KEY") {
+		ctx.HTTPClientKey = ctx.Env("HTTP_CLIENT_KEY")
+	}
+	if FlagConfigured(ctx, "http-max-idle-conns-per-host") && *flagHTTPMaxIdleConnsPerHost > 0 {
+		ctx.HTTPMaxIdleConnsPerHost = *flagHTTPMaxIdleConnsPerHost
+	}
+	if ctx.EnvSet("HTTP_MAX_IDLE_CONNS_PER_HOST") {
+		maxIdleConnsPerHost, err := strconv.Atoi(ctx.Env("HTTP_MAX_IDLE_CONNS_PER_HOST"))
+		if err != nil {
+			return configError(ctx.DSEnv+"HTTP_MAX_IDLE_CONNS_PER_HOST", err)
+		}
+		if maxIdleConnsPerHost > 0 {
+			ctx.HTTPMaxIdleConnsPerHost = maxIdleConnsPerHost
+		}
+	}
+	if FlagConfigured(ctx, "http-max-conns-per-host") && *flagHTTPMaxConnsPerHost > 0 {
+		ctx.HTTPMaxConnsPerHost = *flagHTTPMaxConnsPerHost
+	}
+	if ctx.EnvSet("HTTP_MAX_CONNS_PER_HOST") {
+		maxConnsPerHost, err := strconv.Atoi(ctx.Env("HTTP_MAX_CONNS_PER_HOST"))
+		if err != nil {
+			return configError(ctx.DSEnv+"HTTP_MAX_CONNS_PER_HOST", err)
+		}
+		if maxConnsPerHost > 0 {
+			ctx.HTTPMaxConnsPerHost = maxConnsPerHost
+		}
+	}
+	if FlagConfigured(ctx, "no-ssl-verify") {
+		ctx.HTTPNoSSLVerify = *flagHTTPNoSSLVerify
+	}
+	noSSLVerify, present := ctx.BoolEnvSet("NO_SSL_VERIFY")
+	if present {
+		ctx.HTTPNoSSLVerify = noSSLVerify
+	}
+	insecureHosts := map[string]struct{}{}
+	if FlagConfigured(ctx, "insecure-hosts") {
+		for _, host := range strings.Split(*flagHTTPInsecureHosts, ",") {
+			host := strings.TrimSpace(host)
+			if host != "" {
+				insecureHosts[host] = struct{}{}
+			}
+		}
+	}
+	for _, host := range strings.Split(ctx.Env("INSECURE_HOSTS"), ",") {
+		host := strings.TrimSpace(host)
+		if host != "" {
+			insecureHosts[host] = struct{}{}
+		}
+	}
+	for host := range insecureHosts {
+		ctx.HTTPInsecureHosts = append(ctx.HTTPInsecureHosts, host)
+	}
+	err = InitTransport(ctx)
+	if err != nil {
+		return libErrs.Wrap(libErrs.ErrConfig, err)
+	}
+
+	// Circuit breaker & concurrency limiter
+	ctx.BreakerThreshold = libHttp.DefaultBreakerThreshold
+	if FlagConfigured(ctx, "circuit-breaker-threshold") && *flagBreakerThreshold >= 0 {
+		ctx.BreakerThreshold = *flagBreakerThreshold
+	}
+	if ctx.EnvSet("CIRCUIT_BREAKER_THRESHOLD") {
+		breakerThreshold, err := strconv.Atoi(ctx.Env("CIRCUIT_BREAKER_THRESHOLD"))
+		if err != nil {
+			return configError(ctx.DSEnv+"CIRCUIT_BREAKER_THRESHOLD", err)
+		}
+		if breakerThreshold >= 0 {
+			ctx.BreakerThreshold = breakerThreshold
+		}
+	}
+	ctx.BreakerTimeout = libHttp.DefaultBreakerTimeout
+	if FlagConfigured(ctx, "circuit-breaker-timeout") && *flagBreakerTimeout != "" {
+		breakerTimeout, err := time.ParseDuration(*flagBreakerTimeout)
+		if err != nil {
+			return configError("--"+ctx.DSFlag+"circuit-breaker-timeout", err)
+		}
+		ctx.BreakerTimeout = breakerTimeout
+	}
+	if ctx.EnvSet("CIRCUIT_BREAKER_TIMEOUT") {
+		breakerTimeout, err := time.ParseDuration(ctx.Env("CIRCUIT_BREAKER_TIMEOUT"))
+		if err != nil {
+			return configError(ctx.DSEnv+"CIRCUIT_BREAKER_TIMEOUT", err)
+		}
+		ctx.BreakerTimeout = breakerTimeout
+	}
+	if FlagConfigured(ctx, "max-in-flight") && *flagMaxInFlight >= 0 {
+		ctx.MaxInFlight = *flagMaxInFlight
+	}
+	if ctx.EnvSet("MAX_IN_FLIGHT") {
+		maxInFlight, err := strconv.Atoi(ctx.Env("MAX_IN_FLIGHT"))
+		if err != nil {
+			return configError(ctx.DSEnv+"MAX_IN_FLIGHT", err)
+		}
+		if maxInFlight >= 0 {
+			ctx.MaxInFlight = maxInFlight
+		}
+	}
+	InitBreaker(ctx)
+
+	// HTTP record/replay
+	if FlagConfigured(ctx, "http-record") && *flagHTTPRecord != "" {
+		ctx.HTTPRecord = *flagHTTPRecord
+	}
+	if ctx.EnvSet("HTTP_RECORD") {
+		ctx.HTTPRecord = ctx.Env("HTTP_RECORD")
+	}
+	if FlagConfigured(ctx, "http-replay") && *flagHTTPReplay != "" {
+		ctx.HTTPReplay = *flagHTTPReplay
+	}
+	if ctx.EnvSet("HTTP_REPLAY") {
+		ctx.HTTPReplay = ctx.Env("HTTP_REPLAY")
+	}
+	err = InitCassette(ctx)
+	if err != nil {
+		return libErrs.Wrap(libErrs.ErrConfig, err)
+	}
+
 	// Events pack size
 	ctx.PackSize = DefaultPackSize
-	if FlagPassed(ctx, "pack-size") && *flagPackSize > 0 {
+	if FlagConfigured(ctx, "pack-size") && *flagPackSize > 0 {
 		ctx.PackSize = *flagPackSize
 	}
 	if ctx.EnvSet("PACK_SIZE") {
 		packSize, err := strconv.Atoi(ctx.Env("PACK_SIZE"))
-		FatalOnError(err)
+		if err != nil {
+			return configError(ctx.DSEnv+"PACK_SIZE", err)
+		}
 		if packSize > 0 {
 			ctx.PackSize = packSize
 		}
 	}
 
 	// Date from/to (optional)
-	if FlagPassed(ctx, "date-from") {
+	if FlagConfigured(ctx, "date-from") {
 		t, err := TimeParseAny(*flagDateFrom)
-		FatalOnError(err)
+		if err != nil {
+			return configError("--"+ctx.DSFlag+"date-from", err)
+		}
 		ctx.DateFrom = &t
 	}
-	if FlagPassed(ctx, "date-to") {
+	if FlagConfigured(ctx, "date-to") {
 		t, err := TimeParseAny(*flagDateTo)
-		FatalOnError(err)
+		if err != nil {
+			return configError("--"+ctx.DSFlag+"date-to", err)
+		}
 		ctx.DateTo = &t
 	}
 	if ctx.EnvSet("DATE_FROM") {
 		t, err := TimeParseAny(ctx.Env("DATE_FROM"))
-		FatalOnError(err)
+		if err != nil {
+			return configError(ctx.DSEnv+"DATE_FROM", err)
+		}
 		ctx.DateFrom = &t
 	}
 	if ctx.EnvSet("DATE_TO") {
 		t, err := TimeParseAny(ctx.Env("DATE_TO"))
-		FatalOnError(err)
+		if err != nil {
+			return configError(ctx.DSEnv+"DATE_TO", err)
+		}
 		ctx.DateTo = &t
 	}
+
+	// Print configuration
+	if FlagConfigured(ctx, "print-config") {
+		ctx.PrintConfigAndExit = *flagPrintConfig
+	}
+	printConfig, present := ctx.BoolEnvSet("PRINT_CONFIG")
+	if present {
+		ctx.PrintConfigAndExit = printConfig
+	}
+	return
+}
+
+// configError - config error for invalid option value
+func configError(option string, err error) error {
+	return libErrs.Errorf(libErrs.ErrConfig, "invalid %s value: %v", option, err)
 }
 
 // Print context contents
@@ -0,0 +1,34 @@
+package ds
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInitFlagSet(t *testing.T) {
+	var testCases = []struct {
+		args      []string
+		debug     int
+		project   string
+		dsFlagSet bool
+	}{
+		{args: []string{"--flagset-ds-debug", "2", "--flagset-ds-project", "p1", "--custom", "x"}, debug: 2, project: "p1", dsFlagSet: true},
+		{args: []string{"--custom", "y"}},
+	}
+	// Both contexts use the same data source name, this would panic with global flags
+	for _, tc := range testCases {
+		var ctx Ctx
+		ctx.InitEnv("flagset ds")
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		custom := fs.String("custom", "", "data source specific flag")
+		ctx.InitFlagSet(fs, tc.args)
+		ctx.Cancel()
+		assert.Equal(t, tc.debug, ctx.Debug)
+		assert.Equal(t, tc.project, ctx.Project)
+		assert.Equal(t, tc.dsFlagSet, FlagPassed(&ctx, "debug"))
+		assert.Equal(t, tc.args[len(tc.args)-1], *custom)
+		assert.Equal(t, fs, ctx.FlagSet())
+	}
+}
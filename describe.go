@@ -0,0 +1,178 @@
+package ds
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ConfigSourceDefault - option has its default value
+	ConfigSourceDefault = "default"
+	// ConfigSourceFile - option was set in config file (--dsname-config)
+	ConfigSourceFile = "file"
+	// ConfigSourceFlag - option was passed as a command line flag
+	ConfigSourceFlag = "flag"
+	// ConfigSourceEnv - option was set via environment variable (highest priority)
+	ConfigSourceEnv = "env"
+)
+
+// SensitiveOptionWords - options having any of those words in their names (for example api-token, client-secret)
+// have their values hidden by Describe and --dsname-print-config, also when they were not registered by AddRedacted
+var SensitiveOptionWords = map[string]struct{}{
+	"apikey":      {},
+	"auth":        {},
+	"credential":  {},
+	"credentials": {},
+	"key":         {},
+	"pass":        {},
+	"passwd":      {},
+	"password":    {},
+	"secret":      {},
+	"token":       {},
+	"tokens":      {},
+}
+
+// ConfigOption - single configuration option, Value is redacted
+type ConfigOption struct {
+	Name    string `json:"name"`
+	Flag    string `json:"flag"`
+	Env     string `json:"env"`
+	Value   string `json:"value"`
+	Default string `json:"default"`
+	Source  string `json:"source"`
+	Usage   string `json:"usage,omitempty"`
+}
+
+// ConfigDescription - machine readable description of context configuration
+type ConfigDescription struct {
+	DS         string         `json:"ds"`
+	ConfigFile string         `json:"config_file,omitempty"`
+	Options    []ConfigOption `json:"options"`
+	Errors     []string       `json:"errors,omitempty"`
+}
+
+// EnvName - env variable name for a given option name (flag name without data source prefix)
+func (ctx *Ctx) EnvName(name string) string {
+	return ctx.DSEnv + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+// ConfigSource - where does the option's value come from: default, file, flag or env
+func (ctx *Ctx) ConfigSource(name string) string {
+	if _, present := os.LookupEnv(ctx.EnvName(name)); present {
+		return ConfigSourceEnv
+	}
+	if !FlagConfigured(ctx, name) {
+		return ConfigSourceDefault
+	}
+	if _, ok := ctx.fileFlags[ctx.DSFlag+name]; ok {
+		return ConfigSourceFile
+	}
+	return ConfigSourceFlag
+}
+
+// IsSensitiveOption - does option name (flag name without data source prefix) look like it holds a secret?
+func IsSensitiveOption(name string) bool {
+	for _, word := range strings.FieldsFunc(strings.ToLower(name), func(r rune) bool { return r == '-' || r == '_' || r == '.' }) {
+		if _, ok := SensitiveOptionWords[word]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// configValue - configured (not parsed) value of an option and its source
+func (ctx *Ctx) configValue(f *flag.Flag) (value, source string) {
+	name := strings.TrimPrefix(f.Name, ctx.DSFlag)
+	source = ctx.ConfigSource(name)
+	if source == ConfigSourceEnv {
+		value = os.Getenv(ctx.EnvName(name))
+		return
+	}
+	value = f.Value.String()
+	return
+}
+
+// Describe - returns redacted description of all data source options: value, source, flag and env names
+// It includes data source specific flags registered on the same flag set and validation errors
+func (ctx *Ctx) Describe() (desc ConfigDescription) {
+	desc.DS = ctx.DS
+	desc.ConfigFile = ctx.ConfigFile
+	ctx.FlagSet().VisitAll(func(f *flag.Flag) {
+		if !strings.HasPrefix(f.Name, ctx.DSFlag) {
+			return
+		}
+		name := strings.TrimPrefix(f.Name, ctx.DSFlag)
+		value, source := ctx.configValue(f)
+		value, def := FilterRedacted(value), FilterRedacted(f.DefValue)
+		// Connector's credentials may not be registered by AddRedacted yet when config is printed by Init
+		if IsSensitiveOption(name) {
+			if value != "" {
+				value = RedactedPlaceholder
+			}
+			if def != "" {
+				def = RedactedPlaceholder
+			}
+		}
+		desc.Options = append(
+			desc.Options,
+			ConfigOption{
+				Name:    name,
+				Flag:    "--" + f.Name,
+				Env:     ctx.EnvName(name),
+				Value:   value,
+				Default: def,
+				Source:  source,
+				Usage:   f.Usage,
+			},
+		)
+	})
+	for _, err := range ctx.ValidationErrors() {
+		desc.Errors = append(desc.Errors, err.Error())
+	}
+	return
+}
+
+// ValidationErrors - returns all invalid settings and combinations of settings
+func (ctx *Ctx) ValidationErrors() (errs []error) {
+	if ctx.DateFrom != nil && ctx.DateTo != nil && ctx.DateFrom.After(*ctx.DateTo) {
+		errs = append(errs, fmt.Errorf("date-from %v is after date-to %v", ToESDate(*ctx.DateFrom), ToESDate(*ctx.DateTo)))
+	}
+	if ctx.PackSize <= 0 {
+		errs = append(errs, fmt.Errorf("pack-size must be positive, got %d", ctx.PackSize))
+	} else if f := ctx.FlagSet().Lookup(ctx.DSFlag + "pack-size"); f != nil {
+		// Init silently ignores non-positive pack size and uses the default one
+		value, source := ctx.configValue(f)
+		packSize, err := strconv.Atoi(value)
+		if source != ConfigSourceDefault && (err != nil || packSize <= 0) {
+			errs = append(errs, fmt.Errorf("pack-size must be positive, got '%s' from %s", value, source))
+		}
+	}
+	if ctx.ProjectFilter && ctx.Project == "" {
+		errs = append(errs, fmt.Errorf("project-filter requires project to be set"))
+	}
+	return
+}
+
+// Validate - returns error describing all invalid settings, nil when configuration is valid
+// Connectors should call it right after Init and refuse to start on error
+func (ctx *Ctx) Validate() error {
+	errs := ctx.ValidationErrors()
+	if len(errs) == 0 {
+		return nil
+	}
+	msgs := []string{}
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Errorf("invalid %s configuration: %s", ctx.DS, strings.Join(msgs, "; "))
+}
+
+// PrintConfig - print redacted configuration description as JSON, returns false if configuration is invalid
+func (ctx *Ctx) PrintConfig() bool {
+	desc := ctx.Describe()
+	fmt.Printf("%s\n", PrettyPrint(desc))
+	return len(desc.Errors) == 0
+}
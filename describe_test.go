@@ -0,0 +1,72 @@
+package ds
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "describe")
+	assert.Nil(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "config.yaml")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("project: proj\nretry: 3\n"), 0644))
+	assert.Nil(t, os.Setenv("DESCRIBE_DS_RETRY", "7"))
+	defer func() { _ = os.Unsetenv("DESCRIBE_DS_RETRY") }()
+	var ctx Ctx
+	ctx.InitEnv("describe ds")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	// Connector's own credentials, not registered by AddRedacted
+	fs.String("describe-ds-api-token", "", "API token")
+	fs.String("describe-ds-user_password", "default-password", "password")
+	fs.String("describe-ds-monkey", "", "not a secret")
+	ctx.InitFlagSet(fs, []string{"--describe-ds-config", path, "--describe-ds-debug", "1", "--describe-ds-api-token", "clear-text-token", "--describe-ds-monkey", "banana"})
+	ctx.Cancel()
+	sources := map[string]string{}
+	for _, option := range ctx.Describe().Options {
+		sources[option.Name] = option.Source
+		switch option.Name {
+		case "api-token":
+			assert.Equal(t, RedactedPlaceholder, option.Value)
+		case "user_password":
+			assert.Equal(t, RedactedPlaceholder, option.Value)
+			assert.Equal(t, RedactedPlaceholder, option.Default)
+		case "monkey":
+			assert.Equal(t, "banana", option.Value)
+		}
+		if option.Name == "retry" {
+			assert.Equal(t, "7", option.Value)
+			assert.Equal(t, "DESCRIBE_DS_RETRY", option.Env)
+			assert.Equal(t, "--describe-ds-retry", option.Flag)
+		}
+	}
+	assert.Equal(t, ConfigSourceFile, sources["project"])
+	assert.Equal(t, ConfigSourceEnv, sources["retry"])
+	assert.Equal(t, ConfigSourceFlag, sources["debug"])
+	assert.Equal(t, ConfigSourceDefault, sources["es-url"])
+	assert.Nil(t, ctx.Validate())
+}
+
+func TestValidate(t *testing.T) {
+	from := time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	var testCases = []struct {
+		ctx    Ctx
+		errors int
+	}{
+		{ctx: Ctx{PackSize: 10, Project: "p", ProjectFilter: true, DateFrom: &to, DateTo: &from}, errors: 0},
+		{ctx: Ctx{PackSize: 10, DateFrom: &from, DateTo: &to}, errors: 1},
+		{ctx: Ctx{PackSize: 0, ProjectFilter: true}, errors: 2},
+	}
+	for i, tc := range testCases {
+		tc.ctx.Flags = flag.NewFlagSet("test", flag.ContinueOnError)
+		assert.Equal(t, tc.errors, len(tc.ctx.ValidationErrors()), i)
+		assert.Equal(t, tc.errors == 0, tc.ctx.Validate() == nil, i)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"strings"
 	"time"
 
+	libErrs "github.com/LF-Engineering/insights-datasource-shared/errs"
 	libHttp "github.com/LF-Engineering/insights-datasource-shared/http"
 	"github.com/avast/retry-go"
 	"github.com/elastic/go-elasticsearch/v8"
@@ -30,9 +31,24 @@ func NewClientProvider(params *Params) (*ClientProvider, error) {
 	}
 	client, err := elasticsearch.NewClient(config)
 	if err != nil {
-		return nil, err
+		return nil, libErrs.Wrap(libErrs.ErrConfig, err)
 	}
-	return &ClientProvider{client, params}, err
+	return &ClientProvider{client: client, params: params}, err
+}
+
+// WithContext returns a copy of the provider whose requests, retries and backoff delays are cancelled with ctx
+func (p *ClientProvider) WithContext(ctx context.Context) *ClientProvider {
+	cp := *p
+	cp.ctx = ctx
+	return &cp
+}
+
+// context returns the provider's context, context.Background() if not set
+func (p *ClientProvider) context() context.Context {
+	if p.ctx == nil {
+		return context.Background()
+	}
+	return p.ctx
 }
 
 // CheckIfIndexExists checks if an es index exists and returns a bool depending on whether it exists or not.
@@ -47,7 +63,7 @@ func (p *ClientProvider) CheckIfIndexExists(index string) (bool, error) {
 
 	_, err := p.Search(index, query)
 	if err != nil {
-		if err.Error() == "index doesn't exist" {
+		if libErrs.IsNotFound(err) {
 			return false, nil
 		}
 		return false, errs.Wrap(err, "[CheckIfIndexExists] invalid request")
@@ -65,9 +81,9 @@ func (p *ClientProvider) CreateIndex(index string, body []byte) ([]byte, error)
 	res, err := esapi.IndicesCreateRequest{
 		Index: index,
 		Body:  buf,
-	}.Do(context.Background(), p.client)
+	}.Do(p.context(), p.client)
 	if err != nil {
-		return nil, err
+		return nil, libErrs.Classify(err)
 	}
 	defer func() {
 		if err := res.Body.Close(); err != nil {
@@ -77,7 +93,7 @@ func (p *ClientProvider) CreateIndex(index string, body []byte) ([]byte, error)
 
 	resBytes, err := toBytes(res)
 	if err != nil {
-		return nil, err
+		return nil, libErrs.Classify(err)
 	}
 
 	return resBytes, nil
@@ -88,9 +104,9 @@ func (p *ClientProvider) DeleteIndex(index string, ignoreUnavailable bool) ([]by
 	res, err := esapi.IndicesDeleteRequest{
 		Index:             []string{index},
 		IgnoreUnavailable: &ignoreUnavailable,
-	}.Do(context.Background(), p.client)
+	}.Do(p.context(), p.client)
 	if err != nil {
-		return nil, err
+		return nil, libErrs.Classify(err)
 	}
 	defer func() {
 		if err := res.Body.Close(); err != nil {
@@ -100,7 +116,7 @@ func (p *ClientProvider) DeleteIndex(index string, ignoreUnavailable bool) ([]by
 
 	body, err := toBytes(res)
 	if err != nil {
-		return nil, err
+		return nil, libErrs.Classify(err)
 	}
 
 	if res.StatusCode == 200 {
@@ -111,11 +127,11 @@ func (p *ClientProvider) DeleteIndex(index string, ignoreUnavailable bool) ([]by
 
 		var e map[string]interface{}
 		if err = jsoniter.NewDecoder(res.Body).Decode(&e); err != nil {
-			return nil, err
+			return nil, libErrs.Classify(err)
 		}
 
-		err = fmt.Errorf("[%s] %s: %s", res.Status(), e["error"].(map[string]interface{})["type"], e["error"].(map[string]interface{})["reason"])
-		return nil, err
+		err = libErrs.HTTPError(res.StatusCode, fmt.Errorf("[%s] %s: %s", res.Status(), e["error"].(map[string]interface{})["type"], e["error"].(map[string]interface{})["reason"]))
+		return nil, libErrs.Classify(err)
 	}
 
 	return body, nil
@@ -126,15 +142,16 @@ func (p *ClientProvider) DeleteDocumentByQuery(index string, query map[string]in
 	var buf bytes.Buffer
 	err := json.NewEncoder(&buf).Encode(query)
 	if err != nil {
-		return nil, err
+		return nil, libErrs.Classify(err)
 	}
 
 	res, err := p.client.DeleteByQuery(
 		[]string{index},
-		&buf)
+		&buf,
+		p.client.DeleteByQuery.WithContext(p.context()))
 
 	if err != nil {
-		return nil, err
+		return nil, libErrs.Classify(err)
 	}
 
 	defer func() {
@@ -145,7 +162,7 @@ func (p *ClientProvider) DeleteDocumentByQuery(index string, query map[string]in
 
 	resBytes, err := toBytes(res)
 	if err != nil {
-		return nil, err
+		return nil, libErrs.Classify(err)
 	}
 
 	return resBytes, nil
@@ -155,7 +172,7 @@ func (p *ClientProvider) DeleteDocumentByQuery(index string, query map[string]in
 func toBytes(res *esapi.Response) ([]byte, error) {
 	var resBuf bytes.Buffer
 	if _, err := resBuf.ReadFrom(res.Body); err != nil {
-		return nil, err
+		return nil, libErrs.Classify(err)
 	}
 	resBytes := resBuf.Bytes()
 	return resBytes, nil
@@ -171,9 +188,9 @@ func (p *ClientProvider) Add(index string, documentID string, body []byte) ([]by
 		Body:       buf,
 	}
 
-	res, err := req.Do(context.Background(), p.client)
+	res, err := req.Do(p.context(), p.client)
 	if err != nil {
-		return nil, err
+		return nil, libErrs.Classify(err)
 	}
 	defer func() {
 		if err := res.Body.Close(); err != nil {
@@ -183,7 +200,7 @@ func (p *ClientProvider) Add(index string, documentID string, body []byte) ([]by
 
 	resBytes, err := toBytes(res)
 	if err != nil {
-		return nil, err
+		return nil, libErrs.Classify(err)
 	}
 
 	if res.StatusCode == 200 {
@@ -194,11 +211,11 @@ func (p *ClientProvider) Add(index string, documentID string, body []byte) ([]by
 
 		var e map[string]interface{}
 		if err = jsoniter.NewDecoder(res.Body).Decode(&e); err != nil {
-			return nil, err
+			return nil, libErrs.Classify(err)
 		}
 
-		err = fmt.Errorf("[%s] %s: %s", res.Status(), e["error"].(map[string]interface{})["type"], e["error"].(map[string]interface{})["reason"])
-		return nil, err
+		err = libErrs.HTTPError(res.StatusCode, fmt.Errorf("[%s] %s: %s", res.Status(), e["error"].(map[string]interface{})["type"], e["error"].(map[string]interface{})["reason"]))
+		return nil, libErrs.Classify(err)
 	}
 
 	return resBytes, nil
@@ -212,20 +229,20 @@ func (p *ClientProvider) Bulk(body []byte) ([]byte, error) {
 		Body: buf,
 	}
 
-	res, err := req.Do(context.Background(), p.client)
+	res, err := req.Do(p.context(), p.client)
 	if err != nil {
 		log.Printf("ReqErr: %s", err.Error())
-		return nil, err
+		return nil, libErrs.Classify(err)
 	}
 
 	if res.IsError() {
 		var e map[string]interface{}
 		if err = jsoniter.NewDecoder(res.Body).Decode(&e); err != nil {
-			return nil, err
+			return nil, libErrs.Classify(err)
 		}
 
-		err = fmt.Errorf("[%s] %s: %s", res.Status(), e["error"].(map[string]interface{})["type"], e["error"].(map[string]interface{})["reason"])
-		return nil, err
+		err = libErrs.HTTPError(res.StatusCode, fmt.Errorf("[%s] %s: %s", res.Status(), e["error"].(map[string]interface{})["type"], e["error"].(map[string]interface{})["reason"]))
+		return nil, libErrs.Classify(err)
 	}
 
 	defer func() {
@@ -236,7 +253,7 @@ func (p *ClientProvider) Bulk(body []byte) ([]byte, error) {
 
 	resBytes, err := toBytes(res)
 	if err != nil {
-		return nil, err
+		return nil, libErrs.Classify(err)
 	}
 
 	if res.StatusCode == 200 {
@@ -244,18 +261,18 @@ func (p *ClientProvider) Bulk(body []byte) ([]byte, error) {
 	}
 
 	if res.StatusCode == 413 {
-		return nil, errors.New("payload too large. decrease documents to <= 1000")
+		return nil, libErrs.HTTPError(res.StatusCode, errors.New("payload too large. decrease documents to <= 1000"))
 	}
 
 	if res.IsError() {
 
 		var e map[string]interface{}
 		if err = json.NewDecoder(res.Body).Decode(&e); err != nil {
-			return nil, err
+			return nil, libErrs.Classify(err)
 		}
 
-		err = fmt.Errorf("[%s] %s: %s", res.Status(), e["error"].(map[string]interface{})["type"], e["error"].(map[string]interface{})["reason"])
-		return nil, err
+		err = libErrs.HTTPError(res.StatusCode, fmt.Errorf("[%s] %s: %s", res.Status(), e["error"].(map[string]interface{})["type"], e["error"].(map[string]interface{})["reason"]))
+		return nil, libErrs.Classify(err)
 	}
 
 	return resBytes, nil
@@ -281,7 +298,7 @@ func (p *ClientProvider) BulkInsert(data []BulkData) ([]byte, error) {
 
 	body, err := json.Marshal(lines)
 	if err != nil {
-		return nil, errors.New("unable to convert body to json")
+		return nil, libErrs.Errorf(libErrs.ErrPermanent, "unable to convert body to json")
 	}
 
 	var re = regexp.MustCompile(`(}),"\\n",?`)
@@ -289,7 +306,7 @@ func (p *ClientProvider) BulkInsert(data []BulkData) ([]byte, error) {
 
 	resData, err := p.Bulk(body)
 	if err != nil {
-		return nil, err
+		return nil, libErrs.Classify(err)
 	}
 
 	return resData, nil
@@ -315,7 +332,7 @@ func (p *ClientProvider) BulkUpdate(data []BulkData) ([]byte, error) {
 
 	body, err := json.Marshal(lines)
 	if err != nil {
-		return nil, errors.New("unable to convert body to json")
+		return nil, libErrs.Errorf(libErrs.ErrPermanent, "unable to convert body to json")
 	}
 
 	var re = regexp.MustCompile(`(}),"\\n",?`)
@@ -323,7 +340,7 @@ func (p *ClientProvider) BulkUpdate(data []BulkData) ([]byte, error) {
 
 	resData, err := p.Bulk(body)
 	if err != nil {
-		return nil, err
+		return nil, libErrs.Classify(err)
 	}
 
 	return resData, nil
@@ -347,7 +364,7 @@ func (p *ClientProvider) BulkDelete(data []BulkData) ([]byte, error) {
 
 	body, err := json.Marshal(lines)
 	if err != nil {
-		return nil, errors.New("unable to convert body to json")
+		return nil, libErrs.Errorf(libErrs.ErrPermanent, "unable to convert body to json")
 	}
 
 	var re = regexp.MustCompile(`(}),"\\n",?`)
@@ -355,7 +372,7 @@ func (p *ClientProvider) BulkDelete(data []BulkData) ([]byte, error) {
 
 	resData, err := p.Bulk(body)
 	if err != nil {
-		return nil, err
+		return nil, libErrs.Classify(err)
 	}
 
 	return resData, nil
@@ -366,15 +383,16 @@ func (p *ClientProvider) Get(index string, query map[string]interface{}, result
 	var buf bytes.Buffer
 	err = json.NewEncoder(&buf).Encode(query)
 	if err != nil {
-		return err
+		return libErrs.Classify(err)
 	}
 
 	res, err := p.client.Search(
+		p.client.Search.WithContext(p.context()),
 		p.client.Search.WithIndex(index),
 		p.client.Search.WithBody(&buf),
 	)
 	if err != nil {
-		return err
+		return libErrs.Classify(err)
 	}
 
 	defer func() {
@@ -386,7 +404,7 @@ func (p *ClientProvider) Get(index string, query map[string]interface{}, result
 	if res.StatusCode == 200 {
 		// index exists so return true
 		if err = json.NewDecoder(res.Body).Decode(result); err != nil {
-			return err
+			return libErrs.Classify(err)
 		}
 
 		return nil
@@ -395,16 +413,16 @@ func (p *ClientProvider) Get(index string, query map[string]interface{}, result
 	if res.IsError() {
 		if res.StatusCode == 404 {
 			// index doesn't exist
-			return errors.New("index doesn't exist")
+			return libErrs.Errorf(libErrs.ErrNotFound, "index doesn't exist")
 		}
 
 		var e map[string]interface{}
 		if err = json.NewDecoder(res.Body).Decode(&e); err != nil {
-			return err
+			return libErrs.Classify(err)
 		}
 
-		err = fmt.Errorf("[%s] %s: %s", res.Status(), e["error"].(map[string]interface{})["type"], e["error"].(map[string]interface{})["reason"])
-		return err
+		err = libErrs.HTTPError(res.StatusCode, fmt.Errorf("[%s] %s: %s", res.Status(), e["error"].(map[string]interface{})["type"], e["error"].(map[string]interface{})["reason"]))
+		return libErrs.Classify(err)
 	}
 
 	return nil
@@ -417,17 +435,33 @@ func (p *ClientProvider) BackOffGet(index string, query map[string]interface{},
 		d := delay * time.Duration(i)
 		err = p.Get(index, query, result)
 		if err != nil {
-			time.Sleep(d)
+			if e := p.sleep(d); e != nil {
+				return e
+			}
 			continue
 		}
 		res, ok := result.(TopHitsStruct)
 		if !ok || len(res.Hits.Hits) == 0 {
-			time.Sleep(d)
+			if e := p.sleep(d); e != nil {
+				return e
+			}
 			continue
 		}
 	}
 
-	return err
+	return libErrs.Classify(err)
+}
+
+// sleep waits for d or until the provider's context is cancelled
+func (p *ClientProvider) sleep(d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-p.context().Done():
+		return p.context().Err()
+	}
 }
 
 // GetStat gets statistics ex. max min, avg
@@ -458,11 +492,11 @@ func (p *ClientProvider) GetStat(index string, field string, aggType string, mus
 	}
 	err = p.Get(index, q, hits)
 	if err != nil {
-		return time.Now().UTC(), err
+		return time.Now().UTC(), libErrs.Classify(err)
 	}
 	date, err := time.Parse(time.RFC3339, hits.Aggregations.Stat.ValueAsString)
 	if err != nil {
-		return time.Now().UTC(), err
+		return time.Now().UTC(), libErrs.Classify(err)
 	}
 
 	return date, nil
@@ -476,12 +510,12 @@ func (p *ClientProvider) DelayOfCreateIndex(ex func(str string, b []byte) ([]byt
 
 	err := retry.Do(func() error {
 		_, err := ex(index, data)
-		return err
+		return libErrs.Classify(err)
 	}, retry.DelayType(func(n uint, err error, config *retry.Config) time.Duration {
 		return retry.BackOffDelay(n, err, config)
-	}))
+	}), retry.Context(p.context()))
 
-	return err
+	return libErrs.Classify(err)
 }
 
 // Search ...
@@ -489,15 +523,16 @@ func (p *ClientProvider) Search(index string, query map[string]interface{}) ([]b
 	var buf bytes.Buffer
 	err := json.NewEncoder(&buf).Encode(query)
 	if err != nil {
-		return nil, err
+		return nil, libErrs.Classify(err)
 	}
 
 	res, err := p.client.Search(
+		p.client.Search.WithContext(p.context()),
 		p.client.Search.WithIndex(index),
 		p.client.Search.WithBody(&buf),
 	)
 	if err != nil {
-		return nil, err
+		return nil, libErrs.Classify(err)
 	}
 
 	defer func() {
@@ -510,12 +545,12 @@ func (p *ClientProvider) Search(index string, query map[string]interface{}) ([]b
 		var in interface{}
 		// index exists so return true
 		if err = json.NewDecoder(res.Body).Decode(&in); err != nil {
-			return nil, err
+			return nil, libErrs.Classify(err)
 		}
 
 		bites, err := jsoniter.Marshal(in)
 		if err != nil {
-			return nil, err
+			return nil, libErrs.Classify(err)
 		}
 
 		return bites, nil
@@ -524,19 +559,19 @@ func (p *ClientProvider) Search(index string, query map[string]interface{}) ([]b
 	if res.IsError() {
 		if res.StatusCode == 404 {
 			// index doesn't exist
-			return nil, errors.New("index doesn't exist")
+			return nil, libErrs.Errorf(libErrs.ErrNotFound, "index doesn't exist")
 		}
 
 		var e map[string]interface{}
 		if err = json.NewDecoder(res.Body).Decode(&e); err != nil {
-			return nil, err
+			return nil, libErrs.Classify(err)
 		}
 
-		err = fmt.Errorf("[%s] %s: %s", res.Status(), e["error"].(map[string]interface{})["type"], e["error"].(map[string]interface{})["reason"])
-		return nil, err
+		err = libErrs.HTTPError(res.StatusCode, fmt.Errorf("[%s] %s: %s", res.Status(), e["error"].(map[string]interface{})["type"], e["error"].(map[string]interface{})["reason"]))
+		return nil, libErrs.Classify(err)
 	}
 
-	return nil, errors.New("search failed")
+	return nil, libErrs.HTTPError(res.StatusCode, errors.New("search failed"))
 }
 
 // SearchWithNoIndex for querying across multiple indices for example: GET _search?allow_no_indices=true
@@ -544,14 +579,15 @@ func (p *ClientProvider) SearchWithNoIndex(query map[string]interface{}) ([]byte
 	var buf bytes.Buffer
 	err := json.NewEncoder(&buf).Encode(query)
 	if err != nil {
-		return nil, err
+		return nil, libErrs.Classify(err)
 	}
 	res, err := p.client.Search(
+		p.client.Search.WithContext(p.context()),
 		p.client.Search.WithAllowNoIndices(true),
 		p.client.Search.WithBody(&buf),
 	)
 	if err != nil {
-		return nil, err
+		return nil, libErrs.Classify(err)
 	}
 
 	defer func() {
@@ -563,12 +599,12 @@ func (p *ClientProvider) SearchWithNoIndex(query map[string]interface{}) ([]byte
 	if res.StatusCode == 200 {
 		var in interface{}
 		if err = json.NewDecoder(res.Body).Decode(&in); err != nil {
-			return nil, err
+			return nil, libErrs.Classify(err)
 		}
 
 		bites, err := jsoniter.Marshal(in)
 		if err != nil {
-			return nil, err
+			return nil, libErrs.Classify(err)
 		}
 		return bites, nil
 	}
@@ -576,19 +612,19 @@ func (p *ClientProvider) SearchWithNoIndex(query map[string]interface{}) ([]byte
 	if res.IsError() {
 		if res.StatusCode == 404 {
 			// index doesn't exist
-			return nil, errors.New("index doesn't exist")
+			return nil, libErrs.Errorf(libErrs.ErrNotFound, "index doesn't exist")
 		}
 
 		var e map[string]interface{}
 		if err = json.NewDecoder(res.Body).Decode(&e); err != nil {
-			return nil, err
+			return nil, libErrs.Classify(err)
 		}
 
-		err = fmt.Errorf("[%s] %s: %s", res.Status(), e["error"].(map[string]interface{})["type"], e["error"].(map[string]interface{})["reason"])
-		return nil, err
+		err = libErrs.HTTPError(res.StatusCode, fmt.Errorf("[%s] %s: %s", res.Status(), e["error"].(map[string]interface{})["type"], e["error"].(map[string]interface{})["reason"]))
+		return nil, libErrs.Classify(err)
 	}
 
-	return nil, errors.New("search failed")
+	return nil, libErrs.HTTPError(res.StatusCode, errors.New("search failed"))
 }
 
 // CreateDocument ...
@@ -600,9 +636,9 @@ func (p *ClientProvider) CreateDocument(index, documentID string, body []byte) (
 		Index:      index,
 		DocumentID: documentID,
 		Body:       buf,
-	}.Do(context.Background(), p.client)
+	}.Do(p.context(), p.client)
 	if err != nil {
-		return nil, err
+		return nil, libErrs.Classify(err)
 	}
 	defer func() {
 		if err := res.Body.Close(); err != nil {
@@ -613,12 +649,12 @@ func (p *ClientProvider) CreateDocument(index, documentID string, body []byte) (
 	if res.StatusCode == http.StatusOK || res.StatusCode == http.StatusCreated {
 		var in interface{}
 		if err = json.NewDecoder(res.Body).Decode(&in); err != nil {
-			return nil, err
+			return nil, libErrs.Classify(err)
 		}
 
 		bites, err := jsoniter.Marshal(in)
 		if err != nil {
-			return nil, err
+			return nil, libErrs.Classify(err)
 		}
 		return bites, nil
 	}
@@ -626,19 +662,19 @@ func (p *ClientProvider) CreateDocument(index, documentID string, body []byte) (
 	if res.IsError() {
 		if res.StatusCode == 404 {
 			// index doesn't exist
-			return nil, errors.New("index doesn't exist")
+			return nil, libErrs.Errorf(libErrs.ErrNotFound, "index doesn't exist")
 		}
 
 		var e map[string]interface{}
 		if err = json.NewDecoder(res.Body).Decode(&e); err != nil {
-			return nil, err
+			return nil, libErrs.Classify(err)
 		}
 
-		err = fmt.Errorf("[%s] %s: %s", res.Status(), e["error"].(map[string]interface{})["type"], e["error"].(map[string]interface{})["reason"])
-		return nil, err
+		err = libErrs.HTTPError(res.StatusCode, fmt.Errorf("[%s] %s: %s", res.Status(), e["error"].(map[string]interface{})["type"], e["error"].(map[string]interface{})["reason"]))
+		return nil, libErrs.Classify(err)
 	}
 
-	return nil, errors.New("create document failed")
+	return nil, libErrs.HTTPError(res.StatusCode, errors.New("create document failed"))
 }
 
 // UpdateDocumentByQuery ...
@@ -646,10 +682,11 @@ func (p *ClientProvider) UpdateDocumentByQuery(index, query, fields string) ([]b
 	// update es document request
 	res, err := p.client.UpdateByQuery(
 		[]string{index},
+		p.client.UpdateByQuery.WithContext(p.context()),
 		p.client.UpdateByQuery.WithQuery(query),
 		p.client.UpdateByQuery.WithBody(strings.NewReader(fields)))
 	if err != nil {
-		return nil, err
+		return nil, libErrs.Classify(err)
 	}
 	defer func() {
 		if err := res.Body.Close(); err != nil {
@@ -659,7 +696,7 @@ func (p *ClientProvider) UpdateDocumentByQuery(index, query, fields string) ([]b
 
 	resBytes, err := toBytes(res)
 	if err != nil {
-		return nil, err
+		return nil, libErrs.Classify(err)
 	}
 
 	return resBytes, nil
@@ -679,23 +716,24 @@ func (p *ClientProvider) ReadWithScroll(index string, query map[string]interface
 		var buf bytes.Buffer
 		err = json.NewEncoder(&buf).Encode(query)
 		if err != nil {
-			return err
+			return libErrs.Classify(err)
 		}
 
 		res, err = p.client.Search(
+			p.client.Search.WithContext(p.context()),
 			p.client.Search.WithIndex(index),
 			p.client.Search.WithBody(&buf),
 			p.client.Search.WithScroll(time.Minute),
 		)
 	} else {
-		res, err = p.client.Scroll(p.client.Scroll.WithScrollID(scrollID), p.client.Scroll.WithScroll(time.Minute))
+		res, err = p.client.Scroll(p.client.Scroll.WithContext(p.context()), p.client.Scroll.WithScrollID(scrollID), p.client.Scroll.WithScroll(time.Minute))
 	}
 	if err != nil {
-		return err
+		return libErrs.Classify(err)
 	}
 	if res.StatusCode == http.StatusOK {
 		if err = json.NewDecoder(res.Body).Decode(result); err != nil {
-			return err
+			return libErrs.Classify(err)
 		}
 
 		return nil
@@ -703,16 +741,16 @@ func (p *ClientProvider) ReadWithScroll(index string, query map[string]interface
 	if res.IsError() {
 		if res.StatusCode == http.StatusNotFound {
 			// index doesn't exist
-			return errors.New("index doesn't exist")
+			return libErrs.Errorf(libErrs.ErrNotFound, "index doesn't exist")
 		}
 
 		var e map[string]interface{}
 		if err = json.NewDecoder(res.Body).Decode(&e); err != nil {
-			return err
+			return libErrs.Classify(err)
 		}
 
-		err = fmt.Errorf("[%s] %s: %s", res.Status(), e["error"].(map[string]interface{})["type"], e["error"].(map[string]interface{})["reason"])
-		return err
+		err = libErrs.HTTPError(res.StatusCode, fmt.Errorf("[%s] %s: %s", res.Status(), e["error"].(map[string]interface{})["type"], e["error"].(map[string]interface{})["reason"]))
+		return libErrs.Classify(err)
 	}
 	return nil
 }
@@ -724,7 +762,7 @@ func (p *ClientProvider) UpdateDocument(index string, id string, body interface{
 	m["doc"] = body
 	b, err := jsoniter.Marshal(m)
 	if err != nil {
-		return nil, err
+		return nil, libErrs.Classify(err)
 	}
 	buf := strings.NewReader(string(b))
 
@@ -734,9 +772,9 @@ func (p *ClientProvider) UpdateDocument(index string, id string, body interface{
 		DocumentID: id,
 		Body:       buf,
 		Refresh:    "true",
-	}.Do(context.Background(), p.client)
+	}.Do(p.context(), p.client)
 	if err != nil {
-		return nil, err
+		return nil, libErrs.Classify(err)
 	}
 	defer func() {
 		if err := res.Body.Close(); err != nil {
@@ -747,12 +785,12 @@ func (p *ClientProvider) UpdateDocument(index string, id string, body interface{
 	if res.StatusCode == http.StatusOK {
 		var in interface{}
 		if err = json.NewDecoder(res.Body).Decode(&in); err != nil {
-			return nil, err
+			return nil, libErrs.Classify(err)
 		}
 
 		bites, err := jsoniter.Marshal(in)
 		if err != nil {
-			return nil, err
+			return nil, libErrs.Classify(err)
 		}
 		return bites, nil
 	}
@@ -760,19 +798,19 @@ func (p *ClientProvider) UpdateDocument(index string, id string, body interface{
 	if res.IsError() {
 		if res.StatusCode == 404 {
 			// index doesn't exist
-			return nil, errors.New("index doesn't exist")
+			return nil, libErrs.Errorf(libErrs.ErrNotFound, "index doesn't exist")
 		}
 
 		var e map[string]interface{}
 		if err = json.NewDecoder(res.Body).Decode(&e); err != nil {
-			return nil, err
+			return nil, libErrs.Classify(err)
 		}
 
-		err = fmt.Errorf("[%s] %s: %s", res.Status(), e["error"].(map[string]interface{})["type"], e["error"].(map[string]interface{})["reason"])
-		return nil, err
+		err = libErrs.HTTPError(res.StatusCode, fmt.Errorf("[%s] %s: %s", res.Status(), e["error"].(map[string]interface{})["type"], e["error"].(map[string]interface{})["reason"]))
+		return nil, libErrs.Classify(err)
 	}
 
-	return nil, errors.New("update document failed")
+	return nil, libErrs.HTTPError(res.StatusCode, errors.New("update document failed"))
 }
 
 // GetIndices get all indices based on a specific pattern , or you can use _all to get all indices
@@ -780,9 +818,9 @@ func (p *ClientProvider) GetIndices(pattern string) ([]string, error) {
 	res, err := esapi.IndicesGetRequest{
 		Index:  []string{pattern},
 		Pretty: true,
-	}.Do(context.Background(), p.client)
+	}.Do(p.context(), p.client)
 	if err != nil {
-		return nil, err
+		return nil, libErrs.Classify(err)
 	}
 
 	defer func() {
@@ -793,13 +831,13 @@ func (p *ClientProvider) GetIndices(pattern string) ([]string, error) {
 
 	resBytes, err := toBytes(res)
 	if err != nil {
-		return nil, err
+		return nil, libErrs.Classify(err)
 	}
 
 	var ind map[string]interface{}
 	err = json.Unmarshal(resBytes, &ind)
 	if err != nil {
-		return nil, err
+		return nil, libErrs.Classify(err)
 	}
 
 	var indices []string
@@ -814,15 +852,16 @@ func (p *ClientProvider) Count(index string, query map[string]interface{}) (int,
 	var buf bytes.Buffer
 	err := json.NewEncoder(&buf).Encode(query)
 	if err != nil {
-		return 0, err
+		return 0, libErrs.Classify(err)
 	}
 
 	res, err := p.client.Count(
+		p.client.Count.WithContext(p.context()),
 		p.client.Count.WithIndex(index),
 		p.client.Count.WithBody(&buf),
 	)
 	if err != nil {
-		return 0, err
+		return 0, libErrs.Classify(err)
 	}
 
 	defer func() {
@@ -835,7 +874,7 @@ func (p *ClientProvider) Count(index string, query map[string]interface{}) (int,
 		result := make(map[string]interface{})
 		// index exists so return true
 		if err = json.NewDecoder(res.Body).Decode(&result); err != nil {
-			return 0, err
+			return 0, libErrs.Classify(err)
 		}
 
 		floatCount := result["count"].(float64)
@@ -846,16 +885,16 @@ func (p *ClientProvider) Count(index string, query map[string]interface{}) (int,
 	if res.IsError() {
 		if res.StatusCode == 404 {
 			// index doesn't exist
-			return 0, errors.New("index doesn't exist")
+			return 0, libErrs.Errorf(libErrs.ErrNotFound, "index doesn't exist")
 		}
 
 		var e map[string]interface{}
 		if err = json.NewDecoder(res.Body).Decode(&e); err != nil {
-			return 0, err
+			return 0, libErrs.Classify(err)
 		}
 
-		err = fmt.Errorf("[%s] %s: %s", res.Status(), e["error"].(map[string]interface{})["type"], e["error"].(map[string]interface{})["reason"])
-		return 0, err
+		err = libErrs.HTTPError(res.StatusCode, fmt.Errorf("[%s] %s: %s", res.Status(), e["error"].(map[string]interface{})["type"], e["error"].(map[string]interface{})["reason"]))
+		return 0, libErrs.Classify(err)
 	}
 
 	return 0, nil
@@ -866,7 +905,7 @@ func (p *ClientProvider) Count(index string, query map[string]interface{}) (int,
 func (p *ClientProvider) CreateUUID(index string) (string, error) {
 	newUUID, err := uuid.NewUUID()
 	if err != nil {
-		return "", err
+		return "", libErrs.Classify(err)
 	}
 
 	ok, err := p.CheckIfUUIDExists(index, newUUID.String())
@@ -918,7 +957,7 @@ func (p *ClientProvider) CheckIfUUIDExists(index, uuidString string) (bool, erro
 //  updateFieldName es field to update eg author_name
 //  updateValue es field value to update to eg Rob Underwood
 func (p *ClientProvider) UpdateFieldByQuery(params Params, index, matchFieldName, matchValue, updateFieldName, updateValue string) (bool, error) {
-	httpClientProvider := libHttp.NewClientProvider(time.Minute, false)
+	httpClientProvider := libHttp.NewClientProvider(time.Minute, false).WithContext(p.context())
 	url := fmt.Sprintf("https://%s:%s@%s/%s/_update_by_query", params.Username, params.Password, params.URL, index)
 
 	updateQuery := map[string]interface{}{
@@ -938,12 +977,12 @@ func (p *ClientProvider) UpdateFieldByQuery(params Params, index, matchFieldName
 
 	updateBytes, err := json.Marshal(updateQuery)
 	if err != nil {
-		return false, err
+		return false, libErrs.Classify(err)
 	}
 
 	statusCode, _, err := httpClientProvider.Request(url, http.MethodPost, nil, updateBytes, nil)
 	if statusCode == http.StatusOK {
 		return true, nil
 	}
-	return false, err
+	return false, libErrs.Classify(err)
 }
@@ -1,6 +1,8 @@
 package elastic
 
 import (
+	"context"
+
 	"github.com/elastic/go-elasticsearch/v8"
 )
 
@@ -8,6 +10,7 @@ import (
 type ClientProvider struct {
 	client *elasticsearch.Client
 	params *Params
+	ctx    context.Context
 }
 
 // Params ...
@@ -188,10 +188,17 @@ func ParseAddresses(ctx *Ctx, addrs string, maxAddrs int) (emails []*mail.Addres
 	}
 	for i, obj := range emails {
 		// remove leading/trailing ' "
-		// skip if starts with =?
+		// decode or skip if starts with =?
 		// should we allow empty name?
 		obj.Name = strings.TrimSpace(strings.Trim(obj.Name, `"'`))
 		obj.Address = strings.TrimSpace(strings.Trim(obj.Address, `"'`))
+		if strings.HasPrefix(obj.Name, "=?") {
+			// net/mail only decodes UTF-8, US-ASCII and ISO-8859-1 encoded-words
+			name, err := DecodeHeader(obj.Name)
+			if err == nil {
+				obj.Name = strings.TrimSpace(name)
+			}
+		}
 		if strings.HasPrefix(obj.Name, "=?") {
 			if ctx.Debug > 0 {
 				Printf("clearing buggy name '%s'\n", obj.Name)
@@ -8,18 +8,22 @@ import (
 )
 
 // FatalOnError displays error message (if error present) and exits program
+// Library code should return classified errors instead, see errs.Wrap (error-returning variant)
 func FatalOnError(err error) string {
 	if err != nil {
 		tm := time.Now()
 		msg := fmt.Sprintf("DA_DS_ERROR(time=%+v):\nError: '%s'\nStacktrace:\n%s\n", tm, err.Error(), string(debug.Stack()))
-		Printf("%s", msg)
-		fmt.Fprintf(os.Stderr, "%s", msg)
+		printfLevel(LogLevelError, "%s", msg)
+		fmt.Fprintf(os.Stderr, "%s", FilterRedacted(msg))
+		// Ship queued messages (including this one) before exiting
+		FlushLogs()
 		panic("stacktrace")
 	}
 	return "ok"
 }
 
 // Fatalf - it will call FatalOnError using fmt.Errorf with args provided
+// Library code should return classified errors instead, see errs.Errorf (error-returning variant)
 func Fatalf(f string, a ...interface{}) {
 	FatalOnError(fmt.Errorf(f, a...))
 }
@@ -0,0 +1,153 @@
+package errs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Error kinds, use errors.Is(err, errs.ErrRetryable) etc. to check them
+// Rate-limited errors are also retryable, auth, not-found and config errors are also permanent
+var (
+	// ErrRetryable - temporary failure, operation can be retried (network errors, 5xx, timeouts)
+	ErrRetryable = errors.New("retryable")
+	// ErrPermanent - operation will fail again if retried (4xx, malformed data)
+	ErrPermanent = errors.New("permanent")
+	// ErrAuth - missing or invalid credentials (401, 403)
+	ErrAuth = errors.New("auth")
+	// ErrRateLimited - rate limit exceeded (429), retry after reset
+	ErrRateLimited = errors.New("rate-limited")
+	// ErrNotFound - requested object doesn't exist (404, 410)
+	ErrNotFound = errors.New("not-found")
+	// ErrConfig - invalid configuration
+	ErrConfig = errors.New("config")
+)
+
+// parents - error kinds implied by a given kind
+var parents = map[error]error{
+	ErrRateLimited: ErrRetryable,
+	ErrAuth:        ErrPermanent,
+	ErrNotFound:    ErrPermanent,
+	ErrConfig:      ErrPermanent,
+}
+
+// Error - classified error, Status is HTTP status code when error comes from HTTP response (0 otherwise)
+type Error struct {
+	Kind   error
+	Status int
+	Err    error
+}
+
+// Error - implements error interface, message is not changed by classification
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap - returns underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is - error is of its own kind and of all kinds implied by it
+func (e *Error) Is(target error) bool {
+	for kind := e.Kind; kind != nil; kind = parents[kind] {
+		if kind == target {
+			return true
+		}
+	}
+	return false
+}
+
+// Wrap - classify error as a given kind, returns nil for nil error and keeps already classified errors unchanged
+func Wrap(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// Errorf - creates error of a given kind using fmt.Errorf with args provided
+func Errorf(kind error, f string, a ...interface{}) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(f, a...)}
+}
+
+// HTTPError - creates error classified by HTTP status code, see StatusKind
+func HTTPError(status int, err error) error {
+	return &Error{Kind: StatusKind(status), Status: status, Err: err}
+}
+
+// StatusKind - error kind for a given HTTP status code
+func StatusKind(status int) error {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrAuth
+	case status == http.StatusNotFound || status == http.StatusGone:
+		return ErrNotFound
+	case status == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case status == http.StatusRequestTimeout || status >= http.StatusInternalServerError:
+		return ErrRetryable
+	}
+	return ErrPermanent
+}
+
+// Classify - classify error using Kind, already classified errors are returned unchanged
+func Classify(err error) error {
+	return Wrap(Kind(err), err)
+}
+
+// Kind - returns error kind (one of Err* variables), nil for nil error
+// Unclassified network errors and timeouts are retryable, cancellation and all other errors are permanent
+func Kind(err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	if errors.Is(err, context.Canceled) {
+		return ErrPermanent
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) {
+		return ErrRetryable
+	}
+	return ErrPermanent
+}
+
+// IsRetryable - can operation be retried? (retryable and rate-limited errors)
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrRetryable)
+}
+
+// IsPermanent - will operation fail again? (permanent, auth, not-found and config errors)
+func IsPermanent(err error) bool {
+	return errors.Is(err, ErrPermanent)
+}
+
+// IsAuth - is it an authentication/authorization error?
+func IsAuth(err error) bool {
+	return errors.Is(err, ErrAuth)
+}
+
+// IsRateLimited - is it a rate limit error?
+func IsRateLimited(err error) bool {
+	return errors.Is(err, ErrRateLimited)
+}
+
+// IsNotFound - is it a not found error?
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+// IsConfig - is it a configuration error?
+func IsConfig(err error) bool {
+	return errors.Is(err, ErrConfig)
+}
@@ -0,0 +1,68 @@
+package errs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusKind(t *testing.T) {
+	var testCases = []struct {
+		status   int
+		expected error
+	}{
+		{status: 400, expected: ErrPermanent},
+		{status: 401, expected: ErrAuth},
+		{status: 403, expected: ErrAuth},
+		{status: 404, expected: ErrNotFound},
+		{status: 408, expected: ErrRetryable},
+		{status: 410, expected: ErrNotFound},
+		{status: 422, expected: ErrPermanent},
+		{status: 429, expected: ErrRateLimited},
+		{status: 500, expected: ErrRetryable},
+		{status: 503, expected: ErrRetryable},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, StatusKind(tc.status), tc.status)
+	}
+}
+
+func TestHierarchy(t *testing.T) {
+	rateLimited := HTTPError(429, errors.New("quota exceeded"))
+	assert.True(t, IsRateLimited(rateLimited))
+	assert.True(t, IsRetryable(rateLimited))
+	assert.False(t, IsPermanent(rateLimited))
+	assert.Equal(t, "quota exceeded", rateLimited.Error())
+	notFound := fmt.Errorf("get: %w", HTTPError(404, errors.New("no such repo")))
+	assert.True(t, IsNotFound(notFound))
+	assert.True(t, IsPermanent(notFound))
+	assert.False(t, IsRetryable(notFound))
+	assert.Equal(t, ErrNotFound, Kind(notFound))
+	config := Errorf(ErrConfig, "invalid %s", "x")
+	assert.True(t, IsConfig(config))
+	assert.True(t, IsPermanent(config))
+	assert.False(t, IsAuth(config))
+	assert.Equal(t, config, Wrap(ErrRetryable, config))
+	assert.Nil(t, Wrap(ErrRetryable, nil))
+}
+
+func TestClassify(t *testing.T) {
+	var testCases = []struct {
+		err      error
+		expected error
+	}{
+		{err: nil, expected: nil},
+		{err: errors.New("malformed"), expected: ErrPermanent},
+		{err: context.Canceled, expected: ErrPermanent},
+		{err: context.DeadlineExceeded, expected: ErrRetryable},
+		{err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, expected: ErrRetryable},
+		{err: HTTPError(401, errors.New("bad token")), expected: ErrAuth},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, Kind(Classify(tc.err)), fmt.Sprintf("%v", tc.err))
+	}
+}
@@ -36,13 +36,13 @@ func ESCacheGet(ctx *Ctx, key string) (entry *ESCacheEntry, ok bool) {
 	payloadBody := bytes.NewReader(payloadBytes)
 	method := "POST"
 	url := fmt.Sprintf("%s/dads_cache/_search", ctx.ESURL)
-	req, err := http.NewRequest(method, url, payloadBody)
+	req, err := http.NewRequestWithContext(GetContext(ctx), method, url, payloadBody)
 	if err != nil {
 		Printf("New request error: %+v for %s url: %s, data: %s\n", err, method, url, data)
 		return
 	}
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := ESHTTPClient(ctx).Do(req)
 	if err != nil {
 		Printf("do request error: %+v for %s url: %s, data: %s\n", err, method, url, data)
 		return
@@ -98,14 +98,14 @@ func ESCacheSet(ctx *Ctx, key string, entry *ESCacheEntry) {
 	payloadBody := bytes.NewReader(payloadBytes)
 	method := "POST"
 	url := fmt.Sprintf("%s/dads_cache/_doc?refresh=true", ctx.ESURL)
-	req, err := http.NewRequest(method, url, payloadBody)
+	req, err := http.NewRequestWithContext(GetContext(ctx), method, url, payloadBody)
 	if err != nil {
 		sData := BytesToStringTrunc(payloadBytes, MaxPayloadPrintfLen, true)
 		Printf("New request error: %+v for %s url: %s, data: %s\n", err, method, url, sData)
 		return
 	}
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := ESHTTPClient(ctx).Do(req)
 	if err != nil {
 		sData := BytesToStringTrunc(payloadBytes, MaxPayloadPrintfLen, true)
 		Printf("do request error: %+v for %s url: %s, data: %s\n", err, method, url, sData)
@@ -136,13 +136,13 @@ func ESCacheDelete(ctx *Ctx, key string) {
 	payloadBody := bytes.NewReader(payloadBytes)
 	method := "POST"
 	url := fmt.Sprintf("%s/dads_cache/_delete_by_query?conflicts=proceed&refresh=true", ctx.ESURL)
-	req, err := http.NewRequest(method, url, payloadBody)
+	req, err := http.NewRequestWithContext(GetContext(ctx), method, url, payloadBody)
 	if err != nil {
 		Printf("New request error: %+v for %s url: %s, data: %s\n", err, method, url, data)
 		return
 	}
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := ESHTTPClient(ctx).Do(req)
 	if err != nil {
 		Printf("do request error: %+v for %s url: %s, data: %s\n", err, method, url, data)
 		return
@@ -174,13 +174,13 @@ func ESCacheDeleteExpired(ctx *Ctx) {
 	payloadBody := bytes.NewReader(payloadBytes)
 	method := "POST"
 	url := fmt.Sprintf("%s/dads_cache/_delete_by_query?conflicts=proceed&refresh=true", ctx.ESURL)
-	req, err := http.NewRequest(method, url, payloadBody)
+	req, err := http.NewRequestWithContext(GetContext(ctx), method, url, payloadBody)
 	if err != nil {
 		Printf("New request error: %+v for %s url: %s, data: %s\n", err, method, url, data)
 		return
 	}
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := ESHTTPClient(ctx).Do(req)
 	if err != nil {
 		Printf("do request error: %+v for %s url: %s, data: %s\n", err, method, url, data)
 		return
@@ -395,16 +395,29 @@ func MaybeESCacheCleanup(ctx *Ctx) {
 
 // CreateESCache - creates dads_cache index needed for caching
 func CreateESCache(ctx *Ctx) {
+	FatalOnError(CreateESCacheE(ctx))
+}
+
+// CreateESCacheE - like CreateESCache but returns classified error instead of exiting
+func CreateESCacheE(ctx *Ctx) (err error) {
 	if ctx.ESURL == "" {
 		return
 	}
 	// Create index, ignore if exists (see status 400 is not in error statuses)
-	_, _, _, _, err := Request(ctx, ctx.ESURL+"/dads_cache", "PUT", nil, []byte{}, []string{}, nil, map[[2]int]struct{}{{401, 599}: {}}, nil, nil, false, nil, false)
-	FatalOnError(err)
+	_, _, _, _, err = Request(ctx, ctx.ESURL+"/dads_cache", "PUT", nil, []byte{}, []string{}, nil, map[[2]int]struct{}{{401, 599}: {}}, nil, nil, false, nil, false)
+	return
 }
 
 // GetLastUpdate - get last update date from ElasticSearch
 func GetLastUpdate(ctx *Ctx, key string) (lastUpdate *time.Time) {
+	lastUpdate, err := GetLastUpdateE(ctx, key)
+	FatalOnError(err)
+	return
+}
+
+// GetLastUpdateE - like GetLastUpdate but returns classified error instead of exiting
+// Malformed responses are logged and treated as no last update (like in GetLastUpdate)
+func GetLastUpdateE(ctx *Ctx, key string) (lastUpdate *time.Time, err error) {
 	if ctx.ESURL == "" || ctx.NoIncremental {
 		return
 	}
@@ -435,9 +448,12 @@ func GetLastUpdate(ctx *Ctx, key string) (lastUpdate *time.Time) {
 		false, // skip in dry-run mode
 	)
 	if status == 404 {
+		err = nil
+		return
+	}
+	if err != nil {
 		return
 	}
-	FatalOnError(err)
 	type resultStruct struct {
 		Aggs struct {
 			M struct {
@@ -449,6 +465,7 @@ func GetLastUpdate(ctx *Ctx, key string) (lastUpdate *time.Time) {
 	err = jsoniter.Unmarshal(resp.([]byte), &res)
 	if err != nil {
 		Printf("resume from date JSON decode error: %+v for %s url: %s, query: %s\n", err, method, url, string(payloadBytes))
+		err = nil
 		return
 	}
 	if res.Aggs.M.Str != "" {
@@ -456,6 +473,7 @@ func GetLastUpdate(ctx *Ctx, key string) (lastUpdate *time.Time) {
 		tm, err = TimeParseAny(res.Aggs.M.Str)
 		if err != nil {
 			Printf("resume from date decode aggregations error: %+v for %s url: %s, query: %s\n", err, method, url, string(payloadBytes))
+			err = nil
 			return
 		}
 		lastUpdate = &tm
@@ -483,14 +501,14 @@ func SetLastUpdate(ctx *Ctx, key string, when time.Time) {
 	payloadBody := bytes.NewReader(payloadBytes)
 	method := "POST"
 	url := fmt.Sprintf("%s/last-update-cache/_doc?refresh=true", ctx.ESURL)
-	req, err := http.NewRequest(method, url, payloadBody)
+	req, err := http.NewRequestWithContext(GetContext(ctx), method, url, payloadBody)
 	if err != nil {
 		sData := BytesToStringTrunc(payloadBytes, MaxPayloadPrintfLen, true)
 		Printf("New request error: %+v for %s url: %s, data: %s\n", err, method, url, sData)
 		return
 	}
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := ESHTTPClient(ctx).Do(req)
 	if err != nil {
 		sData := BytesToStringTrunc(payloadBytes, MaxPayloadPrintfLen, true)
 		Printf("do request error: %+v for %s url: %s, data: %s\n", err, method, url, sData)
@@ -7,14 +7,14 @@ import (
 	"os/exec"
 )
 
-// ExecCommand - execute command given by array of strings with eventual environment map
+// ExecCommand - execute command given by array of strings with eventual environment map, command is killed when ctx is cancelled
 func ExecCommand(ctx *Ctx, cmdAndArgs []string, cwd string, env map[string]string) (sout, serr string, err error) {
 	command := cmdAndArgs[0]
 	arguments := cmdAndArgs[1:]
 	if ctx.Debug > 1 {
 		Printf("executing command %s:%v:%+v\n", cwd, env, cmdAndArgs)
 	}
-	cmd := exec.Command(command, arguments...)
+	cmd := exec.CommandContext(GetContext(ctx), command, arguments...)
 	if len(env) > 0 {
 		newEnv := os.Environ()
 		for key, value := range env {
@@ -51,7 +51,7 @@ func ExecCommandPipe(ctx *Ctx, cmdAndArgs []string, cwd string, env map[string]s
 	if ctx.Debug > 1 {
 		Printf("executing non-blocking command %s:%v:%+v\n", cwd, env, cmdAndArgs)
 	}
-	cmd = exec.Command(command, arguments...)
+	cmd = exec.CommandContext(GetContext(ctx), command, arguments...)
 	if len(env) > 0 {
 		newEnv := os.Environ()
 		for key, value := range env {
@@ -38,6 +38,7 @@ type ClientProvider struct {
 	firehose *firehose.Client
 	region   string
 	endPoint string
+	ctx      context.Context
 }
 
 // NewClientProvider initiate new client provider
@@ -77,6 +78,21 @@ func NewClientProvider() (*ClientProvider, error) {
 	return c, nil
 }
 
+// WithContext returns a copy of the client provider whose firehose calls are cancelled with ctx
+func (c *ClientProvider) WithContext(ctx context.Context) *ClientProvider {
+	cp := *c
+	cp.ctx = ctx
+	return &cp
+}
+
+// context returns the client provider's context, context.Background() if not set
+func (c *ClientProvider) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
 // CreateDeliveryStream creating firehose delivery stream channel
 // You must provide channel name as required parameter
 // If channel created successfully it will return nil else it will return error
@@ -85,7 +101,7 @@ func (c *ClientProvider) CreateDeliveryStream(channel string) error {
 		DeliveryStreamName: aws.String(channel),
 		DeliveryStreamType: types.DeliveryStreamTypeDirectPut,
 	}
-	_, err := c.firehose.CreateDeliveryStream(context.Background(), params)
+	_, err := c.firehose.CreateDeliveryStream(c.context(), params)
 	return err
 }
 
@@ -112,8 +128,6 @@ func (c *ClientProvider) CreateDeliveryStream(channel string) error {
 // Don't concatenate two or more base64 strings to form the data fields of your
 // records. Instead, concatenate the raw data, then perform base64 encoding.
 func (c *ClientProvider) PutRecordBatch(channel string, records []interface{}) ([]*PutResponse, error) {
-	ch := make(chan *chanPutResponse)
-
 	recordSize, err := size(records)
 	if err != nil {
 		return []*PutResponse{}, err
@@ -131,12 +145,15 @@ func (c *ClientProvider) PutRecordBatch(channel string, records []interface{}) (
 	if err != nil {
 		return []*PutResponse{}, err
 	}
+	// buffered, so senders never block when we return early on error or cancellation
+	ch := make(chan *chanPutResponse, len(chunks))
 	for _, chunk := range chunks {
 		chunk := chunk
 		go func() {
 			result, err := c.send(channel, chunk)
 			if err != nil {
 				ch <- &chanPutResponse{Error: err}
+				return
 			}
 			ch <- &chanPutResponse{Result: result}
 		}()
@@ -150,6 +167,8 @@ func (c *ClientProvider) PutRecordBatch(channel string, records []interface{}) (
 				return []*PutResponse{}, r.Error
 			}
 			res = append(res, r.Result...)
+		case <-c.context().Done():
+			return []*PutResponse{}, c.context().Err()
 		}
 	}
 
@@ -190,7 +209,7 @@ func (c *ClientProvider) PutRecord(channel string, record interface{}) (*PutResp
 		DeliveryStreamName: aws.String(channel),
 		Record:             &types.Record{Data: b},
 	}
-	res, err := c.firehose.PutRecord(context.Background(), params)
+	res, err := c.firehose.PutRecord(c.context(), params)
 	if err != nil {
 		return &PutResponse{}, err
 	}
@@ -255,7 +274,7 @@ func (c *ClientProvider) send(channel string, records []interface{}) ([]*PutResp
 		DeliveryStreamName: aws.String(channel),
 		Records:            inputs,
 	}
-	recordBatch, err := c.firehose.PutRecordBatch(context.Background(), params)
+	recordBatch, err := c.firehose.PutRecordBatch(c.context(), params)
 	if err != nil {
 		return []*PutResponse{}, err
 	}
@@ -292,7 +311,7 @@ func (c *ClientProvider) DescribeDeliveryStream(channel string) (*DescribeOutput
 		DeliveryStreamName: &channel,
 	}
 
-	res, err := c.firehose.DescribeDeliveryStream(context.Background(), &params)
+	res, err := c.firehose.DescribeDeliveryStream(c.context(), &params)
 	if err != nil {
 		return &DescribeOutput{}, err
 	}
@@ -322,7 +341,7 @@ func (c *ClientProvider) DeleteDeliveryStream(channel string, force bool) error
 		params.AllowForceDelete = &force
 	}
 
-	_, err := c.firehose.DeleteDeliveryStream(context.Background(), &params)
+	_, err := c.firehose.DeleteDeliveryStream(c.context(), &params)
 	if err != nil {
 		return err
 	}
@@ -20,4 +20,5 @@ require (
 	golang.org/x/crypto v0.0.0-20211215153901-e495a2d5b3d3
 	golang.org/x/text v0.3.7
 	gopkg.in/resty.v1 v1.12.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,241 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CircuitClosed - requests are sent normally
+	CircuitClosed = "closed"
+	// CircuitOpen - requests are rejected without contacting the host
+	CircuitOpen = "open"
+	// CircuitHalfOpen - single probe request is allowed, its result closes or reopens the circuit
+	CircuitHalfOpen = "half-open"
+	// DefaultBreakerThreshold - consecutive failures opening the circuit
+	DefaultBreakerThreshold = 5
+	// DefaultBreakerTimeout - how long circuit stays open before a probe request is allowed
+	DefaultBreakerTimeout = time.Minute
+)
+
+var (
+	breakerConfig = BreakerConfig{Threshold: DefaultBreakerThreshold, Timeout: DefaultBreakerTimeout}
+	hostGuards    = map[string]*hostGuard{}
+	hostGuardsMtx = &sync.Mutex{}
+	// BreakerLogf - used to report circuit state changes and rejections
+	BreakerLogf = log.Printf
+)
+
+// BreakerConfig - per host circuit breaker and concurrency limits shared by all clients
+// Threshold - consecutive failures (network errors or 5xx statuses) that open the circuit, 0 disables circuit breaker
+// Timeout - how long circuit stays open before a single probe request is allowed
+// MaxInFlight - max number of concurrent requests to a single host, 0 means no limit
+type BreakerConfig struct {
+	Threshold   int
+	Timeout     time.Duration
+	MaxInFlight int
+}
+
+// CircuitOpenError - returned when request is rejected because host's circuit is open
+type CircuitOpenError struct {
+	Host  string
+	Until time.Time
+}
+
+// Error - implements error interface
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit for %s is open until %v", e.Host, e.Until)
+}
+
+// hostGuard - circuit breaker state and in-flight semaphore for a single host
+type hostGuard struct {
+	host     string
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+	sem      chan struct{}
+	mtx      *sync.Mutex
+}
+
+// SetBreakerConfig - set circuit breaker and concurrency limits, resets state of all hosts
+func SetBreakerConfig(cfg BreakerConfig) {
+	hostGuardsMtx.Lock()
+	defer hostGuardsMtx.Unlock()
+	breakerConfig = cfg
+	hostGuards = map[string]*hostGuard{}
+}
+
+// GetBreakerConfig - get current circuit breaker and concurrency limits
+func GetBreakerConfig() BreakerConfig {
+	hostGuardsMtx.Lock()
+	defer hostGuardsMtx.Unlock()
+	return breakerConfig
+}
+
+// CircuitState - returns circuit state for a given host
+func CircuitState(host string) string {
+	g, _ := getHostGuard(host)
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	return g.state
+}
+
+func getHostGuard(host string) (*hostGuard, BreakerConfig) {
+	host = strings.ToLower(host)
+	hostGuardsMtx.Lock()
+	defer hostGuardsMtx.Unlock()
+	g, ok := hostGuards[host]
+	if !ok {
+		g = &hostGuard{host: host, state: CircuitClosed, mtx: &sync.Mutex{}}
+		if breakerConfig.MaxInFlight > 0 {
+			g.sem = make(chan struct{}, breakerConfig.MaxInFlight)
+		}
+		hostGuards[host] = g
+	}
+	return g, breakerConfig
+}
+
+// allow - can request be sent now, probe is true when this is a half-open probe request
+func (g *hostGuard) allow(cfg BreakerConfig) (probe bool, err error) {
+	if cfg.Threshold <= 0 {
+		return
+	}
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	switch g.state {
+	case CircuitOpen:
+		if time.Since(g.openedAt) < cfg.Timeout {
+			err = &CircuitOpenError{Host: g.host, Until: g.openedAt.Add(cfg.Timeout)}
+			return
+		}
+		g.state = CircuitHalfOpen
+		BreakerLogf("circuit for %s is half-open, sending probe request\n", g.host)
+		fallthrough
+	case CircuitHalfOpen:
+		if g.probing {
+			err = &CircuitOpenError{Host: g.host, Until: time.Now().Add(cfg.Timeout)}
+			return
+		}
+		g.probing = true
+		probe = true
+	}
+	return
+}
+
+// done - record request result
+func (g *hostGuard) done(cfg BreakerConfig, probe, failed bool) {
+	if cfg.Threshold <= 0 {
+		return
+	}
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	if probe {
+		g.probing = false
+	}
+	if !failed {
+		if g.state != CircuitClosed {
+			BreakerLogf("circuit for %s closed\n", g.host)
+		}
+		g.state = CircuitClosed
+		g.failures = 0
+		return
+	}
+	g.failures++
+	if g.state == CircuitHalfOpen || (g.state == CircuitClosed && g.failures >= cfg.Threshold) {
+		g.state = CircuitOpen
+		g.openedAt = time.Now()
+		BreakerLogf("circuit for %s opened after %d consecutive failures, rejecting requests for %v\n", g.host, g.failures, cfg.Timeout)
+	}
+}
+
+// cancelProbe - probe request was not sent, allow another one
+func (g *hostGuard) cancelProbe(probe bool) {
+	if !probe {
+		return
+	}
+	g.mtx.Lock()
+	g.probing = false
+	g.mtx.Unlock()
+}
+
+// BreakerTransport - http.RoundTripper applying per host circuit breaker and max in-flight requests limit
+type BreakerTransport struct {
+	Transport http.RoundTripper
+}
+
+// NewBreakerTransport - wraps transport (nil means DefaultTransport()) with circuit breaker and concurrency limiter
+func NewBreakerTransport(transport http.RoundTripper) *BreakerTransport {
+	if transport == nil {
+		transport = DefaultTransport()
+	}
+	return &BreakerTransport{Transport: transport}
+}
+
+// RoundTrip - implements http.RoundTripper, in-flight slot is held until response body is closed
+func (t *BreakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	g, cfg := getHostGuard(req.URL.Host)
+	probe, err := g.allow(cfg)
+	if err != nil {
+		BreakerLogf("%s %s rejected: %v\n", req.Method, req.URL.Host, err)
+		return nil, err
+	}
+	release := func() {}
+	if g.sem != nil {
+		select {
+		case g.sem <- struct{}{}:
+		case <-req.Context().Done():
+			g.cancelProbe(probe)
+			return nil, req.Context().Err()
+		}
+		once := &sync.Once{}
+		release = func() { once.Do(func() { <-g.sem }) }
+	}
+	resp, err := t.Transport.RoundTrip(req)
+	if err != nil && isCancelled(req, err) {
+		// Cancelled or timed out by the caller, this says nothing about host's health
+		g.cancelProbe(probe)
+	} else {
+		g.done(cfg, probe, err != nil || (resp != nil && resp.StatusCode >= http.StatusInternalServerError))
+	}
+	if err != nil || resp == nil || resp.Body == nil {
+		release()
+		return resp, err
+	}
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// isCancelled - request failed because its context was cancelled or its deadline expired
+func isCancelled(req *http.Request, err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || req.Context().Err() != nil
+}
+
+// releaseBody - response body releasing in-flight slot on EOF or close
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+// Read - read body and release in-flight slot when all data was read
+func (b *releaseBody) Read(p []byte) (n int, err error) {
+	n, err = b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.release()
+	}
+	return
+}
+
+// Close - close body and release in-flight slot
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
@@ -0,0 +1,73 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreakerTransport(t *testing.T) {
+	failing := int32(1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	BreakerLogf = func(string, ...interface{}) {}
+	SetBreakerConfig(BreakerConfig{Threshold: 2, Timeout: 50 * time.Millisecond, MaxInFlight: 1})
+	defer SetBreakerConfig(BreakerConfig{Threshold: DefaultBreakerThreshold, Timeout: DefaultBreakerTimeout})
+	client := &http.Client{Transport: NewBreakerTransport(nil)}
+	get := func() (int, error) {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			return 0, err
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+	for i := 0; i < 2; i++ {
+		status, err := get()
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadGateway, status)
+	}
+	assert.Equal(t, CircuitOpen, CircuitState(u.Host))
+	_, err := get()
+	assert.Error(t, err)
+	time.Sleep(60 * time.Millisecond)
+	atomic.StoreInt32(&failing, 0)
+	status, err := get()
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, CircuitClosed, CircuitState(u.Host))
+}
+
+func TestBreakerTransportCancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	BreakerLogf = func(string, ...interface{}) {}
+	SetBreakerConfig(BreakerConfig{Threshold: 1, Timeout: time.Hour, MaxInFlight: 1})
+	defer SetBreakerConfig(BreakerConfig{Threshold: DefaultBreakerThreshold, Timeout: DefaultBreakerTimeout})
+	client := &http.Client{Transport: NewBreakerTransport(nil)}
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		_, err := client.Do(req)
+		cancel()
+		assert.Error(t, err)
+		// Caller's deadline doesn't count as host failure and frees in-flight slot
+		assert.Equal(t, CircuitClosed, CircuitState(u.Host))
+	}
+}
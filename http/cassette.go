@@ -0,0 +1,363 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	// CassetteRecord - send requests and save request/response pairs to cassette files
+	CassetteRecord = "record"
+	// CassetteReplay - serve responses from cassette files, never hit the network
+	CassetteReplay = "replay"
+	// CassetteInlineBodySize - response bodies up to this size are stored in cassette files (base64 encoded if not UTF-8), bigger ones in separate body files
+	CassetteInlineBodySize = 0x10000
+)
+
+var (
+	defaultCassette    *Cassette
+	defaultCassetteMtx = &sync.RWMutex{}
+	// CassetteSkipHeaders - request headers never written to cassette files
+	CassetteSkipHeaders = map[string]struct{}{"Authorization": {}, "Proxy-Authorization": {}, "Cookie": {}}
+	// CassetteSkipResponseHeaders - response headers never written to cassette files
+	CassetteSkipResponseHeaders = map[string]struct{}{"Set-Cookie": {}}
+	// CassetteSkipParams - lower case URL query parameters carrying credentials, their values are ignored when matching requests
+	CassetteSkipParams = map[string]struct{}{
+		"access_token":  {},
+		"api_key":       {},
+		"apikey":        {},
+		"client_secret": {},
+		"key":           {},
+		"password":      {},
+		"private_token": {},
+		"token":         {},
+	}
+)
+
+// Cassette - http.RoundTripper recording HTTP interactions to files or replaying them offline
+// Interactions are matched by method + normalized URL (see NormalizeCassetteURL) + body hash, all stored strings are passed through Filter (used to scrub secrets)
+// Responses are recorded while the caller reads them, so streamed bodies are never held in memory, interaction is saved when completely read body is closed
+type Cassette struct {
+	Mode      string
+	Dir       string
+	Filter    func(string) string
+	Transport http.RoundTripper
+	mtx       *sync.Mutex
+}
+
+// CassetteInteraction - single request/response pair stored in a cassette file
+type CassetteInteraction struct {
+	Method          string              `json:"method"`
+	URL             string              `json:"url"`
+	RequestHeaders  map[string][]string `json:"request_headers,omitempty"`
+	RequestBody     string              `json:"request_body,omitempty"`
+	Status          int                 `json:"status"`
+	ResponseHeaders map[string][]string `json:"response_headers,omitempty"`
+	ResponseBody    string              `json:"response_body,omitempty"`
+	Base64Body      bool                `json:"base64_body,omitempty"`
+	BodyFile        string              `json:"body_file,omitempty"`
+}
+
+// NewCassette - creates cassette for mode (record/replay) storing files in dir, filter can be nil
+func NewCassette(mode, dir string, filter func(string) string) (*Cassette, error) {
+	if mode != CassetteRecord && mode != CassetteReplay {
+		return nil, fmt.Errorf("unknown cassette mode '%s'", mode)
+	}
+	if filter == nil {
+		filter = func(s string) string { return s }
+	}
+	if mode == CassetteRecord {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &Cassette{Mode: mode, Dir: dir, Filter: filter, Transport: DefaultTransport(), mtx: &sync.Mutex{}}, nil
+}
+
+// SetDefaultCassette - cassette used by all ClientProviders created after this call, nil disables it
+func SetDefaultCassette(c *Cassette) {
+	defaultCassetteMtx.Lock()
+	defaultCassette = c
+	defaultCassetteMtx.Unlock()
+}
+
+// DefaultCassette - returns cassette set by SetDefaultCassette
+func DefaultCassette() *Cassette {
+	defaultCassetteMtx.RLock()
+	defer defaultCassetteMtx.RUnlock()
+	return defaultCassette
+}
+
+// NormalizeCassetteURL - URL used to match requests: lower case scheme and host, no user info and fragment,
+// query parameters sorted and values of CassetteSkipParams removed, so it doesn't depend on credentials used
+func NormalizeCassetteURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.User = nil
+	u.Fragment = ""
+	u.RawFragment = ""
+	query := u.Query()
+	for k := range query {
+		if _, ok := CassetteSkipParams[strings.ToLower(k)]; ok {
+			query[k] = []string{""}
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// Key - cassette key for a given request: hash(method, normalized url, body)
+func (c *Cassette) Key(method, url string, body []byte) string {
+	hash := sha1.New()
+	_, _ = hash.Write([]byte(method + NormalizeCassetteURL(url)))
+	_, _ = hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (c *Cassette) path(key string) string {
+	return filepath.Join(c.Dir, key+".json")
+}
+
+// RoundTrip - implements http.RoundTripper
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var (
+		body []byte
+		err  error
+	)
+	if req.Body != nil {
+		body, err = ioutil.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	key := c.Key(req.Method, req.URL.String(), body)
+	if c.Mode == CassetteReplay {
+		return c.replay(req, key)
+	}
+	resp, err := c.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempFile(c.Dir, key+".*.tmp")
+	if err != nil {
+		_ = resp.Body.Close()
+		return nil, err
+	}
+	resp.Body = &cassetteBody{
+		body: resp.Body,
+		tmp:  tmp,
+		record: func(tmp *os.File) error {
+			return c.record(req, body, resp, tmp, key)
+		},
+	}
+	return resp, nil
+}
+
+// cassetteBody - response body copied to a temporary file while it is read, interaction is recorded on Close
+// Only completely read bodies are recorded
+type cassetteBody struct {
+	body   io.ReadCloser
+	tmp    *os.File
+	record func(tmp *os.File) error
+	err    error
+	eof    bool
+	once   sync.Once
+}
+
+// Read - implements io.Reader
+func (b *cassetteBody) Read(p []byte) (n int, err error) {
+	n, err = b.body.Read(p)
+	if n > 0 && b.err == nil {
+		_, b.err = b.tmp.Write(p[:n])
+	}
+	if err == io.EOF {
+		b.eof = true
+	} else if err != nil && b.err == nil {
+		b.err = err
+	}
+	return
+}
+
+// Close - record interaction if the whole body was read, recording errors are returned here
+// Body closed before its end (consumer stopped reading or was cancelled) is not recorded, the rest is not downloaded
+func (b *cassetteBody) Close() (err error) {
+	b.once.Do(func() {
+		err = b.body.Close()
+		defer func() {
+			_ = b.tmp.Close()
+			_ = os.Remove(b.tmp.Name())
+		}()
+		if !b.eof && b.err == nil {
+			return
+		}
+		if b.err != nil {
+			err = fmt.Errorf("response not recorded: %v", b.err)
+			return
+		}
+		e := b.record(b.tmp)
+		if e != nil {
+			err = e
+		}
+	})
+	return
+}
+
+func (c *Cassette) filterHeaders(headers http.Header, skip map[string]struct{}) map[string][]string {
+	filtered := make(map[string][]string)
+	for k, vs := range headers {
+		if _, ok := skip[http.CanonicalHeaderKey(k)]; ok {
+			continue
+		}
+		for _, v := range vs {
+			filtered[k] = append(filtered[k], c.Filter(v))
+		}
+	}
+	return filtered
+}
+
+// filterFile - copy src to dst passing each valid UTF-8 line through Filter, so memory used is bounded by the longest line
+func (c *Cassette) filterFile(src io.Reader, dst string) (err error) {
+	out, err := os.Create(dst)
+	if err != nil {
+		return
+	}
+	w := bufio.NewWriter(out)
+	r := bufio.NewReader(src)
+	for {
+		line, e := r.ReadString('\n')
+		if utf8.ValidString(line) {
+			line = c.Filter(line)
+		}
+		_, err = w.WriteString(line)
+		if err != nil || e != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	e := out.Close()
+	if err == nil {
+		err = e
+	}
+	return
+}
+
+func (c *Cassette) record(req *http.Request, body []byte, resp *http.Response, tmp *os.File, key string) error {
+	interaction := CassetteInteraction{
+		Method:          req.Method,
+		URL:             c.Filter(req.URL.String()),
+		RequestHeaders:  c.filterHeaders(req.Header, CassetteSkipHeaders),
+		RequestBody:     c.Filter(string(body)),
+		Status:          resp.StatusCode,
+		ResponseHeaders: c.filterHeaders(resp.Header, CassetteSkipResponseHeaders),
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	if size <= CassetteInlineBodySize {
+		respBody, err := ioutil.ReadAll(tmp)
+		if err != nil {
+			return err
+		}
+		if utf8.Valid(respBody) {
+			interaction.ResponseBody = c.Filter(string(respBody))
+		} else {
+			interaction.ResponseBody = base64.StdEncoding.EncodeToString(respBody)
+			interaction.Base64Body = true
+		}
+	} else {
+		interaction.BodyFile = key + ".body"
+		err = c.filterFile(tmp, filepath.Join(c.Dir, interaction.BodyFile))
+		if err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(interaction, "", "  ")
+	if err != nil {
+		return err
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return ioutil.WriteFile(c.path(key), data, 0644)
+}
+
+func (c *Cassette) replay(req *http.Request, key string) (*http.Response, error) {
+	data, err := ioutil.ReadFile(c.path(key))
+	if err != nil {
+		return nil, fmt.Errorf("no cassette %s for %s %s: %v", key, req.Method, c.Filter(req.URL.String()), err)
+	}
+	var interaction CassetteInteraction
+	err = json.Unmarshal(data, &interaction)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode cassette %s: %v", key, err)
+	}
+	var (
+		respBody      io.ReadCloser
+		contentLength int64
+	)
+	switch {
+	case interaction.BodyFile != "":
+		file, err := os.Open(filepath.Join(c.Dir, filepath.Base(interaction.BodyFile)))
+		if err != nil {
+			return nil, fmt.Errorf("cannot open cassette %s body: %v", key, err)
+		}
+		info, err := file.Stat()
+		if err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("cannot open cassette %s body: %v", key, err)
+		}
+		respBody, contentLength = file, info.Size()
+	case interaction.Base64Body:
+		data, err := base64.StdEncoding.DecodeString(interaction.ResponseBody)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode cassette %s body: %v", key, err)
+		}
+		respBody, contentLength = ioutil.NopCloser(bytes.NewReader(data)), int64(len(data))
+	default:
+		respBody, contentLength = ioutil.NopCloser(strings.NewReader(interaction.ResponseBody)), int64(len(interaction.ResponseBody))
+	}
+	header := http.Header{}
+	for k, vs := range interaction.ResponseHeaders {
+		for _, v := range vs {
+			header.Add(k, v)
+		}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.Status, http.StatusText(interaction.Status)),
+		StatusCode:    interaction.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          respBody,
+		ContentLength: contentLength,
+		Request:       req,
+	}, nil
+}
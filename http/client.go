@@ -2,6 +2,7 @@ package http
 
 import (
 	"bytes"
+	"context"
 	"encoding/csv"
 	"log"
 	"net/http"
@@ -11,6 +12,7 @@ import (
 // ClientProvider ...
 type ClientProvider struct {
 	httpclient *http.Client
+	ctx        context.Context
 }
 
 // NewClientProvider initiate a new client object
@@ -29,9 +31,38 @@ func NewClientProvider(timeout time.Duration, allowRedirect bool) *ClientProvide
 	if !allowRedirect {
 		httpClientProvider.httpclient.CheckRedirect = CancelRedirect
 	}
+	var transport http.RoundTripper
+	if cassette := DefaultCassette(); cassette != nil {
+		transport = cassette
+	}
+	httpClientProvider.httpclient.Transport = NewBreakerTransport(transport)
 	return httpClientProvider
 }
 
+// WithContext returns a copy of the provider whose requests are cancelled with ctx
+func (h *ClientProvider) WithContext(ctx context.Context) *ClientProvider {
+	cp := *h
+	cp.ctx = ctx
+	return &cp
+}
+
+// WithTransport returns a copy of the provider sending requests using transport (wrapped with circuit breaker)
+func (h *ClientProvider) WithTransport(transport http.RoundTripper) *ClientProvider {
+	cp := *h
+	client := *h.httpclient
+	client.Transport = NewBreakerTransport(transport)
+	cp.httpclient = &client
+	return &cp
+}
+
+// context returns the provider's context, context.Background() if not set
+func (h *ClientProvider) context() context.Context {
+	if h.ctx == nil {
+		return context.Background()
+	}
+	return h.ctx
+}
+
 // Response returned from http request
 type Response struct {
 	StatusCode int
@@ -49,7 +80,7 @@ func (h *ClientProvider) Request(url string, method string, header map[string]st
 
 // RequestWithResponse http
 func (h *ClientProvider) RequestWithResponse(url string, method string, header map[string]string, body []byte, params map[string]string) (*http.Response, []byte, error) {
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
+	req, err := http.NewRequestWithContext(h.context(), method, url, bytes.NewBuffer(body))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -81,6 +112,10 @@ func (h *ClientProvider) RequestWithResponse(url string, method string, header m
 
 	var buf bytes.Buffer
 	_, err = buf.ReadFrom(res.Body)
+	// Recording cassette saves the response when its body is closed
+	if e := res.Body.Close(); err == nil {
+		err = e
+	}
 	if err != nil {
 		return nil, nil, err
 	}
@@ -117,6 +152,10 @@ func (h *ClientProvider) RequestWithRequest(req *http.Request, header map[string
 
 	var buf bytes.Buffer
 	_, err = buf.ReadFrom(res.Body)
+	// Recording cassette saves the response when its body is closed
+	if e := res.Body.Close(); err == nil {
+		err = e
+	}
 	if err != nil {
 		return nil, nil, err
 	}
@@ -126,7 +165,11 @@ func (h *ClientProvider) RequestWithRequest(req *http.Request, header map[string
 
 // RequestCSV requests http API that returns csv result
 func (h *ClientProvider) RequestCSV(url string) ([][]string, error) {
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(h.context(), http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := h.httpclient.Do(req)
 	if err != nil {
 		return nil, err
 	}
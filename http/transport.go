@@ -0,0 +1,155 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	defaultTransport    http.RoundTripper = http.DefaultTransport
+	defaultTransportMtx                   = &sync.RWMutex{}
+)
+
+// TransportConfig - outgoing HTTP transport settings, zero values mean net/http defaults
+// Proxy - proxy URL, when empty HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment variables are used
+// CABundle - PEM file with additional CA certificates (system ones are still trusted)
+// ClientCert, ClientKey - PEM files with client certificate and its key (mutual TLS)
+// InsecureHosts - skip TLS verification only for those hosts (InsecureSkipVerify skips it for all hosts)
+type TransportConfig struct {
+	ConnectTimeout        time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+	Proxy                 string
+	CABundle              string
+	ClientCert            string
+	ClientKey             string
+	MaxIdleConns          int
+	MaxIdleConnsPerHost   int
+	MaxConnsPerHost       int
+	InsecureSkipVerify    bool
+	InsecureHosts         []string
+}
+
+// NewTransport - creates transport using given config, based on net/http default transport settings
+func NewTransport(cfg TransportConfig) (rt http.RoundTripper, err error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.ConnectTimeout > 0 {
+		dialer := &net.Dialer{Timeout: cfg.ConnectTimeout, KeepAlive: 30 * time.Second}
+		transport.DialContext = dialer.DialContext
+	}
+	if cfg.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = cfg.TLSHandshakeTimeout
+	}
+	if cfg.ResponseHeaderTimeout > 0 {
+		transport.ResponseHeaderTimeout = cfg.ResponseHeaderTimeout
+	}
+	if cfg.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = cfg.IdleConnTimeout
+	}
+	if cfg.MaxIdleConns > 0 {
+		transport.MaxIdleConns = cfg.MaxIdleConns
+	}
+	if cfg.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	}
+	if cfg.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = cfg.MaxConnsPerHost
+	}
+	if cfg.Proxy != "" {
+		var proxyURL *url.URL
+		proxyURL, err = url.Parse(cfg.Proxy)
+		if err != nil {
+			err = fmt.Errorf("invalid proxy URL: %v", err)
+			return
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+	if cfg.CABundle != "" {
+		var pem []byte
+		pem, err = ioutil.ReadFile(cfg.CABundle)
+		if err != nil {
+			return
+		}
+		tlsConfig.RootCAs, err = x509.SystemCertPool()
+		if err != nil || tlsConfig.RootCAs == nil {
+			tlsConfig.RootCAs = x509.NewCertPool()
+			err = nil
+		}
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			err = fmt.Errorf("no certificates found in CA bundle %s", cfg.CABundle)
+			return
+		}
+	}
+	if cfg.ClientCert != "" || cfg.ClientKey != "" {
+		var cert tls.Certificate
+		cert, err = tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	transport.TLSClientConfig = tlsConfig
+	if len(cfg.InsecureHosts) == 0 || cfg.InsecureSkipVerify {
+		rt = transport
+		return
+	}
+	insecure := transport.Clone()
+	insecure.TLSClientConfig.InsecureSkipVerify = true
+	hosts := make(map[string]struct{})
+	for _, host := range cfg.InsecureHosts {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if host != "" {
+			hosts[host] = struct{}{}
+		}
+	}
+	rt = &insecureHostsTransport{secure: transport, insecure: insecure, hosts: hosts}
+	return
+}
+
+// insecureHostsTransport - uses transport skipping TLS verification for selected hosts only
+type insecureHostsTransport struct {
+	secure   *http.Transport
+	insecure *http.Transport
+	hosts    map[string]struct{}
+}
+
+// RoundTrip - implements http.RoundTripper
+func (t *insecureHostsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if _, ok := t.hosts[strings.ToLower(req.URL.Hostname())]; ok {
+		return t.insecure.RoundTrip(req)
+	}
+	return t.secure.RoundTrip(req)
+}
+
+// CloseIdleConnections - close idle connections of both transports
+func (t *insecureHostsTransport) CloseIdleConnections() {
+	t.secure.CloseIdleConnections()
+	t.insecure.CloseIdleConnections()
+}
+
+// SetDefaultTransport - transport used by ClientProviders and cassettes created after this call, nil restores net/http default
+func SetDefaultTransport(transport http.RoundTripper) {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	defaultTransportMtx.Lock()
+	defaultTransport = transport
+	defaultTransportMtx.Unlock()
+}
+
+// DefaultTransport - returns transport set by SetDefaultTransport
+func DefaultTransport() http.RoundTripper {
+	defaultTransportMtx.RLock()
+	defer defaultTransportMtx.RUnlock()
+	return defaultTransport
+}
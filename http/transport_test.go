@@ -0,0 +1,43 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTransportInsecureHosts(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	tests := []struct {
+		name string
+		cfg  TransportConfig
+		ok   bool
+	}{
+		{"Verified", TransportConfig{}, false},
+		{"Other insecure host", TransportConfig{InsecureHosts: []string{"example.com"}}, false},
+		{"Insecure host", TransportConfig{InsecureHosts: []string{"example.com", u.Hostname()}}, true},
+		{"Insecure all", TransportConfig{InsecureSkipVerify: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport, err := NewTransport(tt.cfg)
+			assert.NoError(t, err)
+			resp, err := (&http.Client{Transport: transport}).Get(srv.URL)
+			if tt.ok {
+				assert.NoError(t, err)
+				_ = resp.Body.Close()
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+	_, err := NewTransport(TransportConfig{Proxy: "http://%zz"})
+	assert.Error(t, err)
+}
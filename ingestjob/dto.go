@@ -13,6 +13,10 @@ type Log struct {
 	TaskARN       string              `json:"task_arn"`
 	From          *time.Time          `json:"from,omitempty"`
 	To            *time.Time          `json:"to,omitempty"`
+	Level         string              `json:"level,omitempty"`    // debug, info, warn or error
+	Endpoint      string              `json:"endpoint,omitempty"` // data source endpoint (for example repository URL)
+	Project       string              `json:"project,omitempty"`
+	Fields        map[string]string   `json:"fields,omitempty"` // other structured logging fields
 }
 
 // TopHits result
@@ -1,8 +1,11 @@
 package ingestjob
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -32,6 +35,11 @@ type ESLogProvider interface {
 	Count(index string, query map[string]interface{}) (int, error)
 }
 
+// ESBulkLogProvider is optionally implemented by ESLogProvider, WriteBatch uses it to write many logs in a single request
+type ESBulkLogProvider interface {
+	BulkInsert(data []elastic.BulkData) ([]byte, error)
+}
+
 // Logger ...
 type Logger struct {
 	esClient    ESLogProvider
@@ -90,6 +98,46 @@ func (s *Logger) Write(log *Log) error {
 	return s.updateDocument(*log, index, docID)
 }
 
+// WriteBatch writes many logs using a single bulk request (when ES client supports it), otherwise it calls Write for every log
+// Unlike Write it doesn't read existing documents, every log gets its own document (see generateBatchID)
+func (s *Logger) WriteBatch(logs []*Log) error {
+	bulk, ok := s.esClient.(ESBulkLogProvider)
+	if !ok {
+		for _, log := range logs {
+			if err := s.Write(log); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	data := make([]elastic.BulkData, 0, len(logs))
+	for _, log := range logs {
+		if log.Connector == "" || len(log.Configuration) == 0 || log.CreatedAt.IsZero() {
+			return fmt.Errorf("error: log connector, configuration and created at are all required")
+		}
+		if log.Status != InProgress && log.Status != Failed && log.Status != Done && log.Status != Internal {
+			return fmt.Errorf("error: log status must be one of [%s, %s, %s, %s]", InProgress, Failed, Done, Internal)
+		}
+		docID, err := generateBatchID(log, len(data))
+		if err != nil {
+			return err
+		}
+		if log.UpdatedAt.IsZero() {
+			log.UpdatedAt = log.CreatedAt
+		}
+		data = append(data, elastic.BulkData{
+			IndexName: fmt.Sprintf("%s-%s-log-%s", logIndex, log.Connector, s.environment),
+			ID:        docID,
+			Data:      log,
+		})
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	_, err := bulk.BulkInsert(data)
+	return err
+}
+
 // Read ...
 func (s *Logger) Read(connector string, status string) ([]Log, error) {
 	if status != InProgress && status != Failed && status != Done && status != Internal {
@@ -169,6 +217,18 @@ func (s *Logger) updateDocument(log Log, index string, docID string) error {
 		"message":       log.Message,
 		"task_arn":      log.TaskARN,
 	}
+	if log.Level != "" {
+		doc["level"] = log.Level
+	}
+	if log.Endpoint != "" {
+		doc["endpoint"] = log.Endpoint
+	}
+	if log.Project != "" {
+		doc["project"] = log.Project
+	}
+	if len(log.Fields) > 0 {
+		doc["fields"] = log.Fields
+	}
 
 	_, err := s.esClient.UpdateDocument(index, docID, doc)
 	if err != nil {
@@ -267,6 +327,22 @@ func generateID(log *Log) (string, error) {
 	return docID, nil
 }
 
+// generateBatchID - unlike generateID it also uses time with nanoseconds, message and its position in a batch,
+// so many messages logged in the same second get different documents, while sending the same batch again doesn't duplicate them
+func generateBatchID(log *Log, seq int) (string, error) {
+	date := log.CreatedAt.Format(time.RFC3339Nano)
+	configs, err := json.Marshal(log.Configuration)
+	if err != nil {
+		return "", err
+	}
+	hash := sha1.Sum([]byte(log.Message))
+	docID, err := uuid.Generate(log.Connector, string(configs), date, hex.EncodeToString(hash[:]), strconv.Itoa(seq))
+	if err != nil {
+		return "", err
+	}
+	return docID, nil
+}
+
 // WriteTask ...
 func (s *Logger) WriteTask(log *TaskLog) error {
 	if log.Connector == "" || len(log.Configuration) == 0 || log.CreatedAt.IsZero() {
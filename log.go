@@ -3,11 +3,32 @@ package ds
 import (
 	"fmt"
 	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/LF-Engineering/insights-datasource-shared/aws"
 	logger "github.com/LF-Engineering/insights-datasource-shared/ingestjob"
 )
 
+const (
+	// LogLevelDebug - verbose messages, only logged when log level is debug
+	LogLevelDebug = "debug"
+	// LogLevelInfo - default log level
+	LogLevelInfo = "info"
+	// LogLevelWarn - warnings
+	LogLevelWarn = "warn"
+	// LogLevelError - errors
+	LogLevelError = "error"
+	// LogFormatText - 'time: [level] message key=value ...' lines (default)
+	LogFormatText = "text"
+	// LogFormatJSON - one JSON object per line with time, level, msg and fields properties
+	LogFormatJSON = "json"
+)
+
 var (
 	gLogger              *logger.Logger
 	gLoggerConnector     string
@@ -16,6 +37,12 @@ var (
 	gSync                bool
 	gConsoleAfterES      bool
 	gLogLoggerError      bool
+	gLogLevel            atomic.Value // string, see logLevel
+	gLogFormat           atomic.Value // string, see logFormat
+	gTaskARN             string
+	gTaskARNOnce         sync.Once
+	// LogLevels - log level -> severity
+	LogLevels = map[string]int{LogLevelDebug: 0, LogLevelInfo: 1, LogLevelWarn: 2, LogLevelError: 3}
 )
 
 // AddLogger - adds logger
@@ -30,7 +57,7 @@ func AddLogger(logger *logger.Logger, connector, status string, configuration []
 
 // SetSyncMode - sets sync/async ES loging mode
 // sync -> gSyncMode: true - wait for log message to be sent to ES before exiting (sync mode)
-// sync -> gSyncMode: false - default, send log message to ES in goroutine and return immediately
+// sync -> gSyncMode: false - default, queue log message and return immediately, queued messages are sent to ES in bulk (see SetLogQueue, FlushLogs)
 // consoleAfterES -> gConsoleAfterES - will log on console after logged to ES
 func SetSyncMode(sync, consoleAfterES bool) {
 	gSync = sync
@@ -43,40 +70,38 @@ func SetLogLoggerError(logLoggerError bool) {
 }
 
 // Printf is a wrapper around Printf(...) that supports logging and removes redacted data.
+// It logs at info level (so nothing is logged when log level is warn or error), in JSON log format message is a "msg" property
 func Printf(format string, args ...interface{}) {
+	printfLevel(LogLevelInfo, format, args...)
+}
+
+// printfLevel - Printf at a given level
+func printfLevel(level, format string, args ...interface{}) {
+	if !logLevelEnabled(level) {
+		return
+	}
+	if logFormat() == LogFormatJSON {
+		logEntry(level, fmt.Sprintf(format, args...), nil)
+		return
+	}
 	// Actual logging to stdout & DB
 	now := time.Now()
 	msg := FilterRedacted(fmt.Sprintf("%s: "+format, append([]interface{}{ToYMDHMSDate(now)}, args...)...))
-	logConsole := func() {
-		_, err := fmt.Printf("%s", msg)
-		if err != nil && gLogLoggerError {
-			log.Printf("Error (log to console): %s", err.Error())
-		}
+	writeLog(msg, &logger.Log{Message: msg})
+}
+
+// writeLog - write message to all log sinks (see SetLogSinks), default ones are console and ES (if logger was added)
+// ES sink sets entry's connector, configuration, status and dates, in async mode it queues messages (see SetLogQueue and FlushLogs)
+func writeLog(msg string, entry *logger.Log) {
+	sinks := LogSinks()
+	if len(sinks) == 0 {
+		sinks = defaultLogSinks()
 	}
-	if !gConsoleAfterES || gLogger == nil {
-		logConsole()
-	}
-	if gLogger != nil {
-		logES := func() {
-			err := gLogger.Write(&logger.Log{
-				Connector:     gLoggerConnector,
-				Configuration: gLoggerConfiguration,
-				Status:        gLoggerStatus,
-				CreatedAt:     time.Now(),
-				Message:       msg,
-			})
-			if err != nil && gLogLoggerError {
-				log.Printf("Error (log to ES): %s", err.Error())
-			}
-			if gConsoleAfterES {
-				logConsole()
-			}
-		}
-		if gSync {
-			logES()
-			return
+	for _, sink := range sinks {
+		err := sink.Write(msg, entry)
+		if err != nil && gLogLoggerError {
+			log.Printf("Error (log to %T): %s", sink, err.Error())
 		}
-		go logES()
 	}
 }
 
@@ -90,3 +115,205 @@ func PrintfNoRedacted(format string, args ...interface{}) {
 		log.Printf("Err: %s", err.Error())
 	}
 }
+
+// LogFields - structured logging key-value fields
+type LogFields map[string]interface{}
+
+// Logger - structured leveled logger, its fields are added to every message
+// Fields "endpoint" and "project" are stored as separate properties of ES log documents, other fields are stored under "fields"
+type Logger struct {
+	fields LogFields
+}
+
+// SetLogLevel - set min level of messages logged by Logger, debug, info, warn or error
+func SetLogLevel(level string) (err error) {
+	err = CheckLogLevel(level)
+	if err != nil {
+		return
+	}
+	gLogLevel.Store(level)
+	return
+}
+
+// logLevel - min level of logged messages set by SetLogLevel, info by default
+func logLevel() string {
+	level, ok := gLogLevel.Load().(string)
+	if !ok {
+		return LogLevelInfo
+	}
+	return level
+}
+
+// logLevelEnabled - will messages at a given level be logged?
+func logLevelEnabled(level string) bool {
+	return LogLevels[level] >= LogLevels[logLevel()]
+}
+
+// SetLogFormat - set log format, text or json (used by Printf too)
+func SetLogFormat(format string) (err error) {
+	err = CheckLogFormat(format)
+	if err != nil {
+		return
+	}
+	gLogFormat.Store(format)
+	return
+}
+
+// logFormat - log format set by SetLogFormat, text by default
+func logFormat() string {
+	format, ok := gLogFormat.Load().(string)
+	if !ok {
+		return LogFormatText
+	}
+	return format
+}
+
+// CheckLogLevel - checks if log level is supported
+func CheckLogLevel(level string) error {
+	if _, ok := LogLevels[level]; !ok {
+		return fmt.Errorf("unsupported log level '%s', supported: %s, %s, %s, %s", level, LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError)
+	}
+	return nil
+}
+
+// CheckLogFormat - checks if log format is supported
+func CheckLogFormat(format string) error {
+	if format != LogFormatText && format != LogFormatJSON {
+		return fmt.Errorf("unsupported log format '%s', supported: %s, %s", format, LogFormatText, LogFormatJSON)
+	}
+	return nil
+}
+
+// TaskARN - ECS task ARN (from container metadata endpoint), empty when not running on ECS, it is only fetched once
+func TaskARN() string {
+	gTaskARNOnce.Do(func() {
+		if os.Getenv("ECS_CONTAINER_METADATA_URI_V4") == "" {
+			return
+		}
+		arn, err := aws.GetContainerARN()
+		if err != nil {
+			log.Printf("Error (get task ARN): %s", err.Error())
+			return
+		}
+		gTaskARN = arn
+	})
+	return gTaskARN
+}
+
+// NewLogger - creates logger with connector, project and task_arn fields (when known) and additional key-value pairs
+func NewLogger(ctx *Ctx, kv ...interface{}) *Logger {
+	fields := LogFields{"connector": ctx.DS}
+	if ctx.Project != "" {
+		fields["project"] = ctx.Project
+	}
+	if arn := TaskARN(); arn != "" {
+		fields["task_arn"] = arn
+	}
+	return (&Logger{fields: fields}).With(kv...)
+}
+
+// With - returns logger with additional key-value pairs: With("endpoint", url, "page", 2)
+func (l *Logger) With(kv ...interface{}) *Logger {
+	fields := LogFields{}
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	for i := 0; i < len(kv); i += 2 {
+		k := fmt.Sprintf("%v", kv[i])
+		if i+1 < len(kv) {
+			fields[k] = kv[i+1]
+		} else {
+			fields[k] = nil
+		}
+	}
+	return &Logger{fields: fields}
+}
+
+// Fields - returns logger's fields
+func (l *Logger) Fields() LogFields {
+	return l.fields
+}
+
+// Enabled - will messages at a given level be logged?
+func (l *Logger) Enabled(level string) bool {
+	return logLevelEnabled(level)
+}
+
+// Debugf - log message at debug level
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.logf(LogLevelDebug, format, args...)
+}
+
+// Infof - log message at info level
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.logf(LogLevelInfo, format, args...)
+}
+
+// Warnf - log message at warn level
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.logf(LogLevelWarn, format, args...)
+}
+
+// Errorf - log message at error level
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.logf(LogLevelError, format, args...)
+}
+
+func (l *Logger) logf(level, format string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	logEntry(level, fmt.Sprintf(format, args...), l.fields)
+}
+
+// logEntry - render message with fields, filter redacted data and write it to console and ES
+func logEntry(level, msg string, fields LogFields) {
+	msg = strings.TrimRight(msg, "\n")
+	line := FilterRedacted(RenderLogLine(logFormat(), time.Now(), level, msg, fields))
+	entry := &logger.Log{Level: level, Message: FilterRedacted(msg)}
+	for k, v := range fields {
+		sv := FilterRedacted(fmt.Sprintf("%v", v))
+		switch k {
+		case "connector":
+			// ES log documents always use connector set by AddLogger (it is a part of index name)
+		case "endpoint":
+			entry.Endpoint = sv
+		case "project":
+			entry.Project = sv
+		case "task_arn":
+			entry.TaskARN = sv
+		default:
+			if entry.Fields == nil {
+				entry.Fields = make(map[string]string)
+			}
+			entry.Fields[k] = sv
+		}
+	}
+	writeLog(line, entry)
+}
+
+// RenderLogLine - render log line in a given format (text or json), message should not end with a new line
+func RenderLogLine(format string, now time.Time, level, msg string, fields LogFields) (line string) {
+	if format == LogFormatJSON {
+		obj := map[string]interface{}{}
+		for k, v := range fields {
+			obj[k] = v
+		}
+		obj["time"] = now.Format(time.RFC3339Nano)
+		obj["level"] = level
+		obj["msg"] = msg
+		line = AsJSON(obj) + "\n"
+	} else {
+		keys := []string{}
+		for k := range fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		kvs := ""
+		for _, k := range keys {
+			kvs += fmt.Sprintf(" %s=%v", k, fields[k])
+		}
+		line = fmt.Sprintf("%s: [%s] %s%s\n", ToYMDHMSDate(now), level, msg, kvs)
+	}
+	return
+}
@@ -0,0 +1,89 @@
+package ds
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	logger "github.com/LF-Engineering/insights-datasource-shared/ingestjob"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderLogLine(t *testing.T) {
+	now := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	fields := LogFields{"connector": "git", "endpoint": "https://github.com/a/b", "page": 2}
+	var testCases = []struct {
+		format   string
+		expected string
+	}{
+		{format: LogFormatText, expected: "2021-03-04 05:06:07: [warn] slow response connector=git endpoint=https://github.com/a/b page=2\n"},
+		{format: LogFormatJSON, expected: `{"connector":"git","endpoint":"https://github.com/a/b","level":"warn","msg":"slow response","page":2,"time":"2021-03-04T05:06:07Z"}` + "\n"},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, RenderLogLine(tc.format, now, LogLevelWarn, "slow response", fields), tc.format)
+	}
+}
+
+func TestLoggerLevels(t *testing.T) {
+	defer func() { _ = SetLogLevel(LogLevelInfo) }()
+	assert.NotNil(t, SetLogLevel("verbose"))
+	assert.NotNil(t, CheckLogFormat("xml"))
+	assert.Nil(t, SetLogLevel(LogLevelWarn))
+	l := (&Logger{}).With("endpoint", "e1")
+	assert.False(t, l.Enabled(LogLevelDebug))
+	assert.False(t, l.Enabled(LogLevelInfo))
+	assert.True(t, l.Enabled(LogLevelWarn))
+	assert.True(t, l.Enabled(LogLevelError))
+	l2 := l.With("endpoint", "e2", "page")
+	assert.Equal(t, LogFields{"endpoint": "e1"}, l.Fields())
+	assert.Equal(t, LogFields{"endpoint": "e2", "page": nil}, l2.Fields())
+}
+
+type testLogSink struct {
+	mtx   sync.Mutex
+	lines []string
+}
+
+func (s *testLogSink) Write(line string, entry *logger.Log) error {
+	s.mtx.Lock()
+	s.lines = append(s.lines, line)
+	s.mtx.Unlock()
+	return nil
+}
+
+func (s *testLogSink) Flush() error {
+	return nil
+}
+
+func TestPrintfLevel(t *testing.T) {
+	sink := &testLogSink{}
+	SetLogSinks(sink)
+	defer func() {
+		SetLogSinks()
+		_ = SetLogLevel(LogLevelInfo)
+		_ = SetLogFormat(LogFormatText)
+	}()
+	for _, format := range []string{LogFormatText, LogFormatJSON} {
+		assert.Nil(t, SetLogFormat(format))
+		assert.Nil(t, SetLogLevel(LogLevelWarn))
+		Printf("hidden %s\n", format)
+		assert.Nil(t, SetLogLevel(LogLevelInfo))
+		Printf("shown %s\n", format)
+	}
+	assert.Equal(t, 2, len(sink.lines))
+	assert.Contains(t, sink.lines[0], "shown text")
+	assert.Contains(t, sink.lines[1], `"msg":"shown json"`)
+	// Level and format can be changed while other goroutines log
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			Printf("concurrent %d\n", i)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		_ = SetLogLevel(LogLevelDebug)
+		_ = SetLogFormat(LogFormatJSON)
+	}
+	<-done
+}
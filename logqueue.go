@@ -0,0 +1,206 @@
+package ds
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	logger "github.com/LF-Engineering/insights-datasource-shared/ingestjob"
+)
+
+const (
+	// DefaultLogQueueSize - max number of log messages waiting to be sent to ES
+	DefaultLogQueueSize = 10000
+	// DefaultLogBatchSize - log messages are sent to ES when that many are queued
+	DefaultLogBatchSize = 500
+	// DefaultLogFlushInterval - or when the oldest queued message waits that long
+	DefaultLogFlushInterval = 5 * time.Second
+)
+
+var (
+	gLogQueue     *logQueue
+	gLogQueueMtx  = &sync.Mutex{}
+	gLogQueueCfg  = logQueueConfig{size: DefaultLogQueueSize, batchSize: DefaultLogBatchSize, interval: DefaultLogFlushInterval}
+	gDroppedLogs  int64
+	gReportedLogs int64
+)
+
+type logQueueConfig struct {
+	size      int
+	batchSize int
+	interval  time.Duration
+	block     bool
+}
+
+// logItem - ES log document, its rendered line, should line be printed after shipping (console after ES mode) and sink used when shipping fails
+type logItem struct {
+	entry    *logger.Log
+	line     string
+	console  bool
+	fallback LogSink
+}
+
+// logQueue - bounded queue of log messages shipped to ES in bulk by a single goroutine
+type logQueue struct {
+	cfg     logQueueConfig
+	items   chan logItem
+	flush   chan chan struct{}
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// SetLogQueue - configure async ES logging queue (see SetSyncMode)
+// size - max queued messages, batchSize - send when that many messages are queued, flushInterval - send queued messages at least that often
+// block - when queue is full: true - wait for free space (backpressure), false - drop message and increment DroppedLogs counter
+// Already queued messages are flushed before applying the new config
+func SetLogQueue(size, batchSize int, flushInterval time.Duration, block bool) {
+	if size <= 0 {
+		size = DefaultLogQueueSize
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultLogBatchSize
+	}
+	if flushInterval <= 0 {
+		flushInterval = DefaultLogFlushInterval
+	}
+	flushLogQueue()
+	gLogQueueMtx.Lock()
+	defer gLogQueueMtx.Unlock()
+	gLogQueueCfg = logQueueConfig{size: size, batchSize: batchSize, interval: flushInterval, block: block}
+	if gLogQueue != nil {
+		close(gLogQueue.stop)
+		gLogQueue = nil
+	}
+}
+
+// DroppedLogs - number of log messages dropped because async ES logging queue was full
+func DroppedLogs() int64 {
+	return atomic.LoadInt64(&gDroppedLogs)
+}
+
+// FlushLogs - send all queued log messages to ES and wait for it, then flush all log sinks, connectors should call it before exiting
+func FlushLogs() {
+	flushLogQueue()
+	flushLogSinks()
+}
+
+// flushLogQueue - send all queued log messages to ES and wait for it
+func flushLogQueue() {
+	gLogQueueMtx.Lock()
+	q := gLogQueue
+	gLogQueueMtx.Unlock()
+	if q == nil {
+		return
+	}
+	done := make(chan struct{})
+	// Queue can be stopped by SetLogQueue meanwhile, then wait until it ships queued messages
+	select {
+	case q.flush <- done:
+		<-done
+	case <-q.stopped:
+	}
+	dropped := DroppedLogs()
+	if atomic.SwapInt64(&gReportedLogs, dropped) != dropped {
+		log.Printf("%d log messages were dropped because ES logging queue was full\n", dropped)
+	}
+}
+
+// enqueueLog - add log message to the async ES logging queue, starts queue if needed
+func enqueueLog(item logItem) {
+	gLogQueueMtx.Lock()
+	if gLogQueue == nil {
+		gLogQueue = &logQueue{
+			cfg:     gLogQueueCfg,
+			items:   make(chan logItem, gLogQueueCfg.size),
+			flush:   make(chan chan struct{}),
+			stop:    make(chan struct{}),
+			stopped: make(chan struct{}),
+		}
+		go gLogQueue.run()
+	}
+	q := gLogQueue
+	gLogQueueMtx.Unlock()
+	if q.cfg.block {
+		q.items <- item
+		return
+	}
+	select {
+	case q.items <- item:
+	default:
+		atomic.AddInt64(&gDroppedLogs, 1)
+	}
+}
+
+func (q *logQueue) run() {
+	defer close(q.stopped)
+	ticker := time.NewTicker(q.cfg.interval)
+	defer ticker.Stop()
+	batch := []logItem{}
+	for {
+		select {
+		case item := <-q.items:
+			batch = append(batch, item)
+			if len(batch) >= q.cfg.batchSize {
+				q.ship(batch)
+				batch = []logItem{}
+			}
+		case <-ticker.C:
+			q.ship(batch)
+			batch = []logItem{}
+		case done := <-q.flush:
+			batch = q.drain(batch)
+			q.ship(batch)
+			batch = []logItem{}
+			close(done)
+		case <-q.stop:
+			q.ship(q.drain(batch))
+			return
+		}
+	}
+}
+
+// drain - read all currently queued messages, shipping full batches
+func (q *logQueue) drain(batch []logItem) []logItem {
+	for {
+		select {
+		case item := <-q.items:
+			batch = append(batch, item)
+			if len(batch) >= q.cfg.batchSize {
+				q.ship(batch)
+				batch = []logItem{}
+			}
+		default:
+			return batch
+		}
+	}
+}
+
+// ship - write batch to ES using a single bulk request
+func (q *logQueue) ship(batch []logItem) {
+	if len(batch) == 0 || gLogger == nil {
+		return
+	}
+	entries := make([]*logger.Log, 0, len(batch))
+	for _, item := range batch {
+		entries = append(entries, item.entry)
+	}
+	err := gLogger.WriteBatch(entries)
+	if err != nil && gLogLoggerError {
+		log.Printf("Error (log %d messages to ES): %s", len(entries), err.Error())
+	}
+	for _, item := range batch {
+		if err != nil && item.fallback != nil {
+			e := item.fallback.Write(item.line, item.entry)
+			if e != nil && gLogLoggerError {
+				log.Printf("Error (log to fallback sink): %s", e.Error())
+			}
+		}
+		if item.console {
+			e := gStdoutSink.Write(item.line, item.entry)
+			if e != nil && gLogLoggerError {
+				log.Printf("Error (log to console): %s", e.Error())
+			}
+		}
+	}
+}
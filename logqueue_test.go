@@ -0,0 +1,141 @@
+package ds
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LF-Engineering/insights-datasource-shared/elastic"
+	logger "github.com/LF-Engineering/insights-datasource-shared/ingestjob"
+	"github.com/stretchr/testify/assert"
+)
+
+type testLogProvider struct {
+	mtx     sync.Mutex
+	batches []int
+	docs    int
+	ids     map[string]struct{}
+}
+
+func (p *testLogProvider) CreateDocument(index, documentID string, body []byte) ([]byte, error) {
+	p.mtx.Lock()
+	p.docs++
+	p.mtx.Unlock()
+	return nil, nil
+}
+
+func (p *testLogProvider) Get(index string, query map[string]interface{}, result interface{}) error {
+	return nil
+}
+
+func (p *testLogProvider) BackOffGet(index string, query map[string]interface{}, result interface{}, attempts uint, delay time.Duration) error {
+	return nil
+}
+
+func (p *testLogProvider) UpdateDocument(index string, id string, body interface{}) ([]byte, error) {
+	return nil, nil
+}
+
+func (p *testLogProvider) Count(index string, query map[string]interface{}) (int, error) {
+	return 0, nil
+}
+
+func (p *testLogProvider) BulkInsert(data []elastic.BulkData) ([]byte, error) {
+	p.mtx.Lock()
+	p.batches = append(p.batches, len(data))
+	if p.ids == nil {
+		p.ids = make(map[string]struct{})
+	}
+	for _, d := range data {
+		p.ids[d.ID] = struct{}{}
+	}
+	p.mtx.Unlock()
+	return nil, nil
+}
+
+func TestLogQueue(t *testing.T) {
+	provider := &testLogProvider{}
+	esLogger, err := logger.NewLogger(provider, "test")
+	assert.Nil(t, err)
+	AddLogger(esLogger, "test", logger.Internal, []map[string]string{{"k": "v"}})
+	SetSyncMode(false, false)
+	SetLogQueue(100, 4, time.Hour, true)
+	defer func() {
+		SetLogQueue(0, 0, 0, false)
+		gLogger = nil
+	}()
+	for i := 0; i < 10; i++ {
+		Printf("message %d\n", i)
+	}
+	FlushLogs()
+	provider.mtx.Lock()
+	defer provider.mtx.Unlock()
+	total := 0
+	for _, n := range provider.batches {
+		assert.True(t, n <= 4)
+		total += n
+	}
+	assert.Equal(t, 10, total)
+	// Messages logged in the same second are separate documents
+	assert.Equal(t, 10, len(provider.ids))
+	assert.Equal(t, 0, provider.docs)
+	assert.Equal(t, int64(0), DroppedLogs())
+}
+
+func TestLogQueueFlushStopped(t *testing.T) {
+	provider := &testLogProvider{}
+	esLogger, err := logger.NewLogger(provider, "test")
+	assert.Nil(t, err)
+	AddLogger(esLogger, "test", logger.Internal, []map[string]string{{"k": "v"}})
+	SetSyncMode(false, false)
+	SetLogQueue(100, 100, time.Hour, true)
+	defer func() {
+		SetLogQueue(0, 0, 0, false)
+		gLogger = nil
+	}()
+	for i := 0; i < 3; i++ {
+		Printf("message %d\n", i)
+	}
+	// Queue stopped by SetLogQueue after FlushLogs got it, but before it requested the flush
+	gLogQueueMtx.Lock()
+	close(gLogQueue.stop)
+	gLogQueueMtx.Unlock()
+	flushed := make(chan struct{})
+	go func() {
+		FlushLogs()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("FlushLogs hangs on stopped queue")
+	}
+	gLogQueueMtx.Lock()
+	gLogQueue = nil
+	gLogQueueMtx.Unlock()
+	provider.mtx.Lock()
+	defer provider.mtx.Unlock()
+	assert.Equal(t, []int{3}, provider.batches)
+}
+
+func TestFatalOnErrorFlushesLogs(t *testing.T) {
+	provider := &testLogProvider{}
+	esLogger, err := logger.NewLogger(provider, "test")
+	assert.Nil(t, err)
+	AddLogger(esLogger, "test", logger.Internal, []map[string]string{{"k": "v"}})
+	SetSyncMode(false, false)
+	SetLogQueue(100, 100, time.Hour, true)
+	defer func() {
+		SetLogQueue(0, 0, 0, false)
+		gLogger = nil
+	}()
+	func() {
+		defer func() { assert.NotNil(t, recover()) }()
+		FatalOnError(fmt.Errorf("fatal test error"))
+	}()
+	provider.mtx.Lock()
+	defer provider.mtx.Unlock()
+	// Fatal message itself is shipped before panic
+	assert.Equal(t, []int{1}, provider.batches)
+}
@@ -0,0 +1,472 @@
+package ds
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	s3util "github.com/LF-Engineering/insights-datasource-shared/aws/s3"
+	logger "github.com/LF-Engineering/insights-datasource-shared/ingestjob"
+)
+
+const (
+	// LogSinkStdout - log messages are printed on console
+	LogSinkStdout = "stdout"
+	// LogSinkFile - log messages are appended to a local file rotated by size
+	LogSinkFile = "file"
+	// LogSinkES - log messages are sent to ES using logger added by AddLogger, local file is used when ES fails
+	LogSinkES = "es"
+	// LogSinkS3 - log messages are buffered and uploaded to S3 bucket in background and on flush (see FlushLogs), local file is used when upload fails
+	LogSinkS3 = "s3"
+	// DefaultLogFileMaxSize - default max size of log file (in MB) before it is rotated
+	DefaultLogFileMaxSize = 100
+	// DefaultLogFileBackups - default number of rotated log files kept
+	DefaultLogFileBackups = 5
+	// DefaultLogRegion - default AWS region used by s3 log sink
+	DefaultLogRegion = "us-east-2"
+	// DefaultLogS3BufferSize - s3 log sink uploads buffered messages in background when they exceed that many bytes
+	DefaultLogS3BufferSize = 8 << 20
+	// DefaultLogS3MaxBufferSize - s3 log sink never buffers more than that many bytes (when uploads fail and there is no fallback)
+	DefaultLogS3MaxBufferSize = 4 * DefaultLogS3BufferSize
+	// DefaultLogS3UploadTimeout - max time of a single s3 log sink upload
+	DefaultLogS3UploadTimeout = time.Minute
+)
+
+var (
+	gLogSinks    []LogSink
+	gLogFallback LogSink
+	gLogSinksMtx = &sync.RWMutex{}
+	gStdoutSink  = &StdoutLogSink{}
+)
+
+// LogSink - destination of log messages, line is a rendered (and redacted) message, entry is its ES log document
+// Flush is called by FlushLogs, sinks buffering messages should write them there
+type LogSink interface {
+	Write(line string, entry *logger.Log) error
+	Flush() error
+}
+
+// LogS3Manager - subset of aws/s3.Manager used by s3 log sink
+type LogS3Manager interface {
+	SaveWithKey(payload []byte, key string) error
+}
+
+// SetLogSinks - log messages will be written to those sinks, without sinks console and ES (if logger was added) are used
+func SetLogSinks(sinks ...LogSink) {
+	gLogSinksMtx.Lock()
+	gLogSinks = sinks
+	gLogSinksMtx.Unlock()
+}
+
+// LogSinks - returns sinks set by SetLogSinks
+func LogSinks() []LogSink {
+	gLogSinksMtx.RLock()
+	defer gLogSinksMtx.RUnlock()
+	return gLogSinks
+}
+
+// defaultLogSinks - console and ES (console after ES when SetSyncMode requested it)
+// ES falls back to the file sink set by InitLogSinks
+func defaultLogSinks() []LogSink {
+	gLogSinksMtx.RLock()
+	fallback := gLogFallback
+	gLogSinksMtx.RUnlock()
+	if gConsoleAfterES && gLogger != nil {
+		return []LogSink{&ESLogSink{Fallback: fallback, console: true}}
+	}
+	return []LogSink{gStdoutSink, &ESLogSink{Fallback: fallback}}
+}
+
+// flushLogSinks - flush all sinks, errors are logged using standard logger (logging them via sinks could fail again)
+func flushLogSinks() {
+	sinks := LogSinks()
+	if len(sinks) == 0 {
+		sinks = defaultLogSinks()
+	}
+	for _, sink := range sinks {
+		err := sink.Flush()
+		if err != nil {
+			log.Printf("Error (flush log sink %T): %s", sink, err.Error())
+		}
+	}
+}
+
+// ctxFileLogSink - file sink using ctx.LogFile (default is "{ds}.log"), ctx.LogFileMaxSize and ctx.LogFileBackups
+// File is not opened here, first Write opens it
+func ctxFileLogSink(ctx *Ctx) *FileLogSink {
+	path := ctx.LogFile
+	if path == "" {
+		path = strings.Replace(ctx.DS, " ", "_", -1) + ".log"
+	}
+	maxSize := ctx.LogFileMaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultLogFileMaxSize
+	}
+	return &FileLogSink{Path: path, MaxSize: int64(maxSize) << 20, MaxBackups: ctx.LogFileBackups, mtx: &sync.Mutex{}}
+}
+
+// NewLogSinks - creates sinks specified by ctx.LogSinks
+// ES and S3 sinks fall back to ctx.LogFile unless file sink is also used (then messages are already there)
+func NewLogSinks(ctx *Ctx) (sinks []LogSink, err error) {
+	var file *FileLogSink
+	fileSink := func() (*FileLogSink, error) {
+		if file != nil {
+			return file, nil
+		}
+		file = ctxFileLogSink(ctx)
+		return file, file.open()
+	}
+	useFile := false
+	for _, name := range ctx.LogSinks {
+		if name == LogSinkFile {
+			useFile = true
+		}
+	}
+	for _, name := range ctx.LogSinks {
+		switch name {
+		case LogSinkStdout:
+			sinks = append(sinks, gStdoutSink)
+		case LogSinkFile:
+			var sink *FileLogSink
+			sink, err = fileSink()
+			if err != nil {
+				return
+			}
+			sinks = append(sinks, sink)
+		case LogSinkES:
+			sink := &ESLogSink{}
+			if !useFile {
+				sink.Fallback, err = fileSink()
+				if err != nil {
+					return
+				}
+			}
+			sinks = append(sinks, sink)
+		case LogSinkS3:
+			if ctx.LogBucket == "" {
+				err = fmt.Errorf("%s log sink requires log-bucket to be set", LogSinkS3)
+				return
+			}
+			region := ctx.LogRegion
+			if region == "" {
+				region = DefaultLogRegion
+			}
+			// Uploads don't use context's cancellation, FlushLogs must still save logs on shutdown
+			manager := s3util.NewManager(ctx.LogBucket, region)
+			sink := NewS3LogSink(&logS3Manager{
+				timeout: DefaultLogS3UploadTimeout,
+				save: func(c context.Context, payload []byte, key string) error {
+					return manager.WithContext(c).SaveWithKey(payload, key)
+				},
+			}, ctx.DS)
+			if !useFile {
+				sink.Fallback, err = fileSink()
+				if err != nil {
+					return
+				}
+			}
+			sinks = append(sinks, sink)
+		default:
+			err = fmt.Errorf("unknown log sink '%s', supported: %s, %s, %s, %s", name, LogSinkStdout, LogSinkFile, LogSinkES, LogSinkS3)
+			return
+		}
+	}
+	return
+}
+
+// InitLogSinks - creates and sets sinks specified by ctx.LogSinks
+// When no sinks were specified default ones are used, ES falls back to ctx.LogFile (opened on first failure)
+func InitLogSinks(ctx *Ctx) (err error) {
+	if len(ctx.LogSinks) == 0 {
+		gLogSinksMtx.Lock()
+		gLogFallback = ctxFileLogSink(ctx)
+		gLogSinksMtx.Unlock()
+		return
+	}
+	sinks, err := NewLogSinks(ctx)
+	if err != nil {
+		return
+	}
+	SetLogSinks(sinks...)
+	return
+}
+
+// StdoutLogSink - prints log messages on console
+type StdoutLogSink struct{}
+
+// Write - print line
+func (s *StdoutLogSink) Write(line string, entry *logger.Log) error {
+	_, err := fmt.Printf("%s", line)
+	return err
+}
+
+// Flush - nothing to do, console is not buffered
+func (s *StdoutLogSink) Flush() error {
+	return nil
+}
+
+// ESLogSink - sends log messages to ES using logger added by AddLogger (does nothing when it wasn't added)
+// In async mode messages are queued and sent in bulk (see SetLogQueue), messages ES failed to store are written to Fallback (if set)
+type ESLogSink struct {
+	Fallback LogSink
+	console  bool
+}
+
+// Write - set entry's connector, configuration, status and date and send it to ES (or queue it)
+func (s *ESLogSink) Write(line string, entry *logger.Log) (err error) {
+	if gLogger == nil {
+		return
+	}
+	if entry.Connector == "" {
+		entry.Connector = gLoggerConnector
+	}
+	entry.Configuration = gLoggerConfiguration
+	entry.Status = gLoggerStatus
+	entry.CreatedAt = time.Now()
+	if !gSync {
+		enqueueLog(logItem{entry: entry, line: line, console: s.console, fallback: s.Fallback})
+		return
+	}
+	err = gLogger.Write(entry)
+	if err != nil && s.Fallback != nil {
+		e := s.Fallback.Write(line, entry)
+		if e != nil && gLogLoggerError {
+			log.Printf("Error (log to fallback sink): %s", e.Error())
+		}
+	}
+	if s.console {
+		e := gStdoutSink.Write(line, entry)
+		if e != nil && gLogLoggerError {
+			log.Printf("Error (log to console): %s", e.Error())
+		}
+	}
+	return
+}
+
+// Flush - flush fallback sink, queued messages are sent by FlushLogs
+func (s *ESLogSink) Flush() error {
+	if s.Fallback == nil {
+		return nil
+	}
+	return s.Fallback.Flush()
+}
+
+// FileLogSink - appends log messages to a file, file is rotated when it would exceed MaxSize bytes (0 means no rotation)
+// Rotated files are named path.1 (newest) ... path.MaxBackups (oldest), older ones are removed
+type FileLogSink struct {
+	Path       string
+	MaxSize    int64
+	MaxBackups int
+	file       *os.File
+	size       int64
+	mtx        *sync.Mutex
+}
+
+// NewFileLogSink - creates file sink, file is created (or opened for appending) here, so path errors are reported early
+func NewFileLogSink(path string, maxSize int64, maxBackups int) (s *FileLogSink, err error) {
+	s = &FileLogSink{Path: path, MaxSize: maxSize, MaxBackups: maxBackups, mtx: &sync.Mutex{}}
+	err = s.open()
+	return
+}
+
+func (s *FileLogSink) open() (err error) {
+	s.file, err = os.OpenFile(s.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	info, err := s.file.Stat()
+	if err != nil {
+		return
+	}
+	s.size = info.Size()
+	return
+}
+
+// rotate - close current file, shift backups and start a new file
+func (s *FileLogSink) rotate() (err error) {
+	err = s.file.Close()
+	if err != nil {
+		return
+	}
+	s.file = nil
+	if s.MaxBackups <= 0 {
+		err = os.Remove(s.Path)
+	} else {
+		_ = os.Remove(fmt.Sprintf("%s.%d", s.Path, s.MaxBackups))
+		for i := s.MaxBackups - 1; i >= 1; i-- {
+			_ = os.Rename(fmt.Sprintf("%s.%d", s.Path, i), fmt.Sprintf("%s.%d", s.Path, i+1))
+		}
+		err = os.Rename(s.Path, s.Path+".1")
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	return s.open()
+}
+
+// Write - append line to file, rotating it first if needed
+func (s *FileLogSink) Write(line string, entry *logger.Log) (err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.file == nil {
+		err = s.open()
+		if err != nil {
+			return
+		}
+	}
+	if s.MaxSize > 0 && s.size > 0 && s.size+int64(len(line)) > s.MaxSize {
+		err = s.rotate()
+		if err != nil {
+			return
+		}
+	}
+	n, err := s.file.WriteString(line)
+	s.size += int64(n)
+	return
+}
+
+// Flush - commit file contents to disk
+func (s *FileLogSink) Flush() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Sync()
+}
+
+// Close - close file, next Write opens it again
+func (s *FileLogSink) Close() (err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.file == nil {
+		return
+	}
+	err = s.file.Close()
+	s.file = nil
+	return
+}
+
+// logS3Manager - uploads each object using its own context with timeout
+type logS3Manager struct {
+	timeout time.Duration
+	save    func(ctx context.Context, payload []byte, key string) error
+}
+
+// SaveWithKey - upload payload as object key
+func (m *logS3Manager) SaveWithKey(payload []byte, key string) error {
+	c, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+	return m.save(c, payload, key)
+}
+
+// S3LogSink - buffers log messages and uploads them as "dads_logs/{prefix}/{start time}-{part}.log" objects
+// Buffer is uploaded on Flush, or in background when it exceeds DefaultLogS3BufferSize, so Write never waits for S3
+// Messages that failed to upload are written to Fallback (if set), otherwise they are kept, up to MaxBuffer bytes (oldest are dropped)
+type S3LogSink struct {
+	Fallback  LogSink
+	MaxBuffer int
+	manager   LogS3Manager
+	prefix    string
+	started   string
+	part      int
+	buffer    bytes.Buffer
+	uploading bool
+	mtx       *sync.Mutex
+	uploadMtx *sync.Mutex
+}
+
+// NewS3LogSink - creates S3 sink using manager
+func NewS3LogSink(manager LogS3Manager, prefix string) *S3LogSink {
+	return &S3LogSink{
+		MaxBuffer: DefaultLogS3MaxBufferSize,
+		manager:   manager,
+		prefix:    "dads_logs/" + strings.Replace(prefix, " ", "_", -1) + "/",
+		started:   time.Now().UTC().Format("20060102150405"),
+		mtx:       &sync.Mutex{},
+		uploadMtx: &sync.Mutex{},
+	}
+}
+
+// Write - buffer line, start background upload if buffer is big enough
+func (s *S3LogSink) Write(line string, entry *logger.Log) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	_, _ = s.buffer.WriteString(line)
+	s.trim()
+	if s.buffer.Len() < DefaultLogS3BufferSize || s.uploading {
+		return nil
+	}
+	s.uploading = true
+	go func() {
+		err := s.upload()
+		if err != nil && gLogLoggerError {
+			log.Printf("Error (upload logs to s3): %s", err.Error())
+		}
+		s.mtx.Lock()
+		s.uploading = false
+		s.mtx.Unlock()
+	}()
+	return nil
+}
+
+// Flush - upload buffered messages, waits for background upload in progress
+func (s *S3LogSink) Flush() error {
+	return s.upload()
+}
+
+// trim - drop oldest whole lines exceeding MaxBuffer, caller must hold s.mtx
+func (s *S3LogSink) trim() {
+	over := s.buffer.Len() - s.MaxBuffer
+	if s.MaxBuffer <= 0 || over <= 0 {
+		return
+	}
+	data := s.buffer.Bytes()
+	if i := bytes.IndexByte(data[over-1:], '\n'); i >= 0 {
+		over += i
+	} else {
+		over = len(data)
+	}
+	s.buffer.Next(over)
+}
+
+// upload - upload buffered messages as the next part, on failure they go to Fallback or back to the buffer
+func (s *S3LogSink) upload() (err error) {
+	s.uploadMtx.Lock()
+	defer s.uploadMtx.Unlock()
+	s.mtx.Lock()
+	payload := make([]byte, s.buffer.Len())
+	copy(payload, s.buffer.Bytes())
+	s.buffer.Reset()
+	s.mtx.Unlock()
+	if len(payload) == 0 {
+		return
+	}
+	key := fmt.Sprintf("%s%s-%05d.log", s.prefix, s.started, s.part)
+	err = s.manager.SaveWithKey(payload, key)
+	if err == nil {
+		s.part++
+		return
+	}
+	if s.Fallback != nil {
+		e := s.Fallback.Write(string(payload), &logger.Log{Message: string(payload)})
+		if e == nil {
+			err = fmt.Errorf("%v, messages written to fallback sink", err)
+			return
+		}
+		err = fmt.Errorf("%v, fallback sink: %v", err, e)
+	}
+	s.mtx.Lock()
+	rest := append([]byte(nil), s.buffer.Bytes()...)
+	s.buffer.Reset()
+	_, _ = s.buffer.Write(payload)
+	_, _ = s.buffer.Write(rest)
+	s.trim()
+	s.mtx.Unlock()
+	return
+}
@@ -0,0 +1,233 @@
+package ds
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LF-Engineering/insights-datasource-shared/elastic"
+	logger "github.com/LF-Engineering/insights-datasource-shared/ingestjob"
+	"github.com/stretchr/testify/assert"
+)
+
+type testLogS3Manager struct {
+	objects map[string]string
+	err     error
+	block   chan struct{}
+	mtx     sync.Mutex
+}
+
+func (m *testLogS3Manager) SaveWithKey(payload []byte, key string) error {
+	if m.block != nil {
+		<-m.block
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.objects[key] = string(payload)
+	return nil
+}
+
+type failingLogProvider struct {
+	testLogProvider
+}
+
+func (p *failingLogProvider) CreateDocument(index, documentID string, body []byte) ([]byte, error) {
+	return nil, fmt.Errorf("ES is down")
+}
+
+func (p *failingLogProvider) BulkInsert(data []elastic.BulkData) ([]byte, error) {
+	return nil, fmt.Errorf("ES is down")
+}
+
+func TestFileLogSinkRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logsink")
+	assert.Nil(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "test.log")
+	sink, err := NewFileLogSink(path, 10, 2)
+	assert.Nil(t, err)
+	for _, line := range []string{"line 1\n", "line 2\n", "line 3\n", "line 4\n"} {
+		assert.Nil(t, sink.Write(line, &logger.Log{}))
+	}
+	assert.Nil(t, sink.Close())
+	expected := map[string]string{path: "line 4\n", path + ".1": "line 3\n", path + ".2": "line 2\n"}
+	for file, content := range expected {
+		data, err := ioutil.ReadFile(file)
+		assert.Nil(t, err)
+		assert.Equal(t, content, string(data))
+	}
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestESLogSinkFallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logsink")
+	assert.Nil(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	ctx := &Ctx{DS: "test", LogSinks: []string{LogSinkES}, LogFile: filepath.Join(dir, "test.log")}
+	sinks, err := NewLogSinks(ctx)
+	assert.Nil(t, err)
+	esLogger, err := logger.NewLogger(&failingLogProvider{}, "test")
+	assert.Nil(t, err)
+	AddLogger(esLogger, "test", logger.Internal, nil)
+	SetLogSinks(sinks...)
+	defer func() {
+		SetLogSinks()
+		SetLogQueue(0, 0, 0, false)
+		gLogger = nil
+	}()
+	for _, sync := range []bool{true, false} {
+		SetSyncMode(sync, false)
+		Printf("sync %v\n", sync)
+	}
+	FlushLogs()
+	data, err := ioutil.ReadFile(ctx.LogFile)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), "sync true\n")
+	assert.Contains(t, string(data), "sync false\n")
+}
+
+func TestS3LogSink(t *testing.T) {
+	manager := &testLogS3Manager{objects: map[string]string{}}
+	sink := NewS3LogSink(manager, "test ds")
+	assert.Nil(t, sink.Flush())
+	assert.Equal(t, 0, len(manager.objects))
+	assert.Nil(t, sink.Write("a\n", &logger.Log{}))
+	assert.Nil(t, sink.Write("b\n", &logger.Log{}))
+	assert.Nil(t, sink.Flush())
+	assert.Equal(t, 1, len(manager.objects))
+	for key, content := range manager.objects {
+		assert.Equal(t, "dads_logs/test_ds/"+sink.started+"-00000.log", key)
+		assert.Equal(t, "a\nb\n", content)
+	}
+}
+
+func TestS3LogSinkBackgroundUpload(t *testing.T) {
+	block := make(chan struct{})
+	manager := &testLogS3Manager{objects: map[string]string{}, block: block}
+	sink := NewS3LogSink(manager, "test")
+	big := strings.Repeat("a", DefaultLogS3BufferSize-1) + "\n"
+	done := make(chan struct{})
+	go func() {
+		assert.Nil(t, sink.Write(big, &logger.Log{}))
+		assert.Nil(t, sink.Write("b\n", &logger.Log{}))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write waits for S3 upload")
+	}
+	close(block)
+	assert.Nil(t, sink.Flush())
+	keys := []string{}
+	for key := range manager.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	content := ""
+	for _, key := range keys {
+		content += manager.objects[key]
+	}
+	assert.Equal(t, big+"b\n", content)
+}
+
+func TestS3LogSinkUploadFailure(t *testing.T) {
+	manager := &testLogS3Manager{objects: map[string]string{}, err: fmt.Errorf("S3 is down")}
+	// Messages are spilled to fallback
+	fallback := &testLogSink{}
+	sink := NewS3LogSink(manager, "test")
+	sink.Fallback = fallback
+	assert.Nil(t, sink.Write("a\n", &logger.Log{}))
+	assert.NotNil(t, sink.Flush())
+	assert.Equal(t, []string{"a\n"}, fallback.lines)
+	assert.Equal(t, 0, sink.buffer.Len())
+	// Without fallback they are kept, oldest are dropped when buffer is full
+	sink = NewS3LogSink(manager, "test")
+	sink.MaxBuffer = 4
+	assert.Nil(t, sink.Write("a\n", &logger.Log{}))
+	assert.Nil(t, sink.Write("b\n", &logger.Log{}))
+	assert.NotNil(t, sink.Flush())
+	assert.Nil(t, sink.Write("c\n", &logger.Log{}))
+	manager.err = nil
+	assert.Nil(t, sink.Flush())
+	assert.Equal(t, map[string]string{"dads_logs/test/" + sink.started + "-00000.log": "b\nc\n"}, manager.objects)
+}
+
+func TestDefaultLogSinksFallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logsink")
+	assert.Nil(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	ctx := &Ctx{DS: "test", LogFile: filepath.Join(dir, "test.log")}
+	assert.Nil(t, InitLogSinks(ctx))
+	esLogger, err := logger.NewLogger(&failingLogProvider{}, "test")
+	assert.Nil(t, err)
+	AddLogger(esLogger, "test", logger.Internal, nil)
+	defer func() {
+		gLogSinksMtx.Lock()
+		gLogFallback = nil
+		gLogSinksMtx.Unlock()
+		SetSyncMode(true, false)
+		gLogger = nil
+	}()
+	assert.Equal(t, 0, len(LogSinks()))
+	// File is created only when ES fails
+	_, err = os.Stat(ctx.LogFile)
+	assert.True(t, os.IsNotExist(err))
+	SetSyncMode(true, false)
+	Printf("default sinks\n")
+	FlushLogs()
+	data, err := ioutil.ReadFile(ctx.LogFile)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(string(data), ": default sinks\n"))
+}
+
+func TestNewLogSinks(t *testing.T) {
+	_, err := NewLogSinks(&Ctx{DS: "test", LogSinks: []string{"syslog"}})
+	assert.NotNil(t, err)
+	_, err = NewLogSinks(&Ctx{DS: "test", LogSinks: []string{LogSinkS3}})
+	assert.NotNil(t, err)
+	sinks, err := NewLogSinks(&Ctx{DS: "test", LogSinks: []string{LogSinkStdout, LogSinkS3}, LogBucket: "bucket"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(sinks))
+}
+
+func TestNewLogSinksS3Cancelled(t *testing.T) {
+	ctx := &Ctx{DS: "test", LogSinks: []string{LogSinkS3}, LogBucket: "bucket"}
+	InitContext(ctx)
+	sinks, err := NewLogSinks(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(sinks))
+	objects := map[string]string{}
+	manager := sinks[0].(*S3LogSink).manager.(*logS3Manager)
+	manager.save = func(c context.Context, payload []byte, key string) error {
+		if err := c.Err(); err != nil {
+			return err
+		}
+		_, ok := c.Deadline()
+		assert.True(t, ok)
+		objects[key] = string(payload)
+		return nil
+	}
+	SetLogSinks(sinks...)
+	defer SetLogSinks()
+	// Connector is shutting down (SIGTERM), logs are still uploaded
+	ctx.Cancel()
+	assert.NotNil(t, GetContext(ctx).Err())
+	assert.Nil(t, sinks[0].Write("shutting down\n", &logger.Log{}))
+	FlushLogs()
+	assert.Equal(t, 1, len(objects))
+	for _, content := range objects {
+		assert.Equal(t, "shutting down\n", content)
+	}
+}
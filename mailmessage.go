@@ -0,0 +1,202 @@
+package ds
+
+import (
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MailMessage - message parsed by ParseMailMessage
+// Headers - decoded header values by header name (as found in the message), repeated headers have values in the original order
+// RawHeaders - values of headers changed by decoding RFC 2047 encoded-words, before decoding
+// MessageID, Subject - decoded Message-ID (MessageIDField) and Subject headers
+// From, To, Cc, ReplyTo - addresses parsed by ParseAddresses (at most MaxMessageAddresses)
+// Date - message date in UTC, DateInTZ - the same date in message's time zone, TZ - time zone offset in hours
+// Text, TextContentType - message text (see ParseMBoxMsg), Bodies - text/* and message/* parts decoded to UTF-8, Attachments - other parts (not decoded)
+// Valid - message has Message-ID and date, Warn - message was parsed, but some parts of it can be missing or wrong
+// Warnings - problems found while parsing, including reasons why message is not valid
+type MailMessage struct {
+	GroupName       string
+	DSType          string
+	MessageID       string
+	Subject         string
+	From            []*mail.Address
+	To              []*mail.Address
+	Cc              []*mail.Address
+	ReplyTo         []*mail.Address
+	Date            time.Time
+	DateInTZ        time.Time
+	TZ              float64
+	Headers         map[string][]string
+	RawHeaders      map[string][]string
+	Text            string
+	TextContentType string
+	Bodies          []*MailBody
+	Attachments     []*MailBody
+	Valid           bool
+	Warn            bool
+	Warnings        []string
+	BytesLength     int
+	NLines          int
+}
+
+// MailBody - single (non-multipart) part of a message
+// Num - part's position in the message, Headers - part's headers other than Content-Type
+// Data - part's contents truncated to MaxMessageBodyLength, FileName - from Content-Disposition filename or Content-Type name parameter
+type MailBody struct {
+	Num         int
+	ContentType string
+	MediaType   string
+	Headers     map[string][]string
+	Data        string
+	FileName    string
+}
+
+// IsAttachment - part is neither text/* nor message/*, such parts are not decoded
+func (b *MailBody) IsAttachment() bool {
+	return b.MediaType != "" && !strings.HasPrefix(b.MediaType, "text/") && !strings.HasPrefix(b.MediaType, "message/")
+}
+
+// mailHeaderValues - values of a header (names are case insensitive), header named exactly as requested is preferred
+func mailHeaderValues(headers map[string][]string, name string) []string {
+	if values, ok := headers[name]; ok {
+		return values
+	}
+	ks := []string{}
+	for k := range headers {
+		if strings.EqualFold(k, name) {
+			ks = append(ks, k)
+		}
+	}
+	if len(ks) == 0 {
+		return nil
+	}
+	sort.Strings(ks)
+	return headers[ks[0]]
+}
+
+// HeaderValues - decoded values of a header (names are case insensitive) in the original order
+func (m *MailMessage) HeaderValues(name string) []string {
+	return mailHeaderValues(m.Headers, name)
+}
+
+// Header - decoded value of a header (names are case insensitive), last value when header is repeated
+func (m *MailMessage) Header(name string) string {
+	values := m.HeaderValues(name)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
+
+// Parts - bodies and attachments in the message order
+func (m *MailMessage) Parts() []*MailBody {
+	parts := append(append([]*MailBody{}, m.Bodies...), m.Attachments...)
+	sort.SliceStable(parts, func(i, j int) bool { return parts[i].Num < parts[j].Num })
+	return parts
+}
+
+// mailReversed - single value or values in reverse order (last first), as stored by ParseMBoxMsg
+func mailReversed(values []string) interface{} {
+	if len(values) == 1 {
+		return values[0]
+	}
+	reversed := make([]string, len(values))
+	for i, v := range values {
+		reversed[len(values)-1-i] = v
+	}
+	return reversed
+}
+
+// Item - message in the map form returned by ParseMBoxMsg
+func (m *MailMessage) Item() (item map[string]interface{}) {
+	item = make(map[string]interface{})
+	item["MBox-Valid"] = m.Valid
+	item["MBox-Warn"] = m.Warn
+	item["MBox-Bytes-Length"] = m.BytesLength
+	item["MBox-Group-Name"] = m.GroupName
+	item["MBox-N-Lines"] = m.NLines
+	ks := []string{}
+	for k := range m.Headers {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	rawHeaders := make(map[string]interface{})
+	for _, k := range ks {
+		lk := strings.ToLower(k)
+		item[k] = mailReversed(m.Headers[k])
+		raw, changed := m.RawHeaders[k]
+		if changed {
+			rawHeaders[k] = mailReversed(raw)
+		} else {
+			raw = m.Headers[k]
+		}
+		// Message-ID and Date are also stored under lower case names, not decoded
+		if lk == MessageIDField[m.DSType] || lk == MessageDateField[m.DSType] {
+			item[lk] = raw[len(raw)-1]
+			if lk == k {
+				item[k+"-raw"] = mailReversed(raw)
+			}
+		}
+	}
+	item["MBox-Raw-Headers"] = rawHeaders
+	if !m.Valid {
+		return
+	}
+	parts := m.Parts()
+	item[MessageDateField[m.DSType]] = m.Date
+	item["date_tz"] = m.TZ
+	item["date_in_tz"] = m.DateInTZ
+	item["MBox-N-Bodies"] = len(parts)
+	bodyKeys := make(map[string]struct{})
+	item["data"] = make(map[string]interface{})
+	for _, part := range parts {
+		ary := strings.Split(part.ContentType, ";")
+		props := strings.Split(strings.TrimSpace(ary[0]), "/")
+		for i := range props {
+			props[i] = strings.TrimSpace(props[i])
+		}
+		b := make(map[string]interface{})
+		b["data"] = part.Data
+		b["content-type"] = part.ContentType
+		headers := make(map[string]interface{})
+		for k, v := range part.Headers {
+			if len(v) == 1 {
+				headers[k] = v[0]
+			} else {
+				headers[k] = v
+			}
+		}
+		b["headers"] = headers
+		b["num"] = part.Num
+		path := []string{"data"}
+		path = append(path, props...)
+		key := strings.Join(path, "/")
+		_, ok := bodyKeys[key]
+		if !ok {
+			FatalOnError(DeepSet(item, path, []interface{}{b}, true))
+			bodyKeys[key] = struct{}{}
+		} else {
+			iface, _ := Dig(item, path, true, false)
+			ifary, _ := iface.([]interface{})
+			ifary = append(ifary, b)
+			FatalOnError(DeepSet(item, path, ifary, true))
+		}
+	}
+	item["MBox-Text"] = m.Text
+	item["MBox-Text-Content-Type"] = m.TextContentType
+	if MBoxDropXFields {
+		ks := []string{}
+		for k := range item {
+			if strings.HasPrefix(strings.ToLower(k), "x-") {
+				ks = append(ks, k)
+			}
+		}
+		for _, k := range ks {
+			delete(item, k)
+			delete(rawHeaders, k)
+		}
+	}
+	return
+}
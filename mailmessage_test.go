@@ -0,0 +1,85 @@
+package ds
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMailMessage(t *testing.T) {
+	lines := []string{
+		"From a@b.c Mon Jan  4 10:00:00 2021\nMessage-ID: <1@b.c>",
+		"Date: Mon, 4 Jan 2021 10:00:00 +0100",
+		"Subject: =?UTF-8?B?w7xiZXI=?=",
+		"From: =?UTF-8?Q?Doe=2C_J=C3=B6hn?= <john@doe.com>",
+		"To: a@b.c, Bob <bob@b.c>",
+		"X-Mailer: test",
+		`Content-Type: multipart/mixed; boundary="outer"`,
+		"",
+		"--outer",
+		"Content-Type: text/plain; charset=iso-8859-1",
+		"Content-Transfer-Encoding: quoted-printable",
+		"",
+		"caf=E9",
+		"--outer",
+		"Content-Type: application/pdf; name=a.pdf",
+		`Content-Disposition: attachment; filename="b.pdf"`,
+		"Content-Transfer-Encoding: base64",
+		"",
+		"JVBERi0=",
+		"--outer--",
+		"",
+	}
+	msg := []byte(strings.Join(lines, "\r\n"))
+	m := ParseMailMessage(&Ctx{}, "group", msg, "default")
+	assert.True(t, m.Valid)
+	assert.False(t, m.Warn)
+	assert.Empty(t, m.Warnings)
+	assert.Equal(t, "<1@b.c>", m.MessageID)
+	assert.Equal(t, "über", m.Subject)
+	assert.Equal(t, "test", m.Header("x-mailer"))
+	assert.Equal(t, []string{"=?UTF-8?B?w7xiZXI=?="}, m.RawHeaders["Subject"])
+	assert.Equal(t, 1, len(m.From))
+	assert.Equal(t, "Doe, Jöhn", m.From[0].Name)
+	assert.Equal(t, "john@doe.com", m.From[0].Address)
+	assert.Equal(t, 2, len(m.To))
+	assert.Equal(t, "Bob", m.To[1].Name)
+	assert.Equal(t, time.Date(2021, 1, 4, 9, 0, 0, 0, time.UTC), m.Date)
+	assert.Equal(t, 1.0, m.TZ)
+	assert.Equal(t, "café", m.Text)
+	assert.Equal(t, 1, len(m.Bodies))
+	assert.Equal(t, "text/plain", m.Bodies[0].MediaType)
+	assert.Equal(t, 1, len(m.Attachments))
+	assert.Equal(t, 1, m.Attachments[0].Num)
+	assert.Equal(t, "b.pdf", m.Attachments[0].FileName)
+	assert.Equal(t, "JVBERi0=", m.Attachments[0].Data)
+	// Map form
+	item, valid, warn := ParseMBoxMsg(&Ctx{}, "group", msg, "default")
+	assert.True(t, valid)
+	assert.False(t, warn)
+	assert.Equal(t, item, m.Item())
+	assert.Equal(t, 2, item["MBox-N-Bodies"])
+	assert.Equal(t, m.Date, item["date"])
+	assert.Equal(t, 1.0, item["date_tz"])
+	_, ok := item["X-Mailer"]
+	assert.False(t, ok)
+	pdf, _ := Dig(item, []string{"data", "application", "pdf"}, true, false)
+	assert.Equal(t, 1, pdf.([]interface{})[0].(map[string]interface{})["num"])
+}
+
+func TestParseMailMessageInvalid(t *testing.T) {
+	msg := []byte("From a@b.c Mon Jan  4 10:00:00 2021\nSubject: no id\r\n\r\nbody")
+	m := ParseMailMessage(&Ctx{}, "group", msg, "default")
+	// Invalid messages are dumped for inspection
+	_ = os.Remove("group_58.mbox")
+	assert.False(t, m.Valid)
+	assert.Equal(t, []string{"group(58): missing Message-ID field"}, m.Warnings)
+	item := m.Item()
+	assert.Equal(t, false, item["MBox-Valid"])
+	assert.Equal(t, "no id", item["Subject"])
+	_, ok := item["data"]
+	assert.False(t, ok)
+}
@@ -0,0 +1,337 @@
+package ds
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// MailSubjectPrefixRE - reply/forward prefixes ("Re:", "Fwd:", "Re[2]:", localized "AW:", "SV:", ...) and list tags ("[list]") removed from subjects when threading
+	MailSubjectPrefixRE = regexp.MustCompile(`(?i)^\s*(?:(?:re|fwd?|aw|sv|wg|vs|antw|odp|tr)\s*(?:\[\d+\]|\(\d+\))?\s*:|\[[^\]]*\])\s*`)
+	// mailMessageIDRE - <message-id> in Message-ID, In-Reply-To and References headers
+	mailMessageIDRE = regexp.MustCompile(`<[^<>\s]+>`)
+)
+
+// MailThreadInfo - position of a message in its conversation thread
+// ThreadID - message-id of thread's root (it can be a missing message referenced by replies), root message id for threads grouped by subject only
+// RootID - message-id of the thread's root message: the first existing message at the lowest depth
+// ParentID - message-id of the message this one replies to (it can be missing), empty for root
+// Depth - number of ancestors (including missing ones), 0 for root
+// Replies - number of direct replies, AllReplies - number of all messages in replies subtree (both only count existing messages)
+// Size - number of existing messages in the thread
+type MailThreadInfo struct {
+	ThreadID   string
+	RootID     string
+	ParentID   string
+	Depth      int
+	Replies    int
+	AllReplies int
+	Size       int
+}
+
+// mailContainer - JWZ threading container, item is nil for messages referenced but not present (and for subject grouping containers)
+type mailContainer struct {
+	id       string
+	item     map[string]interface{}
+	index    int
+	date     time.Time
+	subject  string
+	isReply  bool
+	parent   *mailContainer
+	children []*mailContainer
+}
+
+// NormalizeMailSubject - remove reply/forward prefixes and list tags, collapse whitespace, returns normalized subject and if any prefix was removed
+func NormalizeMailSubject(subject string) (normalized string, isReply bool) {
+	normalized = strings.TrimSpace(SpacesRE.ReplaceAllString(subject, " "))
+	for {
+		loc := MailSubjectPrefixRE.FindStringIndex(normalized)
+		if loc == nil || loc[1] == 0 {
+			break
+		}
+		if !strings.HasPrefix(strings.TrimSpace(normalized[:loc[1]]), "[") {
+			isReply = true
+		}
+		normalized = normalized[loc[1]:]
+	}
+	return
+}
+
+// mailItemHeader - header value from item parsed by ParseMBoxMsg (header names are case insensitive), last value when header is repeated
+func mailItemHeader(item map[string]interface{}, name string) string {
+	v, ok := item[name]
+	if !ok {
+		for k, iv := range item {
+			if strings.EqualFold(k, name) {
+				v, ok = iv, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return ""
+	}
+	switch value := v.(type) {
+	case string:
+		return value
+	case []string:
+		// ParseMBoxMsg stores repeated headers in reverse order
+		if len(value) > 0 {
+			return value[0]
+		}
+	}
+	return ""
+}
+
+// mailMessageIDs - message ids from header value, whitespace separated values are used when there are no <...> ids
+func mailMessageIDs(value string) []string {
+	ids := mailMessageIDRE.FindAllString(value, -1)
+	if len(ids) > 0 {
+		return ids
+	}
+	return strings.Fields(value)
+}
+
+// mailIsAncestor - is a an ancestor of c (or c itself)?
+func mailIsAncestor(a, c *mailContainer) bool {
+	for ; c != nil; c = c.parent {
+		if c == a {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *mailContainer) removeChild(child *mailContainer) {
+	for i, ch := range c.children {
+		if ch == child {
+			c.children = append(c.children[:i], c.children[i+1:]...)
+			break
+		}
+	}
+	child.parent = nil
+}
+
+func (c *mailContainer) addChild(child *mailContainer) {
+	if child.parent != nil {
+		child.parent.removeChild(child)
+	}
+	child.parent = c
+	c.children = append(c.children, child)
+}
+
+// ThreadMessages - reconstruct conversation threads of items parsed by ParseMBoxMsg using JWZ algorithm (https://www.jwz.org/doc/threading.html)
+// Messages are keyed by MessageIDField[dsType], parents come from References and In-Reply-To headers,
+// threads whose roots are missing are grouped by normalized subject (see NormalizeMailSubject)
+// Returns thread info for each item (nil for items without message-id)
+func ThreadMessages(items []map[string]interface{}, dsType string) (infos []*MailThreadInfo) {
+	infos = make([]*MailThreadInfo, len(items))
+	idTable := make(map[string]*mailContainer)
+	getContainer := func(id string) *mailContainer {
+		c, ok := idTable[id]
+		if !ok {
+			c = &mailContainer{id: id, index: -1}
+			idTable[id] = c
+		}
+		return c
+	}
+	containers := []*mailContainer{}
+	for i, item := range items {
+		ids := mailMessageIDs(mailItemHeader(item, MessageIDField[dsType]))
+		if len(ids) == 0 {
+			continue
+		}
+		id := ids[0]
+		c := getContainer(id)
+		if c.item != nil {
+			// Duplicate message-id, thread it as a separate message
+			c = &mailContainer{id: id, index: -1}
+		}
+		c.item, c.index = item, i
+		c.date, _ = item[MessageDateField[dsType]].(time.Time)
+		c.subject, c.isReply = NormalizeMailSubject(mailItemHeader(item, "subject"))
+		containers = append(containers, c)
+		// References (oldest first) then In-Reply-To
+		refs := mailMessageIDs(mailItemHeader(item, "references"))
+		inReplyTo := mailMessageIDs(mailItemHeader(item, "in-reply-to"))
+		if len(inReplyTo) > 0 && (len(refs) == 0 || refs[len(refs)-1] != inReplyTo[0]) {
+			refs = append(refs, inReplyTo[0])
+		}
+		var prev *mailContainer
+		for _, ref := range refs {
+			if ref == id {
+				continue
+			}
+			rc := getContainer(ref)
+			// Don't change existing links and don't create loops
+			if prev != nil && rc.parent == nil && !mailIsAncestor(rc, prev) {
+				prev.addChild(rc)
+			}
+			prev = rc
+		}
+		// The last reference is this message's parent, even if it had another one
+		if c.parent != nil {
+			c.parent.removeChild(c)
+		}
+		if prev != nil && !mailIsAncestor(c, prev) {
+			prev.addChild(c)
+		}
+	}
+	// Root set
+	roots := []*mailContainer{}
+	seen := make(map[*mailContainer]struct{})
+	addRoot := func(c *mailContainer) {
+		for c.parent != nil {
+			c = c.parent
+		}
+		if _, ok := seen[c]; !ok {
+			seen[c] = struct{}{}
+			roots = append(roots, c)
+		}
+	}
+	for _, c := range containers {
+		addRoot(c)
+	}
+	// Prune empty containers
+	var prune func(c *mailContainer, isRoot bool) []*mailContainer
+	prune = func(c *mailContainer, isRoot bool) []*mailContainer {
+		children := []*mailContainer{}
+		for _, child := range c.children {
+			children = append(children, prune(child, false)...)
+		}
+		c.children = nil
+		for _, child := range children {
+			child.parent = c
+			c.children = append(c.children, child)
+		}
+		if c.item != nil || (isRoot && len(c.children) > 1) {
+			return []*mailContainer{c}
+		}
+		// Empty container: delete it and promote its children one level up (single child of an empty root becomes root)
+		for _, child := range c.children {
+			child.parent = nil
+		}
+		return c.children
+	}
+	pruned := []*mailContainer{}
+	for _, root := range roots {
+		pruned = append(pruned, prune(root, true)...)
+	}
+	roots = pruned
+	// Group root set by subject
+	rootSubject := func(c *mailContainer) (string, bool) {
+		if c.item == nil && len(c.children) > 0 {
+			return c.children[0].subject, c.children[0].isReply
+		}
+		return c.subject, c.isReply
+	}
+	subjects := make(map[string]*mailContainer)
+	for _, root := range roots {
+		subject, isReply := rootSubject(root)
+		if subject == "" {
+			continue
+		}
+		old, ok := subjects[subject]
+		if !ok || (root.item == nil && old.item != nil) {
+			subjects[subject] = root
+			continue
+		}
+		if _, oldIsReply := rootSubject(old); old.item != nil && root.item != nil && oldIsReply && !isReply {
+			subjects[subject] = root
+		}
+	}
+	for _, root := range roots {
+		subject, isReply := rootSubject(root)
+		that, ok := subjects[subject]
+		if subject == "" || !ok || that == root {
+			continue
+		}
+		_, thatIsReply := rootSubject(that)
+		switch {
+		case root.item == nil && that.item == nil:
+			for _, child := range append([]*mailContainer{}, root.children...) {
+				that.addChild(child)
+			}
+		case that.item == nil:
+			that.addChild(root)
+		case isReply && !thatIsReply:
+			that.addChild(root)
+		default:
+			// Neither is a reply to the other, make them siblings
+			group := &mailContainer{index: -1}
+			subjects[subject] = group
+			group.addChild(that)
+			group.addChild(root)
+		}
+	}
+	// Thread info, merging only moved roots under other containers, so final roots are tops of the current ones
+	seen = make(map[*mailContainer]struct{})
+	for _, root := range roots {
+		for root.parent != nil {
+			root = root.parent
+		}
+		if _, ok := seen[root]; ok || (root.item == nil && len(root.children) == 0) {
+			continue
+		}
+		seen[root] = struct{}{}
+		members := []*mailContainer{}
+		var walk func(c *mailContainer, depth int) int
+		walk = func(c *mailContainer, depth int) (n int) {
+			sort.SliceStable(c.children, func(i, j int) bool { return c.children[i].date.Before(c.children[j].date) })
+			replies := 0
+			for _, child := range c.children {
+				if child.item != nil {
+					replies++
+				}
+				n += walk(child, depth+1)
+			}
+			if c.item != nil {
+				parentID := ""
+				if c.parent != nil {
+					parentID = c.parent.id
+				}
+				infos[c.index] = &MailThreadInfo{ParentID: parentID, Depth: depth, Replies: replies, AllReplies: n}
+				members = append(members, c)
+				n++
+			}
+			return
+		}
+		size := walk(root, 0)
+		var rootMsg *mailContainer
+		for _, m := range members {
+			if rootMsg == nil || infos[m.index].Depth < infos[rootMsg.index].Depth || (infos[m.index].Depth == infos[rootMsg.index].Depth && m.date.Before(rootMsg.date)) {
+				rootMsg = m
+			}
+		}
+		threadID := root.id
+		if threadID == "" {
+			threadID = rootMsg.id
+		}
+		for _, m := range members {
+			infos[m.index].ThreadID = threadID
+			infos[m.index].RootID = rootMsg.id
+			infos[m.index].Size = size
+		}
+	}
+	return
+}
+
+// AddMailThreads - reconstruct threads of items parsed by ParseMBoxMsg (see ThreadMessages) and add thread info to them
+// as MBox-Thread-ID, MBox-Thread-Root, MBox-Thread-Parent, MBox-Thread-Depth, MBox-Thread-Replies, MBox-Thread-All-Replies and MBox-Thread-Size
+func AddMailThreads(items []map[string]interface{}, dsType string) {
+	for i, info := range ThreadMessages(items, dsType) {
+		if info == nil {
+			continue
+		}
+		item := items[i]
+		item["MBox-Thread-ID"] = info.ThreadID
+		item["MBox-Thread-Root"] = info.RootID
+		item["MBox-Thread-Parent"] = info.ParentID
+		item["MBox-Thread-Depth"] = info.Depth
+		item["MBox-Thread-Replies"] = info.Replies
+		item["MBox-Thread-All-Replies"] = info.AllReplies
+		item["MBox-Thread-Size"] = info.Size
+	}
+}
@@ -0,0 +1,94 @@
+package ds
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeMailSubject(t *testing.T) {
+	var testCases = []struct {
+		in       string
+		expected string
+		isReply  bool
+	}{
+		{in: "Hello  world", expected: "Hello world"},
+		{in: "Re: Hello", expected: "Hello", isReply: true},
+		{in: "RE: [list] Fwd:  Re[2]: Hello", expected: "Hello", isReply: true},
+		{in: "[list] Hello", expected: "Hello"},
+		{in: "AW: Hello", expected: "Hello", isReply: true},
+		{in: "Regarding: Hello", expected: "Regarding: Hello"},
+	}
+	for _, tc := range testCases {
+		got, isReply := NormalizeMailSubject(tc.in)
+		assert.Equal(t, tc.expected, got, tc.in)
+		assert.Equal(t, tc.isReply, isReply, tc.in)
+	}
+}
+
+func TestThreadMessages(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2021, 1, d, 0, 0, 0, 0, time.UTC) }
+	msg := func(id, subject string, d int, headers ...string) map[string]interface{} {
+		item := map[string]interface{}{"message-id": id, "Subject": subject, "date": day(d)}
+		for i := 0; i+1 < len(headers); i += 2 {
+			item[headers[i]] = headers[i+1]
+		}
+		return item
+	}
+	items := []map[string]interface{}{
+		// 0: root, 1 and 2 reply to it, 3 replies to 1 (only References)
+		msg("<a@x>", "Topic", 1),
+		msg("<b@x>", "Re: Topic", 2, "In-Reply-To", "<a@x>"),
+		msg("<c@x>", "Re: Topic", 3, "In-Reply-To", "<a@x>", "References", "<a@x>"),
+		msg("<d@x>", "Re: Topic", 4, "References", "<a@x> <b@x>"),
+		// 4 and 5 reply to missing <m@x>
+		msg("<e@x>", "Re: Lost", 5, "In-Reply-To", "<m@x>"),
+		msg("<f@x>", "Re: Lost", 6, "References", "<m@x>"),
+		// 6 has no references, but its subject matches 7 which is not a reply
+		msg("<g@x>", "Re: Other", 8),
+		msg("<h@x>", "Other", 7),
+		// 8 has no message id
+		{"Subject": "no id"},
+	}
+	infos := ThreadMessages(items, "default")
+	assert.Nil(t, infos[8])
+	expected := []MailThreadInfo{
+		{ThreadID: "<a@x>", RootID: "<a@x>", Depth: 0, Replies: 2, AllReplies: 3, Size: 4},
+		{ThreadID: "<a@x>", RootID: "<a@x>", ParentID: "<a@x>", Depth: 1, Replies: 1, AllReplies: 1, Size: 4},
+		{ThreadID: "<a@x>", RootID: "<a@x>", ParentID: "<a@x>", Depth: 1, Size: 4},
+		{ThreadID: "<a@x>", RootID: "<a@x>", ParentID: "<b@x>", Depth: 2, Size: 4},
+		{ThreadID: "<m@x>", RootID: "<e@x>", ParentID: "<m@x>", Depth: 1, Size: 2},
+		{ThreadID: "<m@x>", RootID: "<e@x>", ParentID: "<m@x>", Depth: 1, Size: 2},
+		{ThreadID: "<h@x>", RootID: "<h@x>", ParentID: "<h@x>", Depth: 1, Size: 2},
+		{ThreadID: "<h@x>", RootID: "<h@x>", Depth: 0, Replies: 1, AllReplies: 1, Size: 2},
+	}
+	for i, exp := range expected {
+		assert.Equal(t, exp, *infos[i], items[i]["message-id"])
+	}
+	AddMailThreads(items, "default")
+	assert.Equal(t, "<a@x>", items[3]["MBox-Thread-ID"])
+	assert.Equal(t, 2, items[3]["MBox-Thread-Depth"])
+	_, ok := items[8]["MBox-Thread-ID"]
+	assert.False(t, ok)
+}
+
+func TestThreadMessagesLoopsAndSubjects(t *testing.T) {
+	items := []map[string]interface{}{
+		{"message-id": "<a@x>", "Subject": "Loop", "References": "<b@x>"},
+		{"message-id": "<b@x>", "Subject": "Re: Loop", "References": "<a@x>"},
+		{"message-id": "<c@x>", "Subject": "Same"},
+		{"message-id": "<d@x>", "Subject": "Same"},
+	}
+	infos := ThreadMessages(items, "default")
+	for _, info := range infos {
+		assert.NotNil(t, info)
+	}
+	assert.Equal(t, infos[0].ThreadID, infos[1].ThreadID)
+	assert.Equal(t, 2, infos[0].Size)
+	// Two non-reply messages with the same subject become siblings
+	assert.Equal(t, infos[2].ThreadID, infos[3].ThreadID)
+	assert.Equal(t, 1, infos[2].Depth)
+	assert.Equal(t, 1, infos[3].Depth)
+	assert.Equal(t, "", infos[2].ParentID)
+}
@@ -2,7 +2,9 @@ package ds
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
+	"net/mail"
 	"regexp"
 	"sort"
 	"strconv"
@@ -61,10 +63,12 @@ var (
 	// TZOffsetRE - time zone offset that comes after +0... +1... -0... -1...
 	// Can be 3 disgits or 3 digits then whitespace and then anything
 	TZOffsetRE = regexp.MustCompile(`^(\d{3})(\s+.*$|$)`)
-	// MBoxMsgSeparator - used to split mbox file into separate messages
+	// MBoxMsgSeparator - used to split mbox file into separate messages, MBoxReader is more reliable (and doesn't need the whole file in memory)
 	MBoxMsgSeparator = map[string][]byte{"default": []byte("\nFrom "), "groupsio": []byte("\nFrom ")}
 	// MsgLineSeparator - used to split mbox message into its separate lines
 	MsgLineSeparator = map[string][]byte{"default": []byte("\r\n"), "groupsio": []byte("\r\n")}
+	// MBoxAddressHeaders - lower case names of headers containing address lists, their decoded display names are quoted when needed
+	MBoxAddressHeaders = map[string]struct{}{"from": {}, "to": {}, "cc": {}, "bcc": {}, "reply-to": {}, "sender": {}}
 	// MaxMessageProperties - maximum properties that can be set on the message object
 	MaxMessageProperties = map[string]int{"default": 500, "groupsio": 500}
 	// MessageIDField - message ID field from email
@@ -73,20 +77,38 @@ var (
 	MessageDateField = map[string]string{"default": "date", "groupsio": "date"}
 	// MessageReceivedField - message Received filed
 	MessageReceivedField = map[string]string{"default": "received", "groupsio": "received"}
+	// MaxMessageAddresses - maximum number of addresses parsed from each of From, To, Cc and Reply-To headers into MailMessage
+	MaxMessageAddresses = map[string]int{"default": 100, "groupsio": 100}
 	// MaxMessageBodyLength - trucacte message bodies longer than this (per each multi-body email part)
 	MaxMessageBodyLength = map[string]int{"default": 0x1000, "groupsio": 0x4000}
 )
 
 // ParseMBoxMsg - parse a raw MBox message into object to be inserte dinto raw ES
+// It returns message parsed by ParseMailMessage in the map form (see MailMessage.Item)
 func ParseMBoxMsg(ctx *Ctx, groupName string, msg []byte, dsType string) (item map[string]interface{}, valid, warn bool) {
-	item = make(map[string]interface{})
+	m := ParseMailMessage(ctx, groupName, msg, dsType)
+	return m.Item(), m.Valid, m.Warn
+}
+
+// ParseMailMessage - parse a raw MBox message into MailMessage, problems found are logged and added to its Warnings
+func ParseMailMessage(ctx *Ctx, groupName string, msg []byte, dsType string) (m *MailMessage) {
+	m = &MailMessage{
+		GroupName:   groupName,
+		DSType:      dsType,
+		BytesLength: len(msg),
+		Headers:     make(map[string][]string),
+		RawHeaders:  make(map[string][]string),
+	}
 	raw := make(map[string][][]byte)
+	valid, warn := false, false
 	defer func() {
-		item["MBox-Valid"] = valid
-		item["MBox-Warn"] = warn
+		m.Valid = valid
+		m.Warn = warn
 	}()
-	item["MBox-Bytes-Length"] = len(msg)
-	item["MBox-Group-Name"] = groupName
+	warnf := func(format string, args ...interface{}) {
+		Printf(format, args...)
+		m.Warnings = append(m.Warnings, strings.TrimSpace(fmt.Sprintf(format, args...)))
+	}
 	dumpMBox := func() {
 		fn := groupName + "_" + strconv.Itoa(len(msg)) + ".mbox"
 		_ = ioutil.WriteFile(fn, msg, 0644)
@@ -130,7 +152,7 @@ func ParseMBoxMsg(ctx *Ctx, groupName string, msg []byte, dsType string) (item m
 		return
 	}
 	lines := bytes.Split(msg, MsgLineSeparator[dsType])
-	item["MBox-N-Lines"] = len(lines)
+	m.NLines = len(lines)
 	boundary := []byte("")
 	isContinue := func(i int, line []byte) (is bool) {
 		is = bytes.HasPrefix(line, []byte(" ")) || bytes.HasPrefix(line, []byte("\t"))
@@ -209,21 +231,23 @@ func ParseMBoxMsg(ctx *Ctx, groupName string, msg []byte, dsType string) (item m
 		return
 	}
 	boundarySep := []byte("boundary=")
+	isMultipart := func(contentType []byte) bool {
+		return bytes.HasPrefix(bytes.ToLower(bytes.TrimSpace(contentType)), []byte("multipart/"))
+	}
+	// Multipart containers (their preambles and epilogues) are not added as bodies, current body is reset anyway
 	addBody := func(i int, line []byte) (added bool) {
-		if len(currContentType) == 0 || len(currData) == 0 {
-			return
-		}
 		defer func() {
-			if bytes.HasSuffix(currData, []byte("\n")) {
-				currData = currData[:len(currData)-1]
-			}
-			if ctx.Debug > 2 {
-				Printf("message(%d,%s,%s): '%s'\n", len(msg), string(currContentType), propertiesString(currProperties), string(currData))
-			}
 			currContentType = []byte{}
 			currProperties = make(map[string][][]byte)
 			currData = []byte{}
 		}()
+		if len(currContentType) == 0 || len(currData) == 0 || isMultipart(currContentType) {
+			return
+		}
+		currData = bytes.TrimRight(currData, "\n")
+		if ctx.Debug > 2 {
+			Printf("message(%d,%s,%s): '%s'\n", len(msg), string(currContentType), propertiesString(currProperties), string(currData))
+		}
 		bodies = append(bodies, Body{ContentType: currContentType, Properties: currProperties, Data: currData})
 		added = true
 		return
@@ -240,7 +264,7 @@ func ParseMBoxMsg(ctx *Ctx, groupName string, msg []byte, dsType string) (item m
 	pop := func() {
 		n := len(savedContentType) - 1
 		if n < 0 {
-			Printf("%s(%d): cannot pop from an empty stack\n", groupName, len(msg))
+			warnf("%s(%d): cannot pop from an empty stack\n", groupName, len(msg))
 			warn = true
 			return
 		}
@@ -255,6 +279,7 @@ func ParseMBoxMsg(ctx *Ctx, groupName string, msg []byte, dsType string) (item m
 	currKey := ""
 	body := false
 	bodyHeadersParsed := false
+	partHeaders := false
 	nLines := len(lines)
 	nSkip := 0
 	var mainMultipart *bool
@@ -307,7 +332,7 @@ func ParseMBoxMsg(ctx *Ctx, groupName string, msg []byte, dsType string) (item m
 						}
 					}
 					if len(boundary) == 0 {
-						Printf("#%d cannot find multipart message boundary(%s,%d) '%s'\n", i, groupName, len(msg), string(contentType))
+						warnf("#%d cannot find multipart message boundary(%s,%d) '%s'\n", i, groupName, len(msg), string(contentType))
 						warn = true
 					}
 					if mainMultipart == nil {
@@ -337,10 +362,18 @@ func ParseMBoxMsg(ctx *Ctx, groupName string, msg []byte, dsType string) (item m
 				body = true
 				continue
 			}
-			// we could possibly assume that header is parsed when empty line is met, but this is not so simple
-			if bodyHeadersParsed {
-				currData = append(currData, []byte("\n")...)
+			// Empty line ends part headers (unless they are nested multipart headers), part without Content-Type is text/plain
+			if !bodyHeadersParsed {
+				if partHeaders {
+					partHeaders = false
+					if len(currContentType) == 0 {
+						currContentType = []byte("text/plain")
+					}
+					bodyHeadersParsed = !isMultipart(currContentType)
+				}
+				continue
 			}
+			currData = append(currData, '\n')
 			continue
 		}
 		if body {
@@ -386,6 +419,7 @@ func ParseMBoxMsg(ctx *Ctx, groupName string, msg []byte, dsType string) (item m
 			if isBoundarySep {
 				bodyHeadersParsed = false
 				_ = addBody(i, line)
+				partHeaders = !end
 				if end {
 					if len(savedBoundary) > 0 {
 						pop()
@@ -428,7 +462,7 @@ func ParseMBoxMsg(ctx *Ctx, groupName string, msg []byte, dsType string) (item m
 								}
 							}
 							if len(boundary) == 0 {
-								Printf("#%d cannot find multiboundary message boundary(%s,%d)\n", i, groupName, len(msg))
+								warnf("#%d cannot find multiboundary message boundary(%s,%d)\n", i, groupName, len(msg))
 								warn = true
 							}
 						}
@@ -443,20 +477,22 @@ func ParseMBoxMsg(ctx *Ctx, groupName string, msg []byte, dsType string) (item m
 					continue
 				}
 				bodyHeadersParsed = true
+				partHeaders = false
 			}
 			currData = append(currData, line...)
+			currData = append(currData, '\n')
 			continue
 		}
 		cont := isContinue(i, line)
 		if cont {
 			if currKey == "" {
-				Printf("#%d no current key(%s,%d)\n", i, groupName, len(msg))
+				warnf("#%d no current key(%s,%d)\n", i, groupName, len(msg))
 				warn = true
 				break
 			}
 			currVal, ok := getRaw(currKey)
 			if !ok {
-				Printf("#%d missing %s key in %v\n", i, currKey, DumpKeys(raw))
+				warnf("#%d missing %s key in %v\n", i, currKey, DumpKeys(raw))
 				warn = true
 				break
 			}
@@ -470,7 +506,7 @@ func ParseMBoxMsg(ctx *Ctx, groupName string, msg []byte, dsType string) (item m
 		} else {
 			key, val, ok := getHeader(i, line)
 			if !ok {
-				Printf("#%d incorrect header(%s,%d)\n", i, groupName, len(msg))
+				warnf("#%d incorrect header(%s,%d)\n", i, groupName, len(msg))
 				warn = true
 				break
 			}
@@ -489,66 +525,72 @@ func ParseMBoxMsg(ctx *Ctx, groupName string, msg []byte, dsType string) (item m
 		if !ok {
 			return
 		}
-		l := len(a)
-		for i := l - 1; i >= 0; i-- {
-			sa = append(sa, string(a[i]))
+		for _, v := range a {
+			sa = append(sa, string(v))
 		}
 		return
 	}
 	ks := []string{}
+	messageID, hasMessageID := "", false
+	mdt, hasDate := "", false
 	for k := range raw {
 		lk := strings.ToLower(k)
 		sv := string(mustGetRaw(k))
 		sa := getRawStrings(k)
-		lsa := len(sa)
-		// Consider skipping adding all items with lk starting with x-
-		// Possible ES error due to > 1000 fields (but this seems not to be an issue with ES 7.x)
-		if lsa == 1 {
-			item[k] = sa[0]
-		} else {
-			item[k] = sa
-		}
-		if lk == MessageIDField[dsType] || lk == MessageDateField[dsType] {
-			item[lk] = sv
-			if lk != k {
-				ks = append(ks, lk)
-			} else {
-				nk := k + "-raw"
-				item[nk] = sa
-				if lsa == 1 {
-					item[nk] = sa[0]
-				} else {
-					item[nk] = sa
-				}
-				ks = append(ks, nk)
+		// RFC 2047 encoded-words are decoded, raw values of decoded headers are kept in RawHeaders
+		da := make([]string, len(sa))
+		changed := false
+		for i, v := range sa {
+			decode := DecodeHeader
+			if _, ok := MBoxAddressHeaders[lk]; ok {
+				decode = DecodeAddressHeader
 			}
+			d, err := decode(v)
+			if err != nil && ctx.Debug > 1 {
+				Printf("%s(%d): header %s: %v\n", groupName, len(msg), k, err)
+			}
+			da[i] = d
+			changed = changed || d != v
+		}
+		m.Headers[k] = da
+		if changed {
+			m.RawHeaders[k] = sa
+		}
+		switch lk {
+		case MessageIDField[dsType]:
+			messageID, hasMessageID = da[len(da)-1], true
+		case MessageDateField[dsType]:
+			mdt, hasDate = sv, true
 		}
 		if lk == MessageReceivedField[dsType] && lk != k {
 			raw[lk] = raw[k]
 		}
 		ks = append(ks, k)
 	}
+	m.MessageID = messageID
+	m.Subject = m.Header("subject")
+	maxAddrs := MaxMessageAddresses[dsType]
+	for _, addrs := range []struct {
+		header string
+		emails *[]*mail.Address
+	}{{"from", &m.From}, {"to", &m.To}, {"cc", &m.Cc}, {"reply-to", &m.ReplyTo}} {
+		values := m.HeaderValues(addrs.header)
+		if len(values) == 0 {
+			continue
+		}
+		*addrs.emails, _ = ParseAddresses(ctx, strings.Join(values, ", "), maxAddrs)
+	}
 	if ctx.Debug > 2 {
 		sort.Strings(ks)
 		for i, k := range ks {
-			if k == MessageReceivedField[dsType] || k == MessageIDField[dsType] || k == MessageDateField[dsType] {
-				Printf("#%d %s: %v\n", i+1, k, item[k])
-			} else {
-				a, ok := item[k].([]string)
-				if ok {
-					Printf("#%d %s: %d %v\n", i+1, k, len(a), a)
-				} else {
-					Printf("#%d %s: %v\n", i+1, k, item[k])
-				}
-			}
+			Printf("#%d %s: %d %v\n", i+1, k, len(m.Headers[k]), m.Headers[k])
 		}
 		for i, body := range bodies {
 			Printf("#%d: %s %s %d\n", i, string(body.ContentType), propertiesString(body.Properties), len(body.Data))
 		}
 	}
-	_, ok := item[MessageIDField[dsType]]
-	if !ok {
-		Printf("%s(%d): missing Message-ID field\n", groupName, len(msg))
+	if !hasMessageID {
+		warnf("%s(%d): missing Message-ID field\n", groupName, len(msg))
 		dumpMBox()
 		return
 	}
@@ -557,12 +599,10 @@ func ParseMBoxMsg(ctx *Ctx, groupName string, msg []byte, dsType string) (item m
 		dttz time.Time
 		tz   float64
 	)
-	found := false
-	mdt, ok := item[MessageDateField[dsType]]
-	if !ok {
+	if !hasDate {
 		rcvs, ok := raw[MessageReceivedField[dsType]]
 		if !ok {
-			Printf("%s(%d): missing Date & Received fields\n", groupName, len(msg))
+			warnf("%s(%d): missing Date & Received fields\n", groupName, len(msg))
 		}
 		type DtTz struct {
 			Dt   time.Time
@@ -580,7 +620,7 @@ func ParseMBoxMsg(ctx *Ctx, groupName string, msg []byte, dsType string) (item m
 		}
 		nDts := len(dts)
 		if nDts == 0 {
-			Printf("%s(%d): missing Date field and cannot parse date from Received field(s)\n", groupName, len(msg))
+			warnf("%s(%d): missing Date field and cannot parse date from Received field(s)\n", groupName, len(msg))
 			dumpMBox()
 			return
 		}
@@ -590,77 +630,57 @@ func ParseMBoxMsg(ctx *Ctx, groupName string, msg []byte, dsType string) (item m
 		dt = dts[0].Dt
 		dttz = dts[0].DtTz
 		tz = dts[0].Tz
-		found = true
-	}
-	if !found {
-		sdt, ok := mdt.(string)
-		if !ok {
-			Printf("%s(%d): non-string date field %v\n", groupName, len(msg), mdt)
-		}
-		dt, dttz, tz, ok = ParseDateWithTz(sdt)
+	} else {
+		var ok bool
+		dt, dttz, tz, ok = ParseDateWithTz(mdt)
 		if !ok {
-			Printf("%s(%d): unable to parse date from '%s'\n", groupName, len(msg), sdt)
+			warnf("%s(%d): unable to parse date from '%s'\n", groupName, len(msg), mdt)
 			dumpMBox()
 			return
 		}
 	}
-	// item["Date"] = dt
-	item[MessageDateField[dsType]] = dt
-	item["date_tz"] = tz
-	item["date_in_tz"] = dttz
-	item["MBox-N-Bodies"] = len(bodies)
-	bodyKeys := make(map[string]struct{})
-	item["data"] = make(map[string]interface{})
+	m.Date = dt
+	m.DateInTZ = dttz
+	m.TZ = tz
 	for i, body := range bodies {
-		contentType := string(body.ContentType)
-		ary := strings.Split(contentType, ";")
-		contentType = strings.TrimSpace(ary[0])
-		props := strings.Split(contentType, "/")
-		for i := range props {
-			props[i] = strings.TrimSpace(props[i])
-		}
-		sBody := BytesToStringTrunc(body.Data, MaxMessageBodyLength[dsType], false)
-		m := make(map[string]interface{})
-		m["data"] = sBody
-		m["content-type"] = string(body.ContentType)
-		m["headers"] = make(map[string]interface{})
+		transferEncoding := ""
+		headers := make(map[string][]string)
 		for k, v := range body.Properties {
-			if len(v) == 1 {
-				m["headers"].(map[string]interface{})[k] = string(v[0])
-			} else {
-				a := []string{}
-				for _, vi := range v {
-					a = append(a, string(vi))
-				}
-				m["headers"].(map[string]interface{})[k] = a
+			if strings.ToLower(k) == "content-transfer-encoding" && len(v) > 0 {
+				transferEncoding = string(v[len(v)-1])
+			}
+			for _, vi := range v {
+				headers[k] = append(headers[k], string(vi))
 			}
 		}
-		m["num"] = i
-		path := []string{"data"}
-		path = append(path, props...)
-		key := strings.Join(path, "/")
-		_, ok := bodyKeys[key]
-		if !ok {
-			FatalOnError(DeepSet(item, path, []interface{}{m}, true))
-			bodyKeys[key] = struct{}{}
-		} else {
-			iface, _ := Dig(item, path, true, false)
-			ifary, _ := iface.([]interface{})
-			ifary = append(ifary, m)
-			FatalOnError(DeepSet(item, path, ifary, true))
+		data, err := DecodeMIMEBody(string(body.ContentType), transferEncoding, body.Data)
+		if err != nil {
+			warnf("%s(%d): body #%d (%s): %v\n", groupName, len(msg), i, string(body.ContentType), err)
+			warn = true
 		}
-		//Printf("#%d: %s %s %d\n", i, string(body.ContentType), propertiesString(body.Properties), len(body.Data))
-	}
-	if MBoxDropXFields {
-		ks := []string{}
-		for k := range item {
-			lk := strings.ToLower(k)
-			if strings.HasPrefix(lk, "x-") {
-				ks = append(ks, k)
+		mediaType, params := MIMEParams(string(body.ContentType))
+		part := &MailBody{
+			Num:         i,
+			ContentType: string(body.ContentType),
+			MediaType:   mediaType,
+			Headers:     headers,
+			Data:        strings.ToValidUTF8(BytesToStringTrunc(data, MaxMessageBodyLength[dsType], false), ""),
+			FileName:    params["name"],
+		}
+		if disposition := mailHeaderValues(headers, "content-disposition"); len(disposition) > 0 {
+			_, dParams := MIMEParams(disposition[len(disposition)-1])
+			if dParams["filename"] != "" {
+				part.FileName = dParams["filename"]
 			}
 		}
-		for _, k := range ks {
-			delete(item, k)
+		// Message text is taken from the first text/plain body, first text/html body is used when there is no text/plain one
+		if (mediaType == "text/plain" && m.TextContentType != "text/plain") || (mediaType == "text/html" && m.TextContentType == "") {
+			m.Text, m.TextContentType = part.Data, mediaType
+		}
+		if part.IsAttachment() {
+			m.Attachments = append(m.Attachments, part)
+		} else {
+			m.Bodies = append(m.Bodies, part)
 		}
 	}
 	valid = true
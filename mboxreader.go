@@ -0,0 +1,227 @@
+package ds
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+const (
+	// MBoxO - mboxo variant: body lines starting with "From " are quoted as ">From " (ambiguous, ">From " is unquoted when reading)
+	MBoxO = "mboxo"
+	// MBoxRD - mboxrd variant: body lines matching ">*From " are quoted by adding one more ">", one ">" is removed when reading
+	MBoxRD = "mboxrd"
+	// MBoxCL2 - mboxcl2 variant: bodies are not quoted, their size is given by Content-Length header
+	MBoxCL2 = "mboxcl2"
+	// DefaultMBoxMaxMessageSize - messages longer than this are truncated by MBoxReader
+	DefaultMBoxMaxMessageSize = 16 << 20
+)
+
+var (
+	// MBoxFromLineRE - "From " line starting a new message: From sender date, date must contain time
+	// It is only checked for lines at the beginning of the archive or following an empty line
+	MBoxFromLineRE = regexp.MustCompile(`^From \S+\s+.*\d{1,2}:\d{2}`)
+	// mboxQuotedFromRE - quoted "From " line
+	mboxQuotedFromRE = regexp.MustCompile(`^>+From `)
+	// mboxContentLengthRE - Content-Length header used by mboxcl2 variant
+	mboxContentLengthRE = regexp.MustCompile(`(?i)^Content-Length:\s*(\d+)\s*$`)
+)
+
+// MBoxMessage - single message read from mbox archive
+// Offset - byte offset of message's "From " line in the archive, reading can be resumed from it, see NewMBoxReaderAt
+// From - "From " line without "From " prefix and line end
+// Data - whole message (with "From " line) having "From " quoting removed, it can be passed to ParseMBoxMsg
+// Truncated - message was longer than reader's max message size and Data only contains its beginning
+type MBoxMessage struct {
+	Offset    int64
+	From      []byte
+	Data      []byte
+	Truncated bool
+}
+
+// MBoxReader - reads messages from mbox archive one at a time, memory used is bounded by max message size
+type MBoxReader struct {
+	r             *bufio.Reader
+	variant       string
+	maxSize       int
+	offset        int64
+	pending       []byte
+	pendingOffset int64
+	err           error
+}
+
+// NewMBoxReader - creates mbox reader for a given variant (mboxo, mboxrd or mboxcl2) reading archive from the beginning
+func NewMBoxReader(r io.Reader, variant string) (*MBoxReader, error) {
+	return NewMBoxReaderAt(r, variant, 0)
+}
+
+// NewMBoxReaderAt - creates mbox reader for r positioned at offset (offset of a message returned earlier), reported offsets start from it
+func NewMBoxReaderAt(r io.Reader, variant string, offset int64) (*MBoxReader, error) {
+	if variant != MBoxO && variant != MBoxRD && variant != MBoxCL2 {
+		return nil, fmt.Errorf("unsupported mbox variant '%s', supported: %s, %s, %s", variant, MBoxO, MBoxRD, MBoxCL2)
+	}
+	return &MBoxReader{
+		r:       bufio.NewReaderSize(r, 0x10000),
+		variant: variant,
+		maxSize: DefaultMBoxMaxMessageSize,
+		offset:  offset,
+	}, nil
+}
+
+// SetMaxMessageSize - messages longer than maxSize bytes are truncated (MBoxMessage.Truncated is set)
+func (r *MBoxReader) SetMaxMessageSize(maxSize int) {
+	if maxSize > 0 {
+		r.maxSize = maxSize
+	}
+}
+
+// Offset - offset of the next byte to be read from the archive
+func (r *MBoxReader) Offset() int64 {
+	return r.offset
+}
+
+// readLine - read next line (with its line end), lines longer than max message size are cut (but fully consumed)
+func (r *MBoxReader) readLine() (line []byte, err error) {
+	for {
+		var chunk []byte
+		chunk, err = r.r.ReadSlice('\n')
+		r.offset += int64(len(chunk))
+		if len(line) < r.maxSize {
+			if len(line)+len(chunk) > r.maxSize {
+				chunk = chunk[:r.maxSize-len(line)]
+			}
+			line = append(line, chunk...)
+		}
+		if err != bufio.ErrBufferFull {
+			return
+		}
+	}
+}
+
+// isMBoxBlank - is line empty (only line end)
+func isMBoxBlank(line []byte) bool {
+	return len(bytes.TrimRight(line, "\r\n")) == 0
+}
+
+// isFromLine - does line start a new message
+func (r *MBoxReader) isFromLine(line []byte) bool {
+	return bytes.HasPrefix(line, []byte("From ")) && MBoxFromLineRE.Match(line)
+}
+
+// Next - returns next message, io.EOF when there are no more messages
+func (r *MBoxReader) Next() (msg *MBoxMessage, err error) {
+	if r.pending == nil && r.err != nil {
+		err = r.err
+		return
+	}
+	// Skip anything before the first message
+	for r.pending == nil {
+		offset := r.offset
+		var line []byte
+		line, err = r.readLine()
+		if len(line) > 0 && r.isFromLine(line) {
+			r.pending, r.pendingOffset = line, offset
+			break
+		}
+		if err != nil {
+			r.err = err
+			return
+		}
+	}
+	msg = &MBoxMessage{Offset: r.pendingOffset, From: bytes.TrimRight(r.pending[5:], "\r\n")}
+	data := r.pending
+	r.pending = nil
+	add := func(b []byte) {
+		if len(data)+len(b) > r.maxSize {
+			b = b[:r.maxSize-len(data)]
+			msg.Truncated = true
+		}
+		data = append(data, b...)
+	}
+	inHeaders := true
+	contentLength := int64(-1)
+	prevEmpty := false
+	var lastLine []byte
+	for {
+		if !inHeaders && contentLength >= 0 {
+			err = r.readBody(contentLength, add)
+			contentLength = -1
+			prevEmpty = true
+			if err != nil {
+				break
+			}
+		}
+		offset := r.offset
+		var line []byte
+		line, err = r.readLine()
+		if len(line) > 0 {
+			if prevEmpty && r.isFromLine(line) {
+				r.pending, r.pendingOffset = line, offset
+				// Empty line before "From " separates messages, it is not a part of the message
+				if len(lastLine) > 0 && !msg.Truncated {
+					data = data[:len(data)-len(lastLine)]
+				}
+				break
+			}
+			blank := isMBoxBlank(line)
+			if inHeaders {
+				if blank {
+					inHeaders = false
+				} else if r.variant == MBoxCL2 {
+					if m := mboxContentLengthRE.FindSubmatch(bytes.TrimRight(line, "\r\n")); m != nil {
+						contentLength, _ = strconv.ParseInt(string(m[1]), 10, 64)
+					}
+				}
+			}
+			if r.variant != MBoxCL2 && mboxQuotedFromRE.Match(line) && (r.variant == MBoxRD || line[1] == 'F') {
+				line = line[1:]
+			}
+			add(line)
+			prevEmpty = blank
+			lastLine = nil
+			if blank {
+				lastLine = line
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err == io.EOF {
+		r.err = err
+		err = nil
+	}
+	if err != nil {
+		r.err = err
+		msg = nil
+		return
+	}
+	msg.Data = data
+	return
+}
+
+// readBody - read mboxcl2 message body of a given length
+func (r *MBoxReader) readBody(length int64, add func([]byte)) (err error) {
+	buf := make([]byte, 0x8000)
+	for length > 0 {
+		n := int64(len(buf))
+		if n > length {
+			n = length
+		}
+		var read int
+		read, err = io.ReadFull(r.r, buf[:n])
+		r.offset += int64(read)
+		length -= int64(read)
+		add(buf[:read])
+		if err != nil {
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+			return
+		}
+	}
+	return
+}
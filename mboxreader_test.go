@@ -0,0 +1,62 @@
+package ds
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readMBox(t *testing.T, archive, variant string, offset int64, maxSize int) (msgs []*MBoxMessage) {
+	r, err := NewMBoxReaderAt(bytes.NewReader([]byte(archive)[offset:]), variant, offset)
+	assert.Nil(t, err)
+	r.SetMaxMessageSize(maxSize)
+	for {
+		msg, err := r.Next()
+		if err == io.EOF {
+			return
+		}
+		assert.Nil(t, err)
+		msgs = append(msgs, msg)
+	}
+}
+
+func TestMBoxReader(t *testing.T) {
+	mboxrd := "garbage\n" +
+		"From a@b.c Mon Jan  4 10:00:00 2021\nSubject: one\n\nbody\nFrom the start it worked\n>From quoted\n>>From double\n\n" +
+		"From d@e.f Tue Jan  5 11:00:00 2021\r\nSubject: two\r\n\r\nsecond\r\n"
+	msgs := readMBox(t, mboxrd, MBoxRD, 0, 0)
+	assert.Equal(t, 2, len(msgs))
+	assert.Equal(t, int64(8), msgs[0].Offset)
+	assert.Equal(t, "a@b.c Mon Jan  4 10:00:00 2021", string(msgs[0].From))
+	assert.Equal(t, "From a@b.c Mon Jan  4 10:00:00 2021\nSubject: one\n\nbody\nFrom the start it worked\nFrom quoted\n>From double\n", string(msgs[0].Data))
+	assert.Equal(t, "From d@e.f Tue Jan  5 11:00:00 2021\r\nSubject: two\r\n\r\nsecond\r\n", string(msgs[1].Data))
+	// Resume from the second message
+	resumed := readMBox(t, mboxrd, MBoxRD, msgs[1].Offset, 0)
+	assert.Equal(t, 1, len(resumed))
+	assert.Equal(t, msgs[1].Offset, resumed[0].Offset)
+	assert.Equal(t, msgs[1].Data, resumed[0].Data)
+	// mboxo only unquotes a single ">"
+	msgs = readMBox(t, mboxrd, MBoxO, 0, 0)
+	assert.Equal(t, 2, len(msgs))
+	assert.Contains(t, string(msgs[0].Data), "\nFrom quoted\n>>From double\n")
+	// Truncation
+	msgs = readMBox(t, mboxrd, MBoxRD, 0, 40)
+	assert.Equal(t, 2, len(msgs))
+	assert.True(t, msgs[0].Truncated)
+	assert.Equal(t, 40, len(msgs[0].Data))
+	assert.Equal(t, msgs[1].Offset, int64(len(mboxrd)-len("From d@e.f Tue Jan  5 11:00:00 2021\r\nSubject: two\r\n\r\nsecond\r\n")))
+}
+
+func TestMBoxReaderCL2(t *testing.T) {
+	body := "line\n\nFrom x@y.z Mon Jan  4 10:00:00 2021\nnot a message\n"
+	mboxcl2 := "From a@b.c Mon Jan  4 10:00:00 2021\nContent-Length: 56\n\n" + body + "\n" +
+		"From d@e.f Tue Jan  5 11:00:00 2021\nSubject: two\n\n>From kept\n"
+	msgs := readMBox(t, mboxcl2, MBoxCL2, 0, 0)
+	assert.Equal(t, 2, len(msgs))
+	assert.Equal(t, "From a@b.c Mon Jan  4 10:00:00 2021\nContent-Length: 56\n\n"+body, string(msgs[0].Data))
+	assert.Equal(t, "From d@e.f Tue Jan  5 11:00:00 2021\nSubject: two\n\n>From kept\n", string(msgs[1].Data))
+	_, err := NewMBoxReader(bytes.NewReader(nil), "mbox")
+	assert.NotNil(t, err)
+}
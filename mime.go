@@ -0,0 +1,241 @@
+package ds
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/quotedprintable"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+var (
+	// mimeEncodedWordRE - RFC 2047 encoded-word: =?charset?encoding?text?=
+	mimeEncodedWordRE = regexp.MustCompile(`=\?([^?\s]+)\?([BbQq])\?([^?\s]*)\?=`)
+)
+
+// MIMEParams - parse Content-Type header value into lower case media type and parameters
+// Malformed values (unquoted special characters, duplicate parameters) are parsed leniently
+func MIMEParams(contentType string) (mediaType string, params map[string]string) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err == nil {
+		return
+	}
+	ary := strings.Split(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(ary[0]))
+	params = make(map[string]string)
+	for _, param := range ary[1:] {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		k := strings.ToLower(strings.TrimSpace(kv[0]))
+		if _, ok := params[k]; !ok {
+			params[k] = strings.Trim(strings.TrimSpace(kv[1]), `"'`)
+		}
+	}
+	return
+}
+
+// DecodeTransferEncoding - decode data using Content-Transfer-Encoding: quoted-printable or base64, other encodings are returned unchanged
+// On error it returns data decoded so far (or original data when nothing was decoded)
+func DecodeTransferEncoding(encoding string, data []byte) (decoded []byte, err error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		decoded, err = ioutil.ReadAll(quotedprintable.NewReader(bytes.NewReader(data)))
+	case "base64":
+		clean := bytes.Map(func(r rune) rune {
+			if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+				return -1
+			}
+			return r
+		}, data)
+		decoded = make([]byte, len(clean))
+		var n int
+		n, err = base64.StdEncoding.Decode(decoded, clean)
+		if err != nil {
+			// Missing padding is quite common
+			n, err = base64.RawStdEncoding.Decode(decoded, bytes.TrimRight(clean, "="))
+		}
+		decoded = decoded[:n]
+	default:
+		decoded = data
+	}
+	if err != nil {
+		err = fmt.Errorf("cannot decode %s: %v", encoding, err)
+		if len(decoded) == 0 {
+			decoded = data
+		}
+	}
+	return
+}
+
+// DecodeCharset - convert text in a given charset to UTF-8, invalid UTF-8 sequences are removed
+// Returns error (and text with invalid sequences removed) when charset is unknown
+func DecodeCharset(charset string, data []byte) (decoded []byte, err error) {
+	charset = strings.ToLower(strings.TrimSpace(charset))
+	switch charset {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		decoded = data
+	default:
+		enc, e := htmlindex.Get(charset)
+		if e != nil {
+			err = fmt.Errorf("unknown charset %s: %v", charset, e)
+			decoded = data
+			break
+		}
+		decoded, err = enc.NewDecoder().Bytes(data)
+		if err != nil {
+			err = fmt.Errorf("cannot decode %s: %v", charset, err)
+			decoded = data
+		}
+	}
+	if !utf8.Valid(decoded) {
+		decoded = bytes.ToValidUTF8(decoded, []byte{})
+	}
+	return
+}
+
+// DecodeMIMEBody - decode single (non-multipart) MIME body: Content-Transfer-Encoding and charset (to UTF-8)
+// Only text/* and message/* bodies are decoded, others (attachments) are returned unchanged, so binary data is never indexed
+func DecodeMIMEBody(contentType, transferEncoding string, data []byte) (decoded []byte, err error) {
+	mediaType, params := MIMEParams(contentType)
+	if mediaType != "" && !strings.HasPrefix(mediaType, "text/") && !strings.HasPrefix(mediaType, "message/") {
+		decoded = data
+		return
+	}
+	decoded, err = DecodeTransferEncoding(transferEncoding, data)
+	decoded, e := DecodeCharset(params["charset"], decoded)
+	if err == nil {
+		err = e
+	}
+	return
+}
+
+// DecodeHeader - decode RFC 2047 encoded-words (=?charset?B|Q?text?=) in header value to UTF-8
+// Whitespace between adjacent encoded-words is removed, adjacent words in the same charset are converted together (multi-byte characters can be split between them)
+// Malformed encoded-words are kept as is and error is returned together with the best effort decoded value
+func DecodeHeader(value string) (string, error) {
+	return decodeHeader(value, false)
+}
+
+// DecodeAddressHeader - like DecodeHeader, but decoded texts containing special characters (like "Doe, John") are quoted, so the result can be parsed as address list
+func DecodeAddressHeader(value string) (string, error) {
+	return decodeHeader(value, true)
+}
+
+func decodeHeader(value string, quote bool) (decoded string, err error) {
+	matches := mimeEncodedWordRE.FindAllStringSubmatchIndex(value, -1)
+	if len(matches) == 0 {
+		decoded = value
+		return
+	}
+	var (
+		b          strings.Builder
+		run        []byte
+		runCharset string
+		inRun      bool
+		inQuotes   bool
+		afterWord  bool
+	)
+	flush := func() {
+		if !inRun {
+			return
+		}
+		text, e := DecodeCharset(runCharset, run)
+		if e != nil && err == nil {
+			err = e
+		}
+		s := string(text)
+		if quote && !inQuotes && strings.ContainsAny(s, `()<>[]:;@\,."`) {
+			s = `"` + strings.Replace(strings.Replace(s, `\`, `\\`, -1), `"`, `\"`, -1) + `"`
+		}
+		b.WriteString(s)
+		run, runCharset, inRun = nil, "", false
+	}
+	writeText := func(s string) {
+		b.WriteString(s)
+		for i := 0; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+			} else if s[i] == '"' {
+				inQuotes = !inQuotes
+			}
+		}
+	}
+	last := 0
+	for _, m := range matches {
+		between := value[last:m[0]]
+		if !afterWord || strings.TrimSpace(between) != "" {
+			flush()
+			writeText(between)
+		}
+		charset := strings.ToLower(value[m[2]:m[3]])
+		// RFC 2231 language: charset*lang
+		if i := strings.Index(charset, "*"); i >= 0 {
+			charset = charset[:i]
+		}
+		data, e := decodeEncodedWord(value[m[4]:m[5]], value[m[6]:m[7]])
+		if e != nil {
+			if err == nil {
+				err = fmt.Errorf("malformed encoded-word %s: %v", value[m[0]:m[1]], e)
+			}
+			flush()
+			writeText(value[m[0]:m[1]])
+			last, afterWord = m[1], false
+			continue
+		}
+		if inRun && charset != runCharset {
+			flush()
+		}
+		run, runCharset, inRun = append(run, data...), charset, true
+		last, afterWord = m[1], true
+	}
+	flush()
+	writeText(value[last:])
+	decoded = strings.ToValidUTF8(b.String(), "")
+	return
+}
+
+// decodeEncodedWord - decode B (base64) or Q (quoted-printable like, "_" is space) encoded-word text
+func decodeEncodedWord(encoding, text string) (data []byte, err error) {
+	if strings.ToUpper(encoding) == "B" {
+		return DecodeTransferEncoding("base64", []byte(text))
+	}
+	data = make([]byte, 0, len(text))
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '_':
+			data = append(data, ' ')
+		case c == '=' && i+2 < len(text) && isHexDigit(text[i+1]) && isHexDigit(text[i+2]):
+			data = append(data, unhex(text[i+1])<<4|unhex(text[i+2]))
+			i += 2
+		case c == '=':
+			err = fmt.Errorf("invalid escape at position %d", i)
+			return
+		default:
+			data = append(data, c)
+		}
+	}
+	return
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
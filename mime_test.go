@@ -0,0 +1,114 @@
+package ds
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeMIMEBody(t *testing.T) {
+	var testCases = []struct {
+		contentType string
+		encoding    string
+		data        string
+		expected    string
+		err         bool
+	}{
+		{contentType: "text/plain", data: "plain", expected: "plain"},
+		{contentType: "text/plain; charset=utf-8", encoding: "quoted-printable", data: "caf=C3=A9 soft=\nbreak", expected: "café softbreak"},
+		{contentType: `text/plain; charset="iso-8859-2"`, encoding: "quoted-printable", data: "=BF=F3=B3w", expected: "żółw"},
+		{contentType: "text/plain; charset=windows-1252", encoding: "base64", data: "Y2Fm6Q==", expected: "café"},
+		{contentType: "text/plain", encoding: "BASE64", data: "Y2Fm\r\nw6k", expected: "café"},
+		{contentType: "text/plain; charset=koi8-r", data: "\xf0\xd2\xc9\xd7\xc5\xd4", expected: "Привет"},
+		{contentType: "text/plain; charset=unknown-cs", data: "ok\xff", expected: "ok", err: true},
+		{contentType: "application/octet-stream", encoding: "base64", data: "AAEC", expected: "AAEC"},
+		{contentType: "text/html; charset=utf-8; charset=latin1", encoding: "7bit", data: "<b>x</b>", expected: "<b>x</b>"},
+	}
+	for _, tc := range testCases {
+		got, err := DecodeMIMEBody(tc.contentType, tc.encoding, []byte(tc.data))
+		assert.Equal(t, tc.expected, string(got), tc.contentType)
+		assert.Equal(t, tc.err, err != nil, tc.contentType)
+	}
+}
+
+func TestParseMBoxMsgMIME(t *testing.T) {
+	lines := []string{
+		"From a@b.c Mon Jan  4 10:00:00 2021\nMessage-ID: <1@b.c>",
+		"Date: Mon, 4 Jan 2021 10:00:00 +0000",
+		"Subject: =?UTF-8?B?w7xiZXI=?= =?ISO-8859-1?Q?caf=E9?=",
+		"From: =?UTF-8?Q?Doe=2C_J=C3=B6hn?= <john@doe.com>",
+		`Content-Type: multipart/mixed; boundary="outer"`,
+		"",
+		"This is a multi-part message in MIME format.",
+		"--outer",
+		`Content-Type: multipart/alternative; boundary="inner"`,
+		"",
+		"--inner",
+		"Content-Type: text/html; charset=utf-8",
+		"Content-Transfer-Encoding: base64",
+		"",
+		"PGI+Y2Fmw6k8L2I+",
+		"--inner",
+		"Content-Type: text/plain; charset=iso-8859-1",
+		"Content-Transfer-Encoding: quoted-printable",
+		"",
+		"Note: caf=E9",
+		"second line",
+		"--inner--",
+		"--outer",
+		"Content-Type: application/pdf",
+		"Content-Transfer-Encoding: base64",
+		"",
+		"JVBERi0=",
+		"--outer--",
+		"",
+	}
+	item, valid, warn := ParseMBoxMsg(&Ctx{}, "group", []byte(strings.Join(lines, "\r\n")), "default")
+	assert.True(t, valid)
+	assert.False(t, warn)
+	assert.Equal(t, 3, item["MBox-N-Bodies"])
+	assert.Equal(t, "übercafé", item["Subject"])
+	assert.Equal(t, `"Doe, Jöhn" <john@doe.com>`, item["From"])
+	assert.Equal(t, map[string]interface{}{"Subject": "=?UTF-8?B?w7xiZXI=?= =?ISO-8859-1?Q?caf=E9?=", "From": "=?UTF-8?Q?Doe=2C_J=C3=B6hn?= <john@doe.com>"}, item["MBox-Raw-Headers"])
+	emails, ok := ParseAddresses(&Ctx{}, item["From"].(string), 1)
+	assert.True(t, ok)
+	assert.Equal(t, "Doe, Jöhn", emails[0].Name)
+	assert.Equal(t, "Note: café\nsecond line", item["MBox-Text"])
+	assert.Equal(t, "text/plain", item["MBox-Text-Content-Type"])
+	html, _ := Dig(item, []string{"data", "text", "html"}, true, false)
+	assert.Equal(t, "<b>café</b>", html.([]interface{})[0].(map[string]interface{})["data"])
+	pdf, _ := Dig(item, []string{"data", "application", "pdf"}, true, false)
+	assert.Equal(t, "JVBERi0=", pdf.([]interface{})[0].(map[string]interface{})["data"])
+}
+
+func TestDecodeHeader(t *testing.T) {
+	var testCases = []struct {
+		in       string
+		expected string
+		address  bool
+		err      bool
+	}{
+		{in: "plain subject", expected: "plain subject"},
+		{in: "=?UTF-8?B?UsOpc3Vtw6k=?=", expected: "Résumé"},
+		{in: "=?iso-8859-1?q?caf=E9_au_lait?=", expected: "café au lait"},
+		{in: "Re: =?UTF-8?Q?a?= =?UTF-8?Q?b?=  end", expected: "Re: ab  end"},
+		{in: "=?UTF-8?B?xQ==?= =?UTF-8?B?gg==?=", expected: "ł"},
+		{in: "=?KOI8-R?B?8NLJ18XU?= =?UTF-8?Q?_=C5=BC?=", expected: "Привет ż"},
+		{in: "=?UTF-8*en?Q?hi?=", expected: "hi"},
+		{in: "=?UTF-8?B?w7xiZXI?=", expected: "über"},
+		{in: "bad =?UTF-8?Q?x=Z1?= word", expected: "bad =?UTF-8?Q?x=Z1?= word", err: true},
+		{in: "=?x-unknown?Q?ok?=", expected: "ok", err: true},
+		{in: "=?UTF-8?Q?Doe=2C_John?= <j@d.com>, =?UTF-8?Q?Ann?= <a@d.com>", expected: `"Doe, John" <j@d.com>, Ann <a@d.com>`, address: true},
+		{in: `"=?UTF-8?Q?Doe=2C_John?=" <j@d.com>`, expected: `"Doe, John" <j@d.com>`, address: true},
+	}
+	for _, tc := range testCases {
+		decode := DecodeHeader
+		if tc.address {
+			decode = DecodeAddressHeader
+		}
+		got, err := decode(tc.in)
+		assert.Equal(t, tc.expected, got, tc.in)
+		assert.Equal(t, tc.err, err != nil, tc.in)
+	}
+}
@@ -0,0 +1,353 @@
+package ds
+
+import (
+	"fmt"
+	neturl "net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// PaginateLink - follow RFC 5988 Link header rel="next" URLs
+	PaginateLink = "link"
+	// PaginateCursor - pass cursor token found in the response at a given JSON path
+	PaginateCursor = "cursor"
+	// PaginateOffset - pass offset/limit query parameters
+	PaginateOffset = "offset"
+	// PaginatePage - pass page number (and optionally per page) query parameters
+	PaginatePage = "page"
+)
+
+var (
+	// LinkHeaderRE - single entry of RFC 5988 Link header: <url>; rel="next"
+	LinkHeaderRE = regexp.MustCompile(`<([^>]*)>\s*((?:;\s*[^;,]+)*)`)
+	// LinkRelRE - rel parameter of a Link header entry
+	LinkRelRE = regexp.MustCompile(`rel\s*=\s*"?([^";,]+)"?`)
+	// PaginateJSONStatuses - statuses parsed as JSON by paginators
+	PaginateJSONStatuses = map[[2]int]struct{}{{200, 299}: {}}
+	// PaginateErrorStatuses - statuses considered an error by paginators
+	PaginateErrorStatuses = map[[2]int]struct{}{{400, 599}: {}}
+)
+
+// PageState - resumable paginator state, it is JSON serializable so it can be persisted
+type PageState struct {
+	URL      string     `json:"url,omitempty"`       // next page URL (link paginator)
+	Cursor   string     `json:"cursor,omitempty"`    // next page cursor (cursor paginator)
+	Offset   int        `json:"offset,omitempty"`    // next page offset (offset paginator)
+	Page     int        `json:"page,omitempty"`      // next page number (page paginator)
+	Pages    int        `json:"pages"`               // pages fetched so far
+	Items    int        `json:"items"`               // items returned so far
+	LastDate *time.Time `json:"last_date,omitempty"` // max item date returned so far
+	Done     bool       `json:"done"`                // no more pages
+}
+
+// Paginator - iterates over paged API responses fetched using Request
+// ItemsPath - path to items array in JSON response (using Dig), empty means that response itself is an array
+// DateField - path to item's date field (within item), when set items outside ctx.DateFrom - ctx.DateTo are skipped
+// DateOrder - 1 if items are sorted by date ascending, -1 if descending, 0 if unknown - when known pagination stops after passing date range
+// MaxPages, MaxItems - stop after fetching that many pages/items (0 means no limit)
+// StopFunc - optional custom stop condition called for every page (with all items returned by API)
+// CheckpointKey - when set, max item date is saved via SetLastUpdate by Commit (after every page for ascending order, at the end otherwise) and used as DateFrom by Resume
+type Paginator struct {
+	Ctx           *Ctx
+	Kind          string
+	BaseURL       string
+	Headers       map[string]string
+	ItemsPath     []string
+	CursorPath    []string
+	CursorParam   string
+	OffsetParam   string
+	LimitParam    string
+	Limit         int
+	PageParam     string
+	PerPageParam  string
+	PerPage       int
+	DateField     []string
+	DateOrder     int
+	DateFrom      *time.Time
+	DateTo        *time.Time
+	MaxPages      int
+	MaxItems      int
+	StopFunc      func(items []interface{}) bool
+	CacheFor      *time.Duration
+	CheckpointKey string
+	State         PageState
+}
+
+// NewLinkPaginator - paginator following RFC 5988 Link header rel="next" URLs (GitHub, GitLab)
+func NewLinkPaginator(ctx *Ctx, url string) *Paginator {
+	return newPaginator(ctx, PaginateLink, url)
+}
+
+// NewCursorPaginator - paginator passing cursor found at cursorPath in JSON response as cursorParam query parameter
+func NewCursorPaginator(ctx *Ctx, url, cursorParam string, cursorPath []string) *Paginator {
+	p := newPaginator(ctx, PaginateCursor, url)
+	p.CursorParam = cursorParam
+	p.CursorPath = cursorPath
+	return p
+}
+
+// NewOffsetPaginator - paginator passing offsetParam and limitParam query parameters, starting from offset 0
+func NewOffsetPaginator(ctx *Ctx, url, offsetParam, limitParam string, limit int) *Paginator {
+	p := newPaginator(ctx, PaginateOffset, url)
+	p.OffsetParam = offsetParam
+	p.LimitParam = limitParam
+	p.Limit = limit
+	return p
+}
+
+// NewPagePaginator - paginator passing page number as pageParam (starting from firstPage) and page size as perPageParam (if not empty)
+func NewPagePaginator(ctx *Ctx, url, pageParam, perPageParam string, perPage, firstPage int) *Paginator {
+	p := newPaginator(ctx, PaginatePage, url)
+	p.PageParam = pageParam
+	p.PerPageParam = perPageParam
+	p.PerPage = perPage
+	p.State.Page = firstPage
+	return p
+}
+
+func newPaginator(ctx *Ctx, kind, url string) *Paginator {
+	return &Paginator{
+		Ctx:      ctx,
+		Kind:     kind,
+		BaseURL:  url,
+		DateFrom: ctx.DateFrom,
+		DateTo:   ctx.DateTo,
+		State:    PageState{URL: url},
+	}
+}
+
+// ParseLinkHeader - parse RFC 5988 Link header into rel -> URL map
+func ParseLinkHeader(header string) (links map[string]string) {
+	links = make(map[string]string)
+	for _, m := range LinkHeaderRE.FindAllStringSubmatch(header, -1) {
+		for _, rel := range LinkRelRE.FindAllStringSubmatch(m[2], -1) {
+			for _, r := range strings.Fields(rel[1]) {
+				links[strings.ToLower(r)] = m[1]
+			}
+		}
+	}
+	return
+}
+
+// Resume - when CheckpointKey is set and date from is not specified, start from the last saved checkpoint
+func (p *Paginator) Resume() {
+	if p.CheckpointKey == "" || p.DateFrom != nil {
+		return
+	}
+	lastUpdate := GetLastUpdate(p.Ctx, p.CheckpointKey)
+	if lastUpdate != nil {
+		p.DateFrom = lastUpdate
+		if p.Ctx.Debug > 0 {
+			Printf("%s: resuming from %v\n", p.CheckpointKey, *lastUpdate)
+		}
+	}
+}
+
+// pageURL - URL of the next page for the current state
+func (p *Paginator) pageURL() (string, error) {
+	if p.Kind == PaginateLink {
+		return p.State.URL, nil
+	}
+	u, err := neturl.Parse(p.BaseURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	switch p.Kind {
+	case PaginateCursor:
+		if p.State.Cursor != "" {
+			q.Set(p.CursorParam, p.State.Cursor)
+		}
+	case PaginateOffset:
+		q.Set(p.OffsetParam, strconv.Itoa(p.State.Offset))
+		if p.LimitParam != "" && p.Limit > 0 {
+			q.Set(p.LimitParam, strconv.Itoa(p.Limit))
+		}
+	case PaginatePage:
+		q.Set(p.PageParam, strconv.Itoa(p.State.Page))
+		if p.PerPageParam != "" && p.PerPage > 0 {
+			q.Set(p.PerPageParam, strconv.Itoa(p.PerPage))
+		}
+	default:
+		return "", fmt.Errorf("unknown pagination kind '%s'", p.Kind)
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// itemDate - parse item's date field
+func (p *Paginator) itemDate(item interface{}) (dt time.Time, ok bool) {
+	iface, ok := Dig(item, p.DateField, false, true)
+	if !ok {
+		return
+	}
+	sdt, ok := iface.(string)
+	if !ok {
+		return
+	}
+	dt, err := time.Parse(time.RFC3339Nano, sdt)
+	if err != nil {
+		dt, err = TimeParseAny(sdt)
+	}
+	ok = err == nil
+	return
+}
+
+// Next - fetch next page and return items within date range
+// Returns done=true when there are no more pages, items can still be returned together with done=true
+// Caller should call Commit after it processed returned items, Each does that
+func (p *Paginator) Next() (items []interface{}, done bool, err error) {
+	if p.State.Done {
+		done = true
+		return
+	}
+	if p.MaxPages > 0 && p.State.Pages >= p.MaxPages {
+		p.State.Done = true
+		done = true
+		return
+	}
+	url, err := p.pageURL()
+	if err != nil {
+		return
+	}
+	result, _, _, outHeaders, err := Request(
+		p.Ctx,
+		url,
+		"GET",
+		p.Headers,
+		nil,
+		nil,
+		PaginateJSONStatuses,  // JSON statuses
+		PaginateErrorStatuses, // error statuses
+		nil,                   // OK statuses
+		PaginateJSONStatuses,  // cache statuses
+		true,                  // retry
+		p.CacheFor,            // cache for
+		false,                 // skip in dry-run mode
+	)
+	if err != nil {
+		return
+	}
+	p.State.Pages++
+	var (
+		all []interface{}
+		ok  bool
+	)
+	if len(p.ItemsPath) == 0 {
+		all, ok = result.([]interface{})
+	} else {
+		var iface interface{}
+		iface, ok = Dig(result, p.ItemsPath, false, true)
+		if ok {
+			all, ok = iface.([]interface{})
+		}
+	}
+	if !ok && result != nil {
+		Printf("%s: cannot find items array at %v\n", url, p.ItemsPath)
+	}
+	nAll := len(all)
+	stop := nAll == 0
+	for _, item := range all {
+		if p.MaxItems > 0 && p.State.Items >= p.MaxItems {
+			stop = true
+			break
+		}
+		if len(p.DateField) > 0 {
+			dt, ok := p.itemDate(item)
+			if ok {
+				if p.DateFrom != nil && dt.Before(*p.DateFrom) {
+					if p.DateOrder < 0 {
+						stop = true
+						break
+					}
+					continue
+				}
+				if p.DateTo != nil && dt.After(*p.DateTo) {
+					if p.DateOrder > 0 {
+						stop = true
+						break
+					}
+					continue
+				}
+				if p.State.LastDate == nil || dt.After(*p.State.LastDate) {
+					t := dt
+					p.State.LastDate = &t
+				}
+			}
+		}
+		items = append(items, item)
+		p.State.Items++
+	}
+	if p.StopFunc != nil && p.StopFunc(all) {
+		stop = true
+	}
+	switch p.Kind {
+	case PaginateLink:
+		next := ParseLinkHeader(strings.Join(outHeaders["Link"], ", "))["next"]
+		p.State.URL = next
+		stop = stop || next == ""
+	case PaginateCursor:
+		cursor := ""
+		iface, ok := Dig(result, p.CursorPath, false, true)
+		if ok && iface != nil {
+			// Numeric cursors are parsed as float64, they must not be formatted in exponent notation
+			if f, isFloat := iface.(float64); isFloat {
+				cursor = strconv.FormatFloat(f, 'f', -1, 64)
+			} else {
+				cursor = fmt.Sprintf("%v", iface)
+			}
+		}
+		stop = stop || cursor == "" || cursor == p.State.Cursor
+		p.State.Cursor = cursor
+	case PaginateOffset:
+		p.State.Offset += nAll
+		stop = stop || (p.Limit > 0 && nAll < p.Limit)
+	case PaginatePage:
+		p.State.Page++
+		stop = stop || (p.PerPage > 0 && nAll < p.PerPage)
+	}
+	if stop {
+		p.State.Done = true
+		done = true
+	}
+	if p.Ctx.Debug > 1 {
+		Printf("%s: page %d, %d/%d items, state %+v\n", url, p.State.Pages, len(items), nAll, p.State)
+	}
+	return
+}
+
+// Commit - save checkpoint when CheckpointKey is set, call it after all items returned by Next were processed
+// Only ascending order guarantees that all items older than max date seen were already returned, otherwise it is saved after the last page
+func (p *Paginator) Commit() {
+	if p.CheckpointKey != "" && p.State.LastDate != nil && (p.DateOrder > 0 || p.State.Done) {
+		SetLastUpdate(p.Ctx, p.CheckpointKey, *p.State.LastDate)
+	}
+}
+
+// Each - fetch all pages and call itemFunc for every item, stops on first error
+// Checkpoint is saved after all items of a page were processed
+func (p *Paginator) Each(itemFunc func(item interface{}) error) (err error) {
+	for {
+		var (
+			items []interface{}
+			done  bool
+		)
+		items, done, err = p.Next()
+		if err != nil {
+			return
+		}
+		for _, item := range items {
+			err = itemFunc(item)
+			if err != nil {
+				return
+			}
+		}
+		p.Commit()
+		if done {
+			return
+		}
+	}
+}
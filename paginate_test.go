@@ -0,0 +1,66 @@
+package ds
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLinkHeader(t *testing.T) {
+	links := ParseLinkHeader(`<https://api.github.com/repositories/1/issues?page=2>; rel="next", <https://api.github.com/repositories/1/issues?page=5>; rel="last"`)
+	assert.Equal(t, "https://api.github.com/repositories/1/issues?page=2", links["next"])
+	assert.Equal(t, "https://api.github.com/repositories/1/issues?page=5", links["last"])
+
+	links = ParseLinkHeader(`<https://example.com/a?x=1,2>; title="x"; rel="prev first"`)
+	assert.Equal(t, "https://example.com/a?x=1,2", links["prev"])
+	assert.Equal(t, "https://example.com/a?x=1,2", links["first"])
+	_, ok := links["next"]
+	assert.False(t, ok)
+
+	assert.Equal(t, 0, len(ParseLinkHeader("")))
+}
+
+func TestPaginatorPageURL(t *testing.T) {
+	ctx := &Ctx{}
+	p := NewPagePaginator(ctx, "https://example.com/items?state=all", "page", "per_page", 100, 1)
+	url, err := p.pageURL()
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/items?page=1&per_page=100&state=all", url)
+
+	p = NewOffsetPaginator(ctx, "https://example.com/items", "start", "limit", 50)
+	p.State.Offset = 150
+	url, err = p.pageURL()
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/items?limit=50&start=150", url)
+
+	p = NewCursorPaginator(ctx, "https://example.com/items", "after", []string{"meta", "next"})
+	url, _ = p.pageURL()
+	assert.Equal(t, "https://example.com/items", url)
+	p.State.Cursor = "abc"
+	url, _ = p.pageURL()
+	assert.Equal(t, "https://example.com/items?after=abc", url)
+}
+
+func TestPaginatorNumericCursor(t *testing.T) {
+	cursors := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		after := r.URL.Query().Get("after")
+		cursors = append(cursors, after)
+		w.Header().Set("Content-Type", "application/json")
+		if after == "" {
+			_, _ = w.Write([]byte(`{"items":[{"id":1}],"next":1234567}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"items":[{"id":2}],"next":null}`))
+	}))
+	defer srv.Close()
+	p := NewCursorPaginator(&Ctx{}, srv.URL, "after", []string{"next"})
+	p.ItemsPath = []string{"items"}
+	n := 0
+	assert.NoError(t, p.Each(func(interface{}) error { n++; return nil }))
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{"", "1234567"}, cursors)
+	assert.True(t, p.State.Done)
+}
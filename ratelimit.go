@@ -0,0 +1,237 @@
+package ds
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRetryAfterHeader - header used by servers to tell how long to wait before the next request
+	DefaultRetryAfterHeader = "Retry-After"
+	// DefaultRateLimitWait - how long to wait when server reports rate limit without telling for how long
+	DefaultRateLimitWait = time.Minute
+	// MaxRateLimitWait - never wait longer than this for a rate limit reset
+	MaxRateLimitWait = 2 * time.Hour
+	// MaxRateLimitRetries - how many times Request retries a rate limited call (those retries are not counted in ctx.Retry)
+	MaxRateLimitRetries = 10
+)
+
+var (
+	rateLimits    = map[string]*RateLimitState{}
+	rateLimitsMtx = &sync.Mutex{}
+)
+
+// RateLimitInfo - rate limit information parsed from a single HTTP response
+type RateLimitInfo struct {
+	Known      bool          // remaining quota header was present
+	Remaining  int           // remaining quota (only if Known)
+	Reset      time.Time     // when quota resets (zero if unknown)
+	RetryAfter time.Duration // Retry-After header value (zero if not present)
+	Limited    bool          // response was rejected due to (primary or secondary) rate limit
+}
+
+// RateLimitState - rate limit quota tracked per host
+type RateLimitState struct {
+	Remaining int
+	Reset     time.Time
+}
+
+// RateLimitHost - returns host key used to track rate limits for a given URL
+func RateLimitHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	return strings.ToLower(u.Host)
+}
+
+// RateLimitHeaders - returns rate limit remaining & reset header names for a given context
+func RateLimitHeaders(ctx *Ctx) (remainingHeader, resetHeader string) {
+	remainingHeader, resetHeader = ctx.RateLimitHeader, ctx.RateLimitResetHeader
+	if remainingHeader == "" {
+		remainingHeader = DefaultRateLimitHeader
+	}
+	if resetHeader == "" {
+		resetHeader = DefaultRateLimitResetHeader
+	}
+	return
+}
+
+// ParseRateLimitReset - parse rate limit reset header value
+// Supports unix epoch seconds (GitHub), unix epoch milliseconds, seconds to reset (Gerrit, some GitLab setups) and dates (Jira, HTTP date)
+func ParseRateLimitReset(value string, now time.Time) (reset time.Time, ok bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err == nil {
+		ok = true
+		switch {
+		case f > 1e12:
+			reset = time.Unix(0, int64(f)*int64(time.Millisecond))
+		case f > 1e9:
+			reset = time.Unix(int64(f), 0)
+		default:
+			reset = now.Add(time.Duration(f * float64(time.Second)))
+		}
+		return
+	}
+	reset, err = http.ParseTime(value)
+	if err == nil {
+		ok = true
+		return
+	}
+	reset, err = time.Parse(time.RFC3339, value)
+	if err == nil {
+		ok = true
+		return
+	}
+	reset, err = TimeParseAny(value)
+	ok = err == nil
+	return
+}
+
+// ParseRetryAfter - parse Retry-After header value (number of seconds or HTTP date)
+func ParseRetryAfter(value string, now time.Time) (wait time.Duration, ok bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+	secs, err := strconv.Atoi(value)
+	if err == nil {
+		if secs < 0 {
+			secs = 0
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return
+	}
+	wait = t.Sub(now)
+	if wait < 0 {
+		wait = 0
+	}
+	ok = true
+	return
+}
+
+// GetRateLimitInfo - parse rate limit information from response status and headers
+// 429 is always considered rate limited, 403 only when quota is exhausted or Retry-After is present (GitHub secondary rate limits)
+func GetRateLimitInfo(ctx *Ctx, status int, headers map[string][]string) (info RateLimitInfo) {
+	if headers == nil {
+		info.Limited = status == http.StatusTooManyRequests
+		return
+	}
+	now := time.Now()
+	h := http.Header(headers)
+	remainingHeader, resetHeader := RateLimitHeaders(ctx)
+	sRemaining := strings.TrimSpace(h.Get(remainingHeader))
+	if sRemaining != "" {
+		remaining, err := strconv.Atoi(sRemaining)
+		if err == nil {
+			info.Remaining = remaining
+			info.Known = true
+		}
+	}
+	reset, ok := ParseRateLimitReset(h.Get(resetHeader), now)
+	if ok {
+		info.Reset = reset
+	}
+	retryAfter, ok := ParseRetryAfter(h.Get(DefaultRetryAfterHeader), now)
+	if ok {
+		info.RetryAfter = retryAfter
+	}
+	switch status {
+	case http.StatusTooManyRequests:
+		info.Limited = true
+	case http.StatusForbidden:
+		info.Limited = (info.Known && info.Remaining == 0) || info.RetryAfter > 0
+	}
+	return
+}
+
+// Wait - how long to wait before retrying a rate limited request
+func (info RateLimitInfo) Wait() (wait time.Duration) {
+	switch {
+	case info.RetryAfter > 0:
+		wait = info.RetryAfter
+	case !info.Reset.IsZero():
+		wait = time.Until(info.Reset)
+	default:
+		wait = DefaultRateLimitWait
+	}
+	if wait < time.Second {
+		wait = time.Second
+	}
+	if wait > MaxRateLimitWait {
+		wait = MaxRateLimitWait
+	}
+	return
+}
+
+// UpdateRateLimit - store rate limit quota reported for a given host
+func UpdateRateLimit(ctx *Ctx, host string, info RateLimitInfo) {
+	if !info.Known && !info.Limited {
+		return
+	}
+	rateLimitsMtx.Lock()
+	defer rateLimitsMtx.Unlock()
+	state, ok := rateLimits[host]
+	if !ok {
+		state = &RateLimitState{}
+		rateLimits[host] = state
+	}
+	if info.Known {
+		state.Remaining = info.Remaining
+	} else {
+		state.Remaining = 0
+	}
+	// Without reset time (only remaining quota header, or unknown window) quota is assumed to last DefaultRateLimitWait
+	now := time.Now()
+	if info.RetryAfter > 0 {
+		state.Reset = now.Add(info.RetryAfter)
+	} else if !info.Reset.IsZero() {
+		state.Reset = info.Reset
+	} else if info.Limited || !state.Reset.After(now) {
+		state.Reset = now.Add(DefaultRateLimitWait)
+	}
+	if ctx.Debug > 1 {
+		Printf("rate limit %s: remaining %d, reset %v, limited %v\n", host, state.Remaining, state.Reset, info.Limited)
+	}
+}
+
+// WaitForRateLimit - wait until host's quota resets when there are no more than ctx.MinRateLimit requests left
+// Reserves one request from the quota, so concurrent callers don't overuse it, returns error when ctx is cancelled while waiting
+func WaitForRateLimit(ctx *Ctx, host string) (err error) {
+	rateLimitsMtx.Lock()
+	state, ok := rateLimits[host]
+	if !ok {
+		rateLimitsMtx.Unlock()
+		return
+	}
+	var wait time.Duration
+	now := time.Now()
+	if state.Remaining <= ctx.MinRateLimit && now.Before(state.Reset) {
+		wait = state.Reset.Sub(now)
+		if wait > MaxRateLimitWait {
+			wait = MaxRateLimitWait
+		}
+	}
+	if now.After(state.Reset) {
+		delete(rateLimits, host)
+	} else {
+		state.Remaining--
+	}
+	rateLimitsMtx.Unlock()
+	if wait > 0 {
+		Printf("%s rate limit reached (min %d), waiting %v for reset\n", host, ctx.MinRateLimit, wait)
+		err = Sleep(ctx, wait)
+	}
+	return
+}
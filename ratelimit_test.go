@@ -0,0 +1,87 @@
+package ds
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRateLimitReset(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		value string
+		want  time.Time
+		ok    bool
+	}{
+		{"Empty", "", time.Time{}, false},
+		{"Epoch seconds", "1622552400", time.Unix(1622552400, 0), true},
+		{"Epoch milliseconds", "1622552400000", time.Unix(1622552400, 0), true},
+		{"Seconds to reset", "30", now.Add(30 * time.Second), true},
+		{"HTTP date", "Tue, 01 Jun 2021 13:00:00 GMT", time.Date(2021, 6, 1, 13, 0, 0, 0, time.UTC), true},
+		{"RFC3339", "2021-06-01T13:00:00Z", time.Date(2021, 6, 1, 13, 0, 0, 0, time.UTC), true},
+		{"Garbage", "soon", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseRateLimitReset(tt.value, now)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.True(t, tt.want.Equal(got), got.String())
+			}
+		})
+	}
+}
+
+func TestGetRateLimitInfo(t *testing.T) {
+	ctx := &Ctx{}
+	info := GetRateLimitInfo(ctx, 200, map[string][]string{"X-Ratelimit-Remaining": {"42"}})
+	assert.True(t, info.Known)
+	assert.Equal(t, 42, info.Remaining)
+	assert.False(t, info.Limited)
+
+	info = GetRateLimitInfo(ctx, 403, map[string][]string{"X-Ratelimit-Remaining": {"0"}})
+	assert.True(t, info.Limited)
+
+	info = GetRateLimitInfo(ctx, 403, map[string][]string{"Retry-After": {"60"}})
+	assert.True(t, info.Limited)
+	assert.Equal(t, time.Minute, info.Wait())
+
+	info = GetRateLimitInfo(ctx, 403, map[string][]string{})
+	assert.False(t, info.Limited)
+
+	info = GetRateLimitInfo(ctx, 429, nil)
+	assert.True(t, info.Limited)
+	assert.Equal(t, DefaultRateLimitWait, info.Wait())
+
+	ctx.RateLimitHeader = "RateLimit-Remaining"
+	info = GetRateLimitInfo(ctx, 200, map[string][]string{"Ratelimit-Remaining": {"7"}})
+	assert.Equal(t, 7, info.Remaining)
+}
+
+func TestWaitForRateLimitNoReset(t *testing.T) {
+	ctx := &Ctx{MinRateLimit: 1}
+	InitContext(ctx)
+	host := "remaining-only.example.com"
+	defer func() {
+		rateLimitsMtx.Lock()
+		delete(rateLimits, host)
+		rateLimitsMtx.Unlock()
+	}()
+	// API sends remaining quota without reset time
+	UpdateRateLimit(ctx, host, GetRateLimitInfo(ctx, 200, map[string][]string{"X-Ratelimit-Remaining": {"5"}}))
+	assert.Nil(t, WaitForRateLimit(ctx, host))
+	UpdateRateLimit(ctx, host, GetRateLimitInfo(ctx, 200, map[string][]string{"X-Ratelimit-Remaining": {"1"}}))
+	rateLimitsMtx.Lock()
+	state, ok := rateLimits[host]
+	assert.True(t, ok)
+	assert.True(t, state.Reset.After(time.Now()))
+	rateLimitsMtx.Unlock()
+	// Host is throttled, so WaitForRateLimit waits until context is cancelled
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		ctx.Cancel()
+	}()
+	assert.NotNil(t, WaitForRateLimit(ctx, host))
+}
@@ -1,11 +1,29 @@
 package ds
 
 import (
+	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
+const (
+	// RedactedPlaceholder - redacted data is replaced with this string
+	RedactedPlaceholder = "[redacted]"
+)
+
+// SecretPattern - well-known secret format detected by FilterRedacted even when it wasn't added via AddRedacted
+// Secret matched by Secret regexp is replaced, text matched by Prefix (before it) and Suffix (after it) is kept
+// Regexps must not use capturing groups, use (?:...) instead
+type SecretPattern struct {
+	Name   string
+	Prefix string
+	Secret string
+	Suffix string
+}
+
 var (
 	// GRedactedStrings - need to be global, to redact them from error logs
 	GRedactedStrings map[string]struct{}
@@ -13,16 +31,35 @@ var (
 	GRedactedMtx *sync.RWMutex
 	redactedOnce sync.Once
 	// AnonymizeURLPattern - used to remove sensitive data from the url - 3rd can be a GitHub password
+	// AnonymizeURL uses URLUserinfoPattern now, which also handles multiple URLs and '@' in URL paths
 	AnonymizeURLPattern = regexp.MustCompile(`(^.*)(://)(.*@)(.*$)`)
+	// URLUserinfoPattern - user[:password]@ part of URLs, 1st group is the scheme
+	URLUserinfoPattern = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.\-]*://)[^/?#\s@]+@`)
+	// SecretPatterns - secret formats always redacted by FilterRedacted, use AddSecretPattern to add more
+	SecretPatterns = []SecretPattern{
+		{Name: "github-token", Secret: `\b(?:gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{22,255})\b`},
+		{Name: "aws-access-key", Secret: `\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[A-Z0-9]{16}\b`},
+		{Name: "jwt", Secret: `\beyJ[A-Za-z0-9_\-]+\.eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+`},
+		{Name: "bearer", Prefix: `(?i:\bauthorization["']?\s*[:=]\s*["']?\[?bearer)\s+`, Secret: `[A-Za-z0-9\-._~+/]+=*`},
+		{Name: "url-userinfo", Prefix: `[a-zA-Z][a-zA-Z0-9+.\-]*://`, Secret: `[^/?#\s@]+`, Suffix: `@`},
+	}
+	// gRedactedMatcher - current *redactedMatcher, rebuilt when gRedactedVersion changes
+	gRedactedMatcher    atomic.Value
+	gRedactedMatcherMtx = &sync.Mutex{}
+	gRedactedVersion    int64
 )
 
+// redactedMatcher - replaces redacted strings in a single pass and then secret patterns
+// Each pattern regexp has 2 groups: prefix and suffix kept around the redacted secret
+type redactedMatcher struct {
+	replacer *strings.Replacer
+	patterns []*regexp.Regexp
+	version  int64
+}
+
 // AddRedacted - adds redacted string
 func AddRedacted(newRedacted string, useMutex bool) {
-	// Initialize map & mutex once
-	redactedOnce.Do(func() {
-		GRedactedStrings = make(map[string]struct{})
-		GRedactedMtx = &sync.RWMutex{}
-	})
+	initRedacted()
 	if useMutex {
 		GRedactedMtx.Lock()
 		defer func() {
@@ -30,25 +67,109 @@ func AddRedacted(newRedacted string, useMutex bool) {
 		}()
 	}
 	if len(newRedacted) > 3 {
-		GRedactedStrings[newRedacted] = struct{}{}
+		if _, ok := GRedactedStrings[newRedacted]; !ok {
+			GRedactedStrings[newRedacted] = struct{}{}
+			invalidateRedactedMatcher()
+		}
 	}
 }
 
-// FilterRedacted - filter out all known redacted starings
-func FilterRedacted(str string) string {
-	if GRedactedStrings == nil {
-		return str
+// AddSecretPattern - adds secret format redacted by FilterRedacted, returns error if its regexps are invalid, use capturing groups or secret can be empty
+func AddSecretPattern(pattern SecretPattern) error {
+	for _, expr := range []string{pattern.Prefix, pattern.Secret, pattern.Suffix} {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("invalid secret pattern %s: %v", pattern.Name, err)
+		}
+		if re.NumSubexp() > 0 {
+			return fmt.Errorf("invalid secret pattern %s: capturing groups are not allowed, use (?:...)", pattern.Name)
+		}
 	}
+	if regexp.MustCompile(pattern.Secret).MatchString("") {
+		return fmt.Errorf("invalid secret pattern %s: secret regexp matches empty string", pattern.Name)
+	}
+	initRedacted()
+	GRedactedMtx.Lock()
+	SecretPatterns = append(SecretPatterns, pattern)
+	invalidateRedactedMatcher()
+	GRedactedMtx.Unlock()
+	return nil
+}
+
+// initRedacted - initialize map & mutex once
+func initRedacted() {
+	redactedOnce.Do(func() {
+		GRedactedStrings = make(map[string]struct{})
+		GRedactedMtx = &sync.RWMutex{}
+	})
+}
+
+// invalidateRedactedMatcher - matcher will be rebuilt on next use
+func invalidateRedactedMatcher() {
+	atomic.AddInt64(&gRedactedVersion, 1)
+}
+
+// getRedactedMatcher - returns matcher for current redacted strings and secret patterns, builds it once per version
+func getRedactedMatcher() *redactedMatcher {
+	version := atomic.LoadInt64(&gRedactedVersion)
+	m, _ := gRedactedMatcher.Load().(*redactedMatcher)
+	if m != nil && m.version == version {
+		return m
+	}
+	gRedactedMatcherMtx.Lock()
+	defer gRedactedMatcherMtx.Unlock()
+	version = atomic.LoadInt64(&gRedactedVersion)
+	m, _ = gRedactedMatcher.Load().(*redactedMatcher)
+	if m != nil && m.version == version {
+		return m
+	}
+	initRedacted()
 	GRedactedMtx.RLock()
 	defer func() {
 		GRedactedMtx.RUnlock()
 	}()
+	// Replacer compares strings in argument order, longer strings first, so a redacted string containing another one is replaced as a whole
+	strs := make([]string, 0, len(GRedactedStrings))
 	for redacted := range GRedactedStrings {
-		str = strings.Replace(str, redacted, "[redacted]", -1)
+		strs = append(strs, redacted)
+	}
+	sort.Slice(strs, func(i, j int) bool {
+		if len(strs[i]) != len(strs[j]) {
+			return len(strs[i]) > len(strs[j])
+		}
+		return strs[i] < strs[j]
+	})
+	oldnew := make([]string, 0, 2*len(strs))
+	for _, redacted := range strs {
+		oldnew = append(oldnew, redacted, RedactedPlaceholder)
+	}
+	m = &redactedMatcher{version: version}
+	if len(oldnew) > 0 {
+		m.replacer = strings.NewReplacer(oldnew...)
+	}
+	for _, pattern := range SecretPatterns {
+		m.patterns = append(m.patterns, regexp.MustCompile("("+pattern.Prefix+")(?:"+pattern.Secret+")("+pattern.Suffix+")"))
+	}
+	gRedactedMatcher.Store(m)
+	return m
+}
+
+// replace - replace all redacted strings and secrets, keeping matched prefixes and suffixes
+func (m *redactedMatcher) replace(str string) string {
+	if m.replacer != nil {
+		str = m.replacer.Replace(str)
+	}
+	for _, re := range m.patterns {
+		str = re.ReplaceAllString(str, "${1}"+RedactedPlaceholder+"${2}")
 	}
 	return str
 }
 
+// FilterRedacted - filter out all known redacted strings and well-known secret formats (see SecretPatterns)
+func FilterRedacted(str string) string {
+	return getRedactedMatcher().replace(str)
+}
+
 // GetRedacted - get redacted
 func GetRedacted() (str string) {
 	if GRedactedStrings == nil {
@@ -66,7 +187,7 @@ func GetRedacted() (str string) {
 	return
 }
 
-// AnonymizeURL - remove sensitive data from the URL
+// AnonymizeURL - remove sensitive data (user and password) from the URL
 func AnonymizeURL(url string) string {
-	return AnonymizeURLPattern.ReplaceAllString(url, `$1$2$4`)
+	return URLUserinfoPattern.ReplaceAllString(url, `$1`)
 }
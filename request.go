@@ -8,10 +8,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
+	libErrs "github.com/LF-Engineering/insights-datasource-shared/errs"
 	jsoniter "github.com/json-iterator/go"
 )
 
@@ -122,31 +122,38 @@ func StringToCookie(s string) (c *http.Cookie) {
 	return
 }
 
-// RequestNoRetry - wrapper to do any HTTP request
-// jsonStatuses - set of status code ranges to be parsed as JSONs
-// errorStatuses - specify status value ranges for which we should return error
-// okStatuses - specify status value ranges for which we should return error (only taken into account if not empty)
-func RequestNoRetry(
+// InStatusRanges - is status within any of status ranges given
+func InStatusRanges(status int, ranges map[[2]int]struct{}) bool {
+	for r := range ranges {
+		if status >= r[0] && status <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// doRequest - creates and sends HTTP request, applies token pool and rate limits
+// Caller is responsible for closing response body
+func doRequest(
 	ctx *Ctx,
 	url, method string,
 	headers map[string]string,
 	payload []byte,
 	cookies []string,
-	jsonStatuses, errorStatuses, okStatuses, cacheStatuses map[[2]int]struct{},
-) (result interface{}, status int, isJSON bool, outCookies []string, outHeaders map[string][]string, cache bool, err error) {
+) (resp *http.Response, err error) {
 	var (
 		payloadBody *bytes.Reader
 		req         *http.Request
 	)
 	if len(payload) > 0 {
 		payloadBody = bytes.NewReader(payload)
-		req, err = http.NewRequest(method, url, payloadBody)
+		req, err = http.NewRequestWithContext(GetContext(ctx), method, url, payloadBody)
 	} else {
-		req, err = http.NewRequest(method, url, nil)
+		req, err = http.NewRequestWithContext(GetContext(ctx), method, url, nil)
 	}
 	if err != nil {
 		sPayload := BytesToStringTrunc(payload, MaxPayloadPrintfLen, true)
-		err = fmt.Errorf("new request error:%+v for method:%s url:%s payload:%s", err, method, url, sPayload)
+		err = libErrs.Wrap(libErrs.ErrPermanent, fmt.Errorf("new request error:%+v for method:%s url:%s payload:%s", err, method, url, sPayload))
 		return
 	}
 	for _, cookieStr := range cookies {
@@ -156,30 +163,95 @@ func RequestNoRetry(
 	for header, value := range headers {
 		req.Header.Set(header, value)
 	}
-	var resp *http.Response
-	resp, err = http.DefaultClient.Do(req)
+	host := RateLimitHost(url)
+	tokenIdx := -1
+	pool := GetTokenPool(ctx, host)
+	if pool != nil {
+		var (
+			token string
+			wait  time.Duration
+		)
+		tokenIdx, token, wait = pool.Acquire()
+		if wait > 0 {
+			Printf("%s all %d tokens exhausted, waiting %v for reset\n", host, pool.Len(), wait)
+			err = Sleep(ctx, wait)
+		}
+		req.Header.Set(pool.Header, token)
+	} else {
+		err = WaitForRateLimit(ctx, host)
+	}
+	if err != nil {
+		err = libErrs.Wrap(libErrs.Kind(err), fmt.Errorf("rate limit wait error:%+v for method:%s url:%s", err, method, url))
+		return
+	}
+	resp, err = HTTPClient(ctx).Do(req)
 	if err != nil {
 		sPayload := BytesToStringTrunc(payload, MaxPayloadPrintfLen, true)
-		err = fmt.Errorf("do request error:%+v for method:%s url:%s headers:%v payload:%s", err, method, url, headers, sPayload)
+		err = libErrs.Wrap(libErrs.Kind(err), fmt.Errorf("do request error:%+v for method:%s url:%s headers:%v payload:%s", err, method, url, headers, sPayload))
 		if strings.Contains(err.Error(), "socket: too many open files") {
 			Printf("too many open socets detected, sleeping for 3 seconds\n")
-			time.Sleep(time.Duration(3) * time.Second)
+			_ = Sleep(ctx, time.Duration(3)*time.Second)
 		}
 		return
 	}
+	if pool != nil {
+		pool.Update(ctx, tokenIdx, GetRateLimitInfo(ctx, resp.StatusCode, resp.Header))
+	} else {
+		UpdateRateLimit(ctx, host, GetRateLimitInfo(ctx, resp.StatusCode, resp.Header))
+	}
+	return
+}
+
+// statusError - classify error caused by response status, rate limited responses (for example 403 with exhausted quota) are rate-limited errors
+func statusError(ctx *Ctx, status int, headers map[string][]string, err error) error {
+	if GetRateLimitInfo(ctx, status, headers).Limited {
+		return &libErrs.Error{Kind: libErrs.ErrRateLimited, Status: status, Err: err}
+	}
+	return libErrs.HTTPError(status, err)
+}
+
+// RequestNoRetry - wrapper to do any HTTP request
+// Returned errors are classified, see errs package: errs.IsRetryable(err), errs.IsNotFound(err) etc.
+// jsonStatuses - set of status code ranges to be parsed as JSONs
+// errorStatuses - specify status value ranges for which we should return error
+// okStatuses - specify status value ranges for which we should return error (only taken into account if not empty)
+func RequestNoRetry(
+	ctx *Ctx,
+	url, method string,
+	headers map[string]string,
+	payload []byte,
+	cookies []string,
+	jsonStatuses, errorStatuses, okStatuses, cacheStatuses map[[2]int]struct{},
+) (result interface{}, status int, isJSON bool, outCookies []string, outHeaders map[string][]string, cache bool, err error) {
+	var resp *http.Response
+	resp, err = doRequest(ctx, url, method, headers, payload, cookies)
+	if err != nil {
+		return
+	}
+	// Body must be closed on every path, it holds an in-flight slot for the host
+	defer func() { _ = resp.Body.Close() }()
 	var body []byte
 	body, err = ioutil.ReadAll(resp.Body)
 	if err != nil {
 		sPayload := BytesToStringTrunc(payload, MaxPayloadPrintfLen, true)
-		err = fmt.Errorf("read request body error:%+v for method:%s url:%s headers:%v payload:%s", err, method, url, headers, sPayload)
+		// Truncated bodies and connection resets are retried, unless request was cancelled
+		kind := libErrs.ErrRetryable
+		if GetContext(ctx).Err() != nil {
+			kind = libErrs.Kind(err)
+		}
+		err = libErrs.Wrap(kind, fmt.Errorf("read request body error:%+v for method:%s url:%s headers:%v payload:%s", err, method, url, headers, sPayload))
 		return
 	}
-	_ = resp.Body.Close()
 	for _, cookie := range resp.Cookies() {
 		outCookies = append(outCookies, CookieToString(cookie))
 	}
 	outHeaders = resp.Header
 	status = resp.StatusCode
+	if status == http.StatusNotModified && IsConditionalRequest(headers) {
+		// 304 is an expected response to a conditional request, Request uses its cached response then
+		result = body
+		return
+	}
 	hit := false
 	for r := range jsonStatuses {
 		if status >= r[0] && status <= r[1] {
@@ -193,6 +265,12 @@ func RequestNoRetry(
 			sPayload := BytesToStringTrunc(payload, MaxPayloadPrintfLen, true)
 			sBody := BytesToStringTrunc(body, MaxPayloadPrintfLen, true)
 			err = fmt.Errorf("unmarshall request error:%+v for method:%s url:%s headers:%v status:%d payload:%s body:%s", err, method, url, headers, status, sPayload, sBody)
+			if status >= http.StatusInternalServerError || status == http.StatusTooManyRequests {
+				// Overloaded servers and proxies return non-JSON error pages, these are retried
+				err = statusError(ctx, status, outHeaders, err)
+				return
+			}
+			err = libErrs.Wrap(libErrs.ErrPermanent, err)
 			return
 		}
 		isJSON = true
@@ -216,7 +294,7 @@ func RequestNoRetry(
 		} else {
 			sResult = InterfaceToStringTrunc(result, MaxPayloadPrintfLen, true)
 		}
-		err = fmt.Errorf("status error:%+v for method:%s url:%s headers:%v status:%d payload:%s body:%s result:%+v", err, method, url, headers, status, sPayload, sBody, sResult)
+		err = statusError(ctx, status, outHeaders, fmt.Errorf("status error:%+v for method:%s url:%s headers:%v status:%d payload:%s body:%s result:%+v", err, method, url, headers, status, sPayload, sBody, sResult))
 	}
 	if len(okStatuses) > 0 {
 		hit = false
@@ -236,7 +314,7 @@ func RequestNoRetry(
 			} else {
 				sResult = InterfaceToStringTrunc(result, MaxPayloadPrintfLen, true)
 			}
-			err = fmt.Errorf("status not success:%+v for method:%s url:%s headers:%v status:%d payload:%s body:%s result:%+v", err, method, url, headers, status, sPayload, sBody, sResult)
+			err = statusError(ctx, status, outHeaders, fmt.Errorf("status not success:%+v for method:%s url:%s headers:%v status:%d payload:%s body:%s result:%+v", err, method, url, headers, status, sPayload, sBody, sResult))
 		}
 	}
 	if err == nil {
@@ -251,6 +329,7 @@ func RequestNoRetry(
 }
 
 // Request - wrapper around RequestNoRetry supporting retries
+// Permanent errors (see errs package), for example 4xx statuses other than 408 and 429, are not retried
 func Request(
 	ctx *Ctx,
 	url, method string,
@@ -269,8 +348,10 @@ func Request(
 		return
 	}
 	var (
-		isJSON bool
-		cache  bool
+		isJSON     bool
+		cache      bool
+		revalidate bool
+		stale      CachedResponse
 	)
 	// fmt.Printf("url=%s method=%s headers=%+v payload=%+v cookies=%+v\n", url, method, headers, payload, cookies)
 	if cacheFor != nil && !ctx.NoCache {
@@ -282,70 +363,79 @@ func Request(
 		_, e := hash.Write(b)
 		if e == nil {
 			hsh := hex.EncodeToString(hash.Sum(nil))
-			cached, ok := GetL2Cache(ctx, hsh)
+			requestCache := GetRequestCache(ctx)
+			cached, ok := requestCache.Get(ctx, hsh)
 			if ok {
-				// cache entry is 'status:isJson:b64cookies:headers:data
-				ary := bytes.Split(cached, []byte(":"))
-				if len(ary) >= 5 {
-					var e error
-					status, e = strconv.Atoi(string(ary[0]))
-					if e == nil {
-						var iJSON int
-						iJSON, e = strconv.Atoi(string(ary[1]))
+				entry, e := DecodeCachedResponse(cached)
+				if e == nil {
+					etag, lastModified := CacheValidators(entry.Headers)
+					fresh := ctx.CacheRevalidateFor <= 0 || (etag == "" && lastModified == "")
+					if !fresh {
+						_, fresh = requestCache.Get(ctx, hsh+CacheFreshSuffix)
+					}
+					if fresh {
+						result, e = entry.Result()
 						if e == nil {
-							outCookies, e = Base64DecodeCookies(ary[2])
-							if e == nil {
-								outHeaders, e = Base64DecodeHeaders(ary[3])
-								if e == nil {
-									resData := bytes.Join(ary[4:], []byte(":"))
-									if iJSON == 0 {
-										result = resData
-										return
-									}
-									var r interface{}
-									e = jsoniter.Unmarshal(resData, &r)
-									if e == nil {
-										result = r
-										return
-									}
-								}
-							}
+							status, outCookies, outHeaders = entry.Status, entry.Cookies, entry.Headers
+							return
 						}
+					} else {
+						// stale entry with validators: ask server if it has changed
+						revalidate, stale = true, entry
+						headers = ConditionalHeaders(headers, etag, lastModified)
 					}
 				}
 			}
 			cacheDuration := *cacheFor
 			defer func() {
-				if err != nil || !cache {
+				if err != nil {
 					return
 				}
-				// cache entry is 'status:isJson:b64cookies:headers:data
-				b64cookies := Base64EncodeCookies(outCookies)
-				b64headers := Base64EncodeHeaders(outHeaders)
-				data := []byte(fmt.Sprintf("%d:", status))
+				if revalidate && status == http.StatusNotModified {
+					var e error
+					result, e = stale.Result()
+					if e != nil {
+						err = libErrs.Errorf(libErrs.ErrPermanent, "cannot decode revalidated cache entry error:%+v for method:%s url:%s", e, method, url)
+						return
+					}
+					status, isJSON, outCookies = stale.Status, stale.IsJSON, stale.Cookies
+					outHeaders = MergeNotModifiedHeaders(stale.Headers, outHeaders)
+					cache = true
+					if ctx.Debug > 1 {
+						Printf("%s.%s: not modified, renewing cache entry\n", method, url)
+					}
+				}
+				if !cache {
+					return
+				}
+				entry := CachedResponse{Status: status, IsJSON: isJSON, Cookies: outCookies, Headers: outHeaders}
 				if isJSON {
 					bts, e := jsoniter.Marshal(result)
 					if e != nil {
 						return
 					}
-					data = append(data, []byte("1:")...)
-					data = append(data, b64cookies...)
-					data = append(data, []byte(":")...)
-					data = append(data, b64headers...)
-					data = append(data, []byte(":")...)
-					data = append(data, bts...)
-					tag := FilterRedacted(fmt.Sprintf("%s.%s(#h=%d,pl=%d,cks=%d) -> sts=%d,js=1,resp=%d,cks=%d,hdrs=%d", method, url, len(headers), len(payload), len(cookies), status, len(bts), len(outCookies), len(outHeaders)))
-					SetL2Cache(ctx, hsh, tag, data, cacheDuration)
+					entry.Data = bts
+				} else {
+					entry.Data = result.([]byte)
+				}
+				js := 0
+				if isJSON {
+					js = 1
+				}
+				tag := FilterRedacted(fmt.Sprintf("%s.%s(#h=%d,pl=%d,cks=%d) -> sts=%d,js=%d,resp=%d,cks=%d,hdrs=%d", method, url, len(headers), len(payload), len(cookies), status, js, len(entry.Data), len(outCookies), len(outHeaders)))
+				data, e := EncodeCachedResponse(entry, ctx.CacheCompression)
+				if e != nil {
+					Printf("cannot encode cache entry %s: %+v\n", tag, e)
 					return
 				}
-				data = append(data, []byte("0:")...)
-				data = append(data, b64cookies...)
-				data = append(data, []byte(":")...)
-				data = append(data, b64headers...)
-				data = append(data, []byte(":")...)
-				data = append(data, result.([]byte)...)
-				tag := FilterRedacted(fmt.Sprintf("%s.%s(#h=%d,pl=%d,cks=%d) -> sts=%d,js=0,resp=%d,cks=%d,hdrs=%d", method, url, len(headers), len(payload), len(cookies), status, len(result.([]byte)), len(outCookies), len(outHeaders)))
-				SetL2Cache(ctx, hsh, tag, data, cacheDuration)
+				etag, lastModified := CacheValidators(outHeaders)
+				if ctx.CacheRevalidateFor > 0 && (etag != "" || lastModified != "") {
+					// keep entry for revalidation after it becomes stale, freshness is tracked by a separate marker
+					requestCache.Set(ctx, hsh, tag, data, cacheDuration+ctx.CacheRevalidateFor)
+					requestCache.Set(ctx, hsh+CacheFreshSuffix, tag, []byte("1"), cacheDuration)
+					return
+				}
+				requestCache.Set(ctx, hsh, tag, data, cacheDuration)
 			}()
 		}
 	}
@@ -353,7 +443,7 @@ func Request(
 		result, status, isJSON, outCookies, outHeaders, cache, err = RequestNoRetry(ctx, url, method, headers, payload, cookies, jsonStatuses, errorStatuses, okStatuses, cacheStatuses)
 		return
 	}
-	retry := 0
+	retry, rateLimitRetry := 0, 0
 	for {
 		result, status, isJSON, outCookies, outHeaders, cache, err = RequestNoRetry(ctx, url, method, headers, payload, cookies, jsonStatuses, errorStatuses, okStatuses, cacheStatuses)
 		info := func() (inf string) {
@@ -366,6 +456,34 @@ func Request(
 			return
 		}
 		if err != nil {
+			rateLimit := GetRateLimitInfo(ctx, status, outHeaders)
+			if rateLimit.Limited && rateLimitRetry < MaxRateLimitRetries {
+				rateLimitRetry++
+				wait := rateLimit.Wait()
+				pool := GetTokenPool(ctx, RateLimitHost(url))
+				if pool != nil {
+					wait = pool.Wait()
+				}
+				Printf("rate limited #%d %s, waiting %v\n", rateLimitRetry, info(), wait)
+				e := Sleep(ctx, wait)
+				if e != nil {
+					Printf("%s cancelled: %v\n", info(), e)
+					err = libErrs.Classify(e)
+					return
+				}
+				continue
+			}
+			if e := GetContext(ctx).Err(); e != nil {
+				Printf("%s cancelled: %v\n", info(), e)
+				err = libErrs.Classify(e)
+				return
+			}
+			if libErrs.IsPermanent(err) {
+				if ctx.Debug > 0 {
+					Printf("%s failed with %v error, not retrying\n", info(), libErrs.Kind(err))
+				}
+				return
+			}
 			retry++
 			if retry > ctx.Retry {
 				Printf("%s failed after %d retries\n", info(), retry)
@@ -373,7 +491,12 @@ func Request(
 			}
 			seconds := (retry + 1) * (retry + 1)
 			Printf("will do #%d retry of %s after %d seconds\n", retry, info(), seconds)
-			time.Sleep(time.Duration(seconds) * time.Second)
+			e := Sleep(ctx, time.Duration(seconds)*time.Second)
+			if e != nil {
+				Printf("%s cancelled: %v\n", info(), e)
+				err = libErrs.Classify(e)
+				return
+			}
 			Printf("retrying #%d retry of %s after %d seconds\n", retry, info(), seconds)
 			continue
 		}
@@ -0,0 +1,61 @@
+package ds
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	libErrs "github.com/LF-Engineering/insights-datasource-shared/errs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestNoRetryJSONError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			w.WriteHeader(http.StatusOK)
+		case "/bad-request":
+			w.WriteHeader(http.StatusBadRequest)
+		case "/too-many":
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "/bad-gateway":
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		_, _ = w.Write([]byte("<html>not a JSON</html>"))
+	}))
+	defer srv.Close()
+	ctx := &Ctx{}
+	jsonStatuses := map[[2]int]struct{}{{200, 599}: {}}
+	var testCases = []struct {
+		path      string
+		retryable bool
+		limited   bool
+	}{
+		{path: "/ok"},
+		{path: "/bad-request"},
+		{path: "/bad-gateway", retryable: true},
+		// Last, host is rate limited after this response
+		{path: "/too-many", retryable: true, limited: true},
+	}
+	for _, tc := range testCases {
+		_, _, _, _, _, _, err := RequestNoRetry(ctx, srv.URL+tc.path, "GET", nil, nil, nil, jsonStatuses, nil, nil, nil)
+		assert.Error(t, err, tc.path)
+		assert.Contains(t, err.Error(), "unmarshall request error", tc.path)
+		assert.Equal(t, tc.retryable, libErrs.IsRetryable(err), tc.path)
+		assert.Equal(t, tc.limited, libErrs.IsRateLimited(err), tc.path)
+		assert.Equal(t, !tc.retryable, libErrs.IsPermanent(err), tc.path)
+	}
+}
+
+func TestRequestNoRetryTruncatedBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Connection is closed before Content-Length bytes are sent
+		w.Header().Set("Content-Length", "100")
+		_, _ = w.Write([]byte(`{"id":`))
+	}))
+	defer srv.Close()
+	_, _, _, _, _, _, err := RequestNoRetry(&Ctx{}, srv.URL, "GET", nil, nil, nil, nil, nil, nil, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "read request body error")
+	assert.True(t, libErrs.IsRetryable(err))
+}
@@ -0,0 +1,178 @@
+package ds
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/LF-Engineering/insights-datasource-shared/aws/ssm"
+)
+
+const (
+	// SecretSSMPrefix - value is read from AWS SSM parameter store (decrypted), for example: ssm://github-token
+	SecretSSMPrefix = "ssm://"
+	// SecretFilePrefix - value is read from file (trailing new lines are removed), for example: file:///run/secrets/token
+	SecretFilePrefix = "file://"
+	// SecretEnvPrefix - value is read from other environment variable, for example: env://GITHUB_TOKEN
+	SecretEnvPrefix = "env://"
+)
+
+var (
+	// SecretResolvers - secret reference prefix -> function returning secret for a given name (reference without prefix)
+	SecretResolvers = map[string]func(name string) (string, error){
+		SecretSSMPrefix:  resolveSSMSecret,
+		SecretFilePrefix: resolveFileSecret,
+		SecretEnvPrefix:  resolveEnvSecret,
+	}
+	// DefaultSecretOptions - context options which can hold secret references, see IsSecretOption
+	DefaultSecretOptions = []string{"es-url", "http-proxy"}
+	secretsCache         = map[string]string{}
+	secretsCacheMtx      = &sync.Mutex{}
+)
+
+// IsSecretRef - is value a secret reference (ssm://, file:// or env://)?
+func IsSecretRef(value string) bool {
+	for prefix := range SecretResolvers {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddSecretOptions - declare data source options (flag names without data source prefix) holding secrets
+// Only secret options have secret references resolved, so other options can hold values like file:// URLs, call it before Init
+func (ctx *Ctx) AddSecretOptions(names ...string) {
+	if ctx.secretOptions == nil {
+		ctx.secretOptions = make(map[string]struct{})
+	}
+	for _, name := range names {
+		ctx.secretOptions[secretOptionName(name)] = struct{}{}
+	}
+}
+
+// IsSecretOption - can option (flag name without data source prefix or env name without prefix) hold a secret reference?
+// Those are DefaultSecretOptions, options declared by AddSecretOptions and options with sensitive names (see IsSensitiveOption)
+func (ctx *Ctx) IsSecretOption(name string) bool {
+	name = secretOptionName(name)
+	if _, ok := ctx.secretOptions[name]; ok {
+		return true
+	}
+	for _, option := range DefaultSecretOptions {
+		if name == option {
+			return true
+		}
+	}
+	return IsSensitiveOption(name)
+}
+
+// secretOptionName - option name from flag or env name: ES_URL -> es-url
+func secretOptionName(name string) string {
+	return strings.ToLower(strings.Replace(name, "_", "-", -1))
+}
+
+// ResolveSecret - returns value unchanged unless it is a secret reference, then returns the secret it points to
+// Resolved secrets are cached and added to redacted strings, so they never appear in logs
+func ResolveSecret(value string) (secret string, err error) {
+	var (
+		prefix  string
+		resolve func(string) (string, error)
+	)
+	for p, r := range SecretResolvers {
+		if strings.HasPrefix(value, p) {
+			prefix, resolve = p, r
+			break
+		}
+	}
+	if resolve == nil {
+		secret = value
+		return
+	}
+	secretsCacheMtx.Lock()
+	defer secretsCacheMtx.Unlock()
+	secret, ok := secretsCache[value]
+	if ok {
+		return
+	}
+	secret, err = resolve(value[len(prefix):])
+	if err != nil {
+		err = fmt.Errorf("cannot resolve secret %s: %v", value, err)
+		return
+	}
+	AddRedacted(secret, true)
+	secretsCache[value] = secret
+	return
+}
+
+// ResolveSecretFlags - replaces secret references passed as secret options flags (or in config file) with their values
+func ResolveSecretFlags(ctx *Ctx) (err error) {
+	fs := ctx.FlagSet()
+	refs := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		value := f.Value.String()
+		if strings.HasPrefix(f.Name, ctx.DSFlag) && ctx.IsSecretOption(strings.TrimPrefix(f.Name, ctx.DSFlag)) && IsSecretRef(value) {
+			refs[f.Name] = value
+		}
+	})
+	for name, ref := range refs {
+		var secret string
+		secret, err = ResolveSecret(ref)
+		if err != nil {
+			return
+		}
+		err = fs.Set(name, secret)
+		if err != nil {
+			return
+		}
+		if ctx.Debug > 1 {
+			Printf("resolved secret reference %s for flag %s\n", ref, name)
+		}
+	}
+	return
+}
+
+// ResolveSecretEnvs - resolves secret references set in secret options env variables, so Env can use resolved values
+func ResolveSecretEnvs(ctx *Ctx) (err error) {
+	ctx.FlagSet().VisitAll(func(f *flag.Flag) {
+		if err != nil || !strings.HasPrefix(f.Name, ctx.DSFlag) {
+			return
+		}
+		name := strings.TrimPrefix(f.Name, ctx.DSFlag)
+		if !ctx.IsSecretOption(name) {
+			return
+		}
+		value, present := os.LookupEnv(ctx.EnvName(name))
+		if present && IsSecretRef(value) {
+			_, err = ResolveSecret(value)
+		}
+	})
+	return
+}
+
+func resolveSSMSecret(name string) (value string, err error) {
+	client, err := ssm.NewSSMClient()
+	if err != nil {
+		return
+	}
+	return client.Param(name, true, false, "", "", "").GetValue()
+}
+
+func resolveFileSecret(path string) (value string, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	value = strings.TrimRight(string(data), "\r\n")
+	return
+}
+
+func resolveEnvSecret(name string) (value string, err error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		err = fmt.Errorf("environment variable %s is not set", name)
+	}
+	return
+}
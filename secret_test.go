@@ -0,0 +1,87 @@
+package ds
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	libErrs "github.com/LF-Engineering/insights-datasource-shared/errs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveSecret(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secret")
+	assert.Nil(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "token")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("file-secret-value\n"), 0600))
+	assert.Nil(t, os.Setenv("SECRET_TEST_TOKEN", "env-secret-value"))
+	defer func() { _ = os.Unsetenv("SECRET_TEST_TOKEN") }()
+	var testCases = []struct {
+		value    string
+		expected string
+		err      bool
+	}{
+		{value: "plain-value", expected: "plain-value"},
+		{value: "file://" + path, expected: "file-secret-value"},
+		{value: "env://SECRET_TEST_TOKEN", expected: "env-secret-value"},
+		{value: "env://SECRET_TEST_MISSING", err: true},
+		{value: "file://" + filepath.Join(dir, "missing"), err: true},
+	}
+	for _, tc := range testCases {
+		secret, err := ResolveSecret(tc.value)
+		if tc.err {
+			assert.NotNil(t, err, tc.value)
+			continue
+		}
+		assert.Nil(t, err, tc.value)
+		assert.Equal(t, tc.expected, secret, tc.value)
+	}
+	assert.Equal(t, "token=[redacted]", FilterRedacted("token=env-secret-value"))
+}
+
+func TestResolveSecretFlags(t *testing.T) {
+	assert.Nil(t, os.Setenv("SECRET_FLAG_TEST_TOKEN", "flag-secret-value"))
+	defer func() { _ = os.Unsetenv("SECRET_FLAG_TEST_TOKEN") }()
+	var ctx Ctx
+	ctx.InitEnv("secret ds")
+	ctx.Flags = flag.NewFlagSet("test", flag.ContinueOnError)
+	ctx.AddSecretOptions("ssh_identity")
+	token := ctx.Flags.String("secret-ds-token", "", "")
+	identity := ctx.Flags.String("secret-ds-ssh-identity", "", "")
+	repo := ctx.Flags.String("secret-ds-repo-url", "", "")
+	other := ctx.Flags.String("other", "", "")
+	assert.Nil(t, ctx.Flags.Parse([]string{
+		"--secret-ds-token", "env://SECRET_FLAG_TEST_TOKEN",
+		"--secret-ds-ssh-identity", "env://SECRET_FLAG_TEST_TOKEN",
+		"--secret-ds-repo-url", "file:///path/to/repo",
+		"--other", "env://SECRET_FLAG_TEST_TOKEN",
+	}))
+	assert.Nil(t, ResolveSecretFlags(&ctx))
+	assert.Equal(t, "flag-secret-value", *token)
+	assert.Equal(t, "flag-secret-value", *identity)
+	// Only secret options are resolved
+	assert.Equal(t, "file:///path/to/repo", *repo)
+	assert.Equal(t, "env://SECRET_FLAG_TEST_TOKEN", *other)
+}
+
+func TestEnvE(t *testing.T) {
+	var ctx Ctx
+	ctx.InitEnv("secret env ds")
+	assert.Nil(t, os.Setenv("SECRET_ENV_DS_TOKEN", "env://SECRET_ENV_TEST_MISSING"))
+	defer func() { _ = os.Unsetenv("SECRET_ENV_DS_TOKEN") }()
+	_, err := ctx.EnvE("TOKEN")
+	assert.NotNil(t, err)
+	assert.True(t, libErrs.IsConfig(err))
+	assert.Nil(t, os.Setenv("SECRET_ENV_DS_TOKEN", "plain-value"))
+	v, err := ctx.EnvE("TOKEN")
+	assert.Nil(t, err)
+	assert.Equal(t, "plain-value", v)
+	assert.Nil(t, os.Setenv("SECRET_ENV_DS_REPO_URL", "file:///path/to/repo"))
+	defer func() { _ = os.Unsetenv("SECRET_ENV_DS_REPO_URL") }()
+	v, err = ctx.EnvE("REPO_URL")
+	assert.Nil(t, err)
+	assert.Equal(t, "file:///path/to/repo", v)
+}
@@ -0,0 +1,163 @@
+package ds
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	libErrs "github.com/LF-Engineering/insights-datasource-shared/errs"
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	// StreamBufferSize - buffer size used when parsing streamed JSON responses
+	StreamBufferSize = 0x10000
+)
+
+// RequestStream - do HTTP request and return response body as a stream instead of reading it into memory
+// Use it for big downloads (archives, mbox files, huge JSON exports), caller must close returned body
+// errorStatuses - specify status value ranges for which we should return error
+// okStatuses - specify status value ranges for which we should return error (only taken into account if not empty)
+// When error is returned body is nil (truncated body is included in error message)
+// Returned errors are classified the same way as RequestNoRetry errors, see errs package
+func RequestStream(
+	ctx *Ctx,
+	url, method string,
+	headers map[string]string,
+	payload []byte,
+	cookies []string,
+	errorStatuses, okStatuses map[[2]int]struct{},
+) (body io.ReadCloser, status int, outCookies []string, outHeaders map[string][]string, err error) {
+	var resp *http.Response
+	resp, err = doRequest(ctx, url, method, headers, payload, cookies)
+	if err != nil {
+		return
+	}
+	for _, cookie := range resp.Cookies() {
+		outCookies = append(outCookies, CookieToString(cookie))
+	}
+	outHeaders = resp.Header
+	status = resp.StatusCode
+	statusErr := ""
+	if InStatusRanges(status, errorStatuses) {
+		statusErr = "status error"
+	} else if len(okStatuses) > 0 && !InStatusRanges(status, okStatuses) {
+		statusErr = "status not success"
+	}
+	if statusErr != "" {
+		bts, _ := ioutil.ReadAll(io.LimitReader(resp.Body, MaxPayloadPrintfLen))
+		_ = resp.Body.Close()
+		sPayload := BytesToStringTrunc(payload, MaxPayloadPrintfLen, true)
+		sBody := BytesToStringTrunc(bts, MaxPayloadPrintfLen, true)
+		err = statusError(ctx, status, outHeaders, fmt.Errorf("%s for method:%s url:%s headers:%v status:%d payload:%s body:%s", statusErr, method, url, headers, status, sPayload, sBody))
+		return
+	}
+	body = resp.Body
+	return
+}
+
+// RequestStreamJSONArray - do HTTP request returning top level JSON array and call itemFunc for every array item
+// Items are decoded one by one using jsoniter stream API, so the whole response is never held in memory
+// jsonStatuses - set of status code ranges to be parsed as JSONs, other non-error statuses return error
+// errorStatuses, okStatuses - the same meaning as in RequestStream
+// itemFunc can stop processing by returning an error which is then returned to the caller (wrapped, its classification is kept)
+// Responses ending before the array is complete return retryable error, malformed JSONs return permanent error
+func RequestStreamJSONArray(
+	ctx *Ctx,
+	url, method string,
+	headers map[string]string,
+	payload []byte,
+	cookies []string,
+	jsonStatuses, errorStatuses, okStatuses map[[2]int]struct{},
+	itemFunc func(item interface{}) error,
+) (nItems, status int, outCookies []string, outHeaders map[string][]string, err error) {
+	var body io.ReadCloser
+	body, status, outCookies, outHeaders, err = RequestStream(ctx, url, method, headers, payload, cookies, errorStatuses, okStatuses)
+	if err != nil {
+		return
+	}
+	defer func() { _ = body.Close() }()
+	if !InStatusRanges(status, jsonStatuses) {
+		err = libErrs.Errorf(libErrs.ErrPermanent, "status:%d is not a JSON status for method:%s url:%s headers:%v", status, method, url, headers)
+		return
+	}
+	nItems, err = StreamJSONArray(body, itemFunc)
+	if err == nil {
+		// Read what is left after the array (white space), so the whole response can be recorded and connection reused
+		_, _ = io.Copy(ioutil.Discard, io.LimitReader(body, MaxPayloadPrintfLen))
+	}
+	if err != nil {
+		kind := libErrs.Kind(err)
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			// Connection was closed in the middle of the response
+			kind = libErrs.ErrRetryable
+		}
+		sPayload := BytesToStringTrunc(payload, MaxPayloadPrintfLen, true)
+		err = libErrs.Wrap(kind, fmt.Errorf("stream JSON array error:%w after %d items for method:%s url:%s headers:%v status:%d payload:%s", err, nItems, method, url, headers, status, sPayload))
+	}
+	return
+}
+
+// streamReader - remembers error of the first read returning no data, parser needed more input than there was then
+type streamReader struct {
+	r   io.Reader
+	err error
+}
+
+func (s *streamReader) Read(p []byte) (n int, err error) {
+	n, err = s.r.Read(p)
+	if n == 0 && err != nil && s.err == nil {
+		s.err = err
+	}
+	return
+}
+
+// StreamJSONArray - decode top level JSON array from reader calling itemFunc for every item
+// Input ending before the array is complete returns io.ErrUnexpectedEOF (or reader's error if it failed), itemFunc errors are returned unchanged
+func StreamJSONArray(reader io.Reader, itemFunc func(item interface{}) error) (nItems int, err error) {
+	sr := &streamReader{r: reader}
+	iter := jsoniter.Parse(jsoniter.ConfigCompatibleWithStandardLibrary, sr, StreamBufferSize)
+	parseError := func() error {
+		switch {
+		case sr.err == io.EOF:
+			return io.ErrUnexpectedEOF
+		case sr.err != nil:
+			return sr.err
+		case iter.Error != nil:
+			return iter.Error
+		}
+		return fmt.Errorf("cannot parse JSON array")
+	}
+	if iter.WhatIsNext() != jsoniter.ArrayValue {
+		if iter.Error != nil || sr.err != nil {
+			err = parseError()
+			return
+		}
+		err = fmt.Errorf("top level JSON value is not an array")
+		return
+	}
+	var itemErr error
+	ok := iter.ReadArrayCB(func(it *jsoniter.Iterator) bool {
+		var item interface{}
+		it.ReadVal(&item)
+		if it.Error != nil {
+			return false
+		}
+		itemErr = itemFunc(item)
+		if itemErr != nil {
+			return false
+		}
+		nItems++
+		return true
+	})
+	if itemErr != nil {
+		err = itemErr
+		return
+	}
+	if !ok {
+		err = parseError()
+	}
+	return
+}
@@ -0,0 +1,140 @@
+package ds
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	libErrs "github.com/LF-Engineering/insights-datasource-shared/errs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/chunked":
+			// Flushing makes server use chunked transfer encoding
+			for _, chunk := range []string{"line 1\n", "line 2\n", "line 3\n"} {
+				_, _ = w.Write([]byte(chunk))
+				w.(http.Flusher).Flush()
+			}
+		case "/not-found":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("no such object"))
+		case "/unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/no-content":
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+	ctx := &Ctx{}
+	errorStatuses := map[[2]int]struct{}{{400, 599}: {}}
+	body, status, _, _, err := RequestStream(ctx, srv.URL+"/chunked", "GET", nil, nil, nil, errorStatuses, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	data, err := ioutil.ReadAll(body)
+	assert.NoError(t, err)
+	_ = body.Close()
+	assert.Equal(t, "line 1\nline 2\nline 3\n", string(data))
+	var testCases = []struct {
+		path      string
+		ok        map[[2]int]struct{}
+		status    int
+		retryable bool
+		notFound  bool
+	}{
+		{path: "/not-found", status: http.StatusNotFound, notFound: true},
+		{path: "/unavailable", status: http.StatusServiceUnavailable, retryable: true},
+		{path: "/no-content", ok: map[[2]int]struct{}{{200, 200}: {}}, status: http.StatusNoContent},
+	}
+	for _, tc := range testCases {
+		body, status, _, _, err := RequestStream(ctx, srv.URL+tc.path, "GET", nil, nil, nil, errorStatuses, tc.ok)
+		assert.Nil(t, body, tc.path)
+		assert.Equal(t, tc.status, status, tc.path)
+		assert.Error(t, err, tc.path)
+		assert.Equal(t, tc.retryable, libErrs.IsRetryable(err), tc.path)
+		assert.Equal(t, !tc.retryable, libErrs.IsPermanent(err), tc.path)
+		assert.Equal(t, tc.notFound, libErrs.IsNotFound(err), tc.path)
+	}
+	_, _, _, _, err = RequestStream(ctx, srv.URL+"/not-found", "GET", nil, nil, nil, errorStatuses, nil)
+	assert.Contains(t, err.Error(), "no such object")
+}
+
+func TestRequestStreamJSONArray(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/chunked":
+			for _, chunk := range []string{"[", `{"id":1}`, `,{"id"`, `:2},`, `{"id":3}`, "]"} {
+				_, _ = w.Write([]byte(chunk))
+				w.(http.Flusher).Flush()
+			}
+		case "/truncated":
+			// Response ends properly, but the array doesn't
+			_, _ = w.Write([]byte(`[{"id":1},{"id":`))
+		case "/dropped":
+			// Connection is closed before Content-Length bytes are sent
+			w.Header().Set("Content-Length", "100")
+			_, _ = w.Write([]byte(`[{"id":1},{"id":2}`))
+		case "/malformed":
+			_, _ = w.Write([]byte(`[{"id":1},}`))
+		case "/object":
+			_, _ = w.Write([]byte(`{"id":1}`))
+		case "/error":
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+	ctx := &Ctx{}
+	jsonStatuses := map[[2]int]struct{}{{200, 299}: {}}
+	errorStatuses := map[[2]int]struct{}{{400, 599}: {}}
+	ids := []float64{}
+	itemFunc := func(item interface{}) error {
+		ids = append(ids, item.(map[string]interface{})["id"].(float64))
+		return nil
+	}
+	nItems, status, _, _, err := RequestStreamJSONArray(ctx, srv.URL+"/chunked", "GET", nil, nil, nil, jsonStatuses, errorStatuses, nil, itemFunc)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 3, nItems)
+	assert.Equal(t, []float64{1, 2, 3}, ids)
+	var testCases = []struct {
+		path      string
+		json      map[[2]int]struct{}
+		nItems    int
+		retryable bool
+	}{
+		{path: "/truncated", json: jsonStatuses, nItems: 1, retryable: true},
+		{path: "/dropped", json: jsonStatuses, nItems: 2, retryable: true},
+		{path: "/malformed", json: jsonStatuses, nItems: 1},
+		{path: "/object", json: jsonStatuses},
+		{path: "/error", json: jsonStatuses, retryable: true},
+		{path: "/chunked", json: map[[2]int]struct{}{{201, 201}: {}}},
+	}
+	for _, tc := range testCases {
+		nItems, _, _, _, err := RequestStreamJSONArray(ctx, srv.URL+tc.path, "GET", nil, nil, nil, tc.json, errorStatuses, nil, func(interface{}) error { return nil })
+		assert.Error(t, err, tc.path)
+		assert.Equal(t, tc.nItems, nItems, tc.path)
+		assert.Equal(t, tc.retryable, libErrs.IsRetryable(err), tc.path)
+		assert.Equal(t, !tc.retryable, libErrs.IsPermanent(err), tc.path)
+	}
+	// itemFunc errors are returned with their classification
+	stop := libErrs.Errorf(libErrs.ErrAuth, "stop")
+	nItems, _, _, _, err = RequestStreamJSONArray(ctx, srv.URL+"/chunked", "GET", nil, nil, nil, jsonStatuses, errorStatuses, nil, func(interface{}) error { return stop })
+	assert.Equal(t, 0, nItems)
+	assert.True(t, errors.Is(err, stop))
+	assert.True(t, libErrs.IsAuth(err))
+}
+
+func TestStreamJSONArray(t *testing.T) {
+	nItems, err := StreamJSONArray(strings.NewReader(` [1, "a", {"b":null}] `), func(interface{}) error { return nil })
+	assert.NoError(t, err)
+	assert.Equal(t, 3, nItems)
+	_, err = StreamJSONArray(strings.NewReader(""), func(interface{}) error { return nil })
+	assert.Error(t, err)
+	_, err = StreamJSONArray(strings.NewReader(`"a"`), func(interface{}) error { return nil })
+	assert.Error(t, err)
+}
@@ -0,0 +1,182 @@
+package ds
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTokenHeader - default header used to pass API token
+	DefaultTokenHeader = "Authorization"
+)
+
+var (
+	tokenPoolsMtx = &sync.Mutex{}
+)
+
+// PoolToken - single API token with its last known rate limit quota
+type PoolToken struct {
+	Token     string
+	Known     bool      // quota was reported by the API
+	Remaining int       // remaining quota (only if Known)
+	Reset     time.Time // when quota resets (zero if unknown)
+}
+
+// TokenPool - set of API tokens used for a single API host, Request uses the token with the most remaining quota
+// Header is the request header used to pass the token (default Authorization), Prefix is prepended to token value, for example "token " or "Bearer "
+type TokenPool struct {
+	Host   string
+	Header string
+	Prefix string
+	tokens []*PoolToken
+	mtx    *sync.Mutex
+}
+
+// NewTokenPool - creates token pool for a given API host, all tokens are added to redacted strings
+func NewTokenPool(host, header, prefix string, tokens []string) *TokenPool {
+	if header == "" {
+		header = DefaultTokenHeader
+	}
+	pool := &TokenPool{Host: strings.ToLower(host), Header: header, Prefix: prefix, mtx: &sync.Mutex{}}
+	for _, token := range tokens {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+		AddRedacted(token, true)
+		pool.tokens = append(pool.tokens, &PoolToken{Token: token})
+	}
+	return pool
+}
+
+// AddTokenPool - attach token pool to context, Request will use it for all requests to pool.Host
+func AddTokenPool(ctx *Ctx, pool *TokenPool) {
+	tokenPoolsMtx.Lock()
+	defer tokenPoolsMtx.Unlock()
+	if ctx.TokenPools == nil {
+		ctx.TokenPools = make(map[string]*TokenPool)
+	}
+	ctx.TokenPools[pool.Host] = pool
+}
+
+// GetTokenPool - get token pool attached to context for a given host, returns nil if there is none
+func GetTokenPool(ctx *Ctx, host string) (pool *TokenPool) {
+	tokenPoolsMtx.Lock()
+	defer tokenPoolsMtx.Unlock()
+	if ctx.TokenPools == nil {
+		return
+	}
+	pool = ctx.TokenPools[host]
+	if pool != nil && len(pool.tokens) == 0 {
+		pool = nil
+	}
+	return
+}
+
+// Len - number of tokens in the pool
+func (p *TokenPool) Len() int {
+	return len(p.tokens)
+}
+
+// exhausted - is token known to have no quota left at a given time
+func (t *PoolToken) exhausted(now time.Time) bool {
+	if !t.Known || t.Remaining > 0 {
+		return false
+	}
+	if now.After(t.Reset) {
+		t.Known = false
+		return false
+	}
+	return true
+}
+
+// Acquire - pick token with the most remaining quota (tokens with unknown quota are preferred)
+// If all tokens are exhausted, returns the one that resets first and how long to wait for it
+func (p *TokenPool) Acquire() (idx int, header string, wait time.Duration) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	now := time.Now()
+	idx = -1
+	best := -1
+	for i, t := range p.tokens {
+		if t.exhausted(now) {
+			continue
+		}
+		score := int(^uint(0) >> 1)
+		if t.Known {
+			score = t.Remaining
+		}
+		if score > best {
+			best = score
+			idx = i
+		}
+	}
+	if idx < 0 {
+		idx = 0
+		for i, t := range p.tokens {
+			if t.Reset.Before(p.tokens[idx].Reset) {
+				idx = i
+			}
+		}
+		wait = p.tokens[idx].Reset.Sub(now)
+		if wait > MaxRateLimitWait {
+			wait = MaxRateLimitWait
+		}
+	}
+	t := p.tokens[idx]
+	if t.Known {
+		t.Remaining--
+	}
+	header = p.Prefix + t.Token
+	return
+}
+
+// Update - store rate limit information returned by API for token idx
+func (p *TokenPool) Update(ctx *Ctx, idx int, info RateLimitInfo) {
+	if idx < 0 || idx >= len(p.tokens) || (!info.Known && !info.Limited) {
+		return
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	t := p.tokens[idx]
+	t.Known = true
+	if info.Known {
+		t.Remaining = info.Remaining
+	} else {
+		t.Remaining = 0
+	}
+	if info.RetryAfter > 0 {
+		t.Reset = time.Now().Add(info.RetryAfter)
+	} else if !info.Reset.IsZero() {
+		t.Reset = info.Reset
+	} else if info.Limited {
+		t.Reset = time.Now().Add(DefaultRateLimitWait)
+	}
+	if ctx.Debug > 1 {
+		Printf("%s token #%d: remaining %d, reset %v, limited %v\n", p.Host, idx, t.Remaining, t.Reset, info.Limited)
+	}
+}
+
+// Wait - how long to wait until any token in the pool has quota available
+func (p *TokenPool) Wait() (wait time.Duration) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	now := time.Now()
+	for i, t := range p.tokens {
+		if !t.exhausted(now) {
+			return 0
+		}
+		w := t.Reset.Sub(now)
+		if i == 0 || w < wait {
+			wait = w
+		}
+	}
+	if wait < time.Second {
+		wait = time.Second
+	}
+	if wait > MaxRateLimitWait {
+		wait = MaxRateLimitWait
+	}
+	return
+}
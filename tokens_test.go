@@ -0,0 +1,74 @@
+package ds
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenPoolAcquire(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		tokens    []PoolToken
+		idx       int
+		remaining int
+		wait      bool
+	}{
+		{"Most remaining quota", []PoolToken{{Known: true, Remaining: 5}, {Known: true, Remaining: 50}, {Known: true, Remaining: 10}}, 1, 49, false},
+		{"Unknown quota preferred", []PoolToken{{Known: true, Remaining: 5000}, {}}, 1, 0, false},
+		{"Exhausted skipped", []PoolToken{{Known: true, Remaining: 0, Reset: now.Add(time.Hour)}, {Known: true, Remaining: 1}}, 1, 0, false},
+		{"Reset passed", []PoolToken{{Known: true, Remaining: 0, Reset: now.Add(-time.Second)}, {Known: true, Remaining: 1}}, 0, 0, false},
+		{"All exhausted, earliest reset", []PoolToken{{Known: true, Reset: now.Add(time.Hour)}, {Known: true, Reset: now.Add(time.Minute)}, {Known: true, Reset: now.Add(2 * time.Hour)}}, 1, -1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := []string{}
+			for i := range tt.tokens {
+				tokens = append(tokens, "token-"+tt.name+"-"+string(rune('a'+i)))
+			}
+			pool := NewTokenPool("api.example.com", "", "token ", tokens)
+			for i := range tt.tokens {
+				tt.tokens[i].Token = pool.tokens[i].Token
+				*pool.tokens[i] = tt.tokens[i]
+			}
+			idx, header, wait := pool.Acquire()
+			assert.Equal(t, tt.idx, idx)
+			assert.Equal(t, "token "+tokens[tt.idx], header)
+			assert.Equal(t, tt.remaining, pool.tokens[idx].Remaining)
+			assert.Equal(t, tt.wait, wait > 0)
+			if tt.wait {
+				assert.True(t, wait <= time.Minute)
+			}
+		})
+	}
+}
+
+func TestTokenPoolUpdateAndWait(t *testing.T) {
+	ctx := &Ctx{}
+	pool := NewTokenPool("API.example.com", "", "", []string{"token-update-a", "token-update-b"})
+	assert.Equal(t, "api.example.com", pool.Host)
+	assert.Equal(t, DefaultTokenHeader, pool.Header)
+	assert.Equal(t, time.Duration(0), pool.Wait())
+	// Unknown quota info is ignored
+	pool.Update(ctx, 0, RateLimitInfo{})
+	assert.False(t, pool.tokens[0].Known)
+	pool.Update(ctx, 0, RateLimitInfo{Known: true, Remaining: 3})
+	assert.True(t, pool.tokens[0].Known)
+	assert.Equal(t, 3, pool.tokens[0].Remaining)
+	// Both tokens limited, wait for the one that resets first
+	pool.Update(ctx, 0, RateLimitInfo{Limited: true, RetryAfter: time.Hour})
+	pool.Update(ctx, 1, RateLimitInfo{Known: true, Limited: true, Reset: time.Now().Add(10 * time.Minute)})
+	assert.Equal(t, 0, pool.tokens[0].Remaining)
+	wait := pool.Wait()
+	assert.True(t, wait > 9*time.Minute && wait <= 10*time.Minute, wait.String())
+	idx, _, _ := pool.Acquire()
+	assert.Equal(t, 1, idx)
+	// Waits are capped
+	pool.Update(ctx, 1, RateLimitInfo{Limited: true, RetryAfter: 100 * MaxRateLimitWait})
+	pool.Update(ctx, 0, RateLimitInfo{Limited: true, RetryAfter: 100 * MaxRateLimitWait})
+	assert.Equal(t, MaxRateLimitWait, pool.Wait())
+	// Out of range index is ignored
+	pool.Update(ctx, 5, RateLimitInfo{Known: true})
+}
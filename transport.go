@@ -0,0 +1,124 @@
+package ds
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	libHttp "github.com/LF-Engineering/insights-datasource-shared/http"
+)
+
+var (
+	// gNoSSLVerify - set by deprecated NoSSLVerify, turns off SSL validation for all contexts
+	gNoSSLVerify int32
+	// gDefaultTransport - used by contexts without their own transport
+	gDefaultTransport = &ctxTransport{}
+)
+
+// TransportConfig - returns HTTP transport config specified by context
+func TransportConfig(ctx *Ctx) libHttp.TransportConfig {
+	return libHttp.TransportConfig{
+		ConnectTimeout:      ctx.HTTPConnectTimeout,
+		Proxy:               ctx.HTTPProxy,
+		CABundle:            ctx.HTTPCABundle,
+		ClientCert:          ctx.HTTPClientCert,
+		ClientKey:           ctx.HTTPClientKey,
+		MaxIdleConnsPerHost: ctx.HTTPMaxIdleConnsPerHost,
+		MaxConnsPerHost:     ctx.HTTPMaxConnsPerHost,
+		InsecureSkipVerify:  ctx.HTTPNoSSLVerify,
+		InsecureHosts:       ctx.HTTPInsecureHosts,
+	}
+}
+
+// InitTransport - create HTTP transport from context settings, it is used by all library code paths for this context
+// and by http.ClientProviders created with HTTPClientProvider, when no setting is specified shared default transport is used
+func InitTransport(ctx *Ctx) (err error) {
+	cfg := TransportConfig(ctx)
+	if cfg.ConnectTimeout == 0 && cfg.Proxy == "" && cfg.CABundle == "" && cfg.ClientCert == "" && cfg.ClientKey == "" &&
+		cfg.MaxIdleConnsPerHost == 0 && cfg.MaxConnsPerHost == 0 && !cfg.InsecureSkipVerify && len(cfg.InsecureHosts) == 0 {
+		return
+	}
+	transport, err := libHttp.NewTransport(cfg)
+	if err != nil {
+		return
+	}
+	ctx.HTTPTransport = &ctxTransport{cfg: cfg, secure: transport}
+	return
+}
+
+// ctxTransport - context's transport, it switches to its insecure variant (keeping other settings) once NoSSLVerify is called
+// Zero value uses shared default transport
+type ctxTransport struct {
+	cfg      libHttp.TransportConfig
+	secure   http.RoundTripper
+	insecure http.RoundTripper
+	err      error
+	once     sync.Once
+}
+
+// RoundTrip - implements http.RoundTripper
+func (t *ctxTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.cfg.InsecureSkipVerify || atomic.LoadInt32(&gNoSSLVerify) == 0 {
+		if t.secure == nil {
+			return libHttp.DefaultTransport().RoundTrip(req)
+		}
+		return t.secure.RoundTrip(req)
+	}
+	t.once.Do(func() {
+		cfg := t.cfg
+		cfg.InsecureSkipVerify = true
+		t.insecure, t.err = libHttp.NewTransport(cfg)
+	})
+	if t.err != nil {
+		return nil, t.err
+	}
+	return t.insecure.RoundTrip(req)
+}
+
+// SetNoSSLVerify - turn off SSL validation for a given context, transport is recreated keeping its other settings
+func SetNoSSLVerify(ctx *Ctx) error {
+	ctx.HTTPNoSSLVerify = true
+	return InitTransport(ctx)
+}
+
+// InitBreaker - configure per host circuit breaker and max in-flight requests shared by Request and http.ClientProvider
+func InitBreaker(ctx *Ctx) {
+	libHttp.BreakerLogf = Printf
+	libHttp.SetBreakerConfig(libHttp.BreakerConfig{Threshold: ctx.BreakerThreshold, Timeout: ctx.BreakerTimeout, MaxInFlight: ctx.MaxInFlight})
+	if ctx.Debug > 0 {
+		Printf("circuit breaker threshold %d, timeout %v, max in-flight requests per host %d\n", ctx.BreakerThreshold, ctx.BreakerTimeout, ctx.MaxInFlight)
+	}
+}
+
+// transport - context's HTTP transport or shared default one
+func transport(ctx *Ctx) http.RoundTripper {
+	if ctx.HTTPTransport != nil {
+		return ctx.HTTPTransport
+	}
+	return gDefaultTransport
+}
+
+// roundTripper - context's record/replay cassette or its transport
+func roundTripper(ctx *Ctx) http.RoundTripper {
+	if ctx.HTTPCassette != nil {
+		return ctx.HTTPCassette
+	}
+	return transport(ctx)
+}
+
+// HTTPClient - returns HTTP client used by Request for a given context
+// It uses context's transport, record/replay cassette and per host circuit breaker and concurrency limiter
+func HTTPClient(ctx *Ctx) *http.Client {
+	return &http.Client{Transport: libHttp.NewBreakerTransport(roundTripper(ctx)), Timeout: ctx.HTTPTimeout}
+}
+
+// HTTPClientProvider - returns http.ClientProvider using context's transport, record/replay cassette and cancellation
+func HTTPClientProvider(ctx *Ctx, timeout time.Duration, allowRedirect bool) *libHttp.ClientProvider {
+	return libHttp.NewClientProvider(timeout, allowRedirect).WithTransport(roundTripper(ctx)).WithContext(GetContext(ctx))
+}
+
+// ESHTTPClient - returns HTTP client used for internal ES requests (cache, last update dates), they are never recorded or replayed
+func ESHTTPClient(ctx *Ctx) *http.Client {
+	return &http.Client{Transport: libHttp.NewBreakerTransport(transport(ctx)), Timeout: ctx.HTTPTimeout}
+}
@@ -0,0 +1,61 @@
+package ds
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	libHttp "github.com/LF-Engineering/insights-datasource-shared/http"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetNoSSLVerify(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	get := func(ctx *Ctx) error {
+		resp, err := HTTPClient(ctx).Get(srv.URL)
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+		return err
+	}
+	ctx := &Ctx{HTTPMaxConnsPerHost: 4}
+	assert.NoError(t, InitTransport(ctx))
+	assert.Error(t, get(ctx))
+	// Transport already set for the context is recreated with all its settings
+	assert.NoError(t, SetNoSSLVerify(ctx))
+	assert.NoError(t, get(ctx))
+	assert.Equal(t, 4, TransportConfig(ctx).MaxConnsPerHost)
+	assert.True(t, TransportConfig(ctx).InsecureSkipVerify)
+	// Context's transport is not shared with other contexts and providers
+	assert.Equal(t, libHttp.DefaultTransport(), http.DefaultTransport)
+	assert.Error(t, get(&Ctx{}))
+}
+
+func TestNoSSLVerify(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	get := func(ctx *Ctx) error {
+		status, _, err := HTTPClientProvider(ctx, 0, false).Request(srv.URL, "GET", nil, nil, nil)
+		if err == nil {
+			assert.Equal(t, http.StatusOK, status)
+		}
+		return err
+	}
+	initialized := &Ctx{HTTPMaxConnsPerHost: 4}
+	assert.NoError(t, InitTransport(initialized))
+	uninitialized := &Ctx{}
+	assert.Error(t, get(initialized))
+	assert.Error(t, get(uninitialized))
+	// Deprecated global switch also applies to contexts initialized before it was called
+	defer atomic.StoreInt32(&gNoSSLVerify, 0)
+	NoSSLVerify()
+	assert.NoError(t, get(initialized))
+	assert.NoError(t, get(uninitialized))
+	assert.False(t, TransportConfig(initialized).InsecureSkipVerify)
+}
@@ -1,17 +1,16 @@
 package ds
 
 import (
-	"crypto/tls"
 	"flag"
 	"fmt"
 	"math/rand"
-	"net/http"
 	"net/url"
 	"os"
 	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/LF-Engineering/lfx-event-schema/service/insights"
@@ -117,16 +116,28 @@ func StringToBool(v string) bool {
 	return true
 }
 
-// NoSSLVerify - turn off SSL validation
+// NoSSLVerify - turn off SSL validation for all contexts, also those already initialized
+//
+// Deprecated: use --dsname-no-ssl-verify, --dsname-insecure-hosts or SetNoSSLVerify per context instead,
+// this keeps other transport settings of contexts, but doesn't affect http.ClientProviders not created by HTTPClientProvider
 func NoSSLVerify() {
-	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	atomic.StoreInt32(&gNoSSLVerify, 1)
 }
 
-// FlagPassed - was that flag actually passed (returns true) or the default value was used? (returns false)
+// FlagPassed - was that flag actually passed on the command line (returns true) or the default value was used? (returns false)
+// Values set from config file are not reported as passed, use FlagConfigured to include them
 func FlagPassed(ctx *Ctx, name string) bool {
+	if _, ok := ctx.fileFlags[ctx.DSFlag+name]; ok {
+		return false
+	}
+	return FlagConfigured(ctx, name)
+}
+
+// FlagConfigured - was that flag passed on the command line or set from config file (returns true) or the default value was used? (returns false)
+func FlagConfigured(ctx *Ctx, name string) bool {
 	name = ctx.DSFlag + name
 	found := false
-	flag.Visit(func(f *flag.Flag) {
+	ctx.FlagSet().Visit(func(f *flag.Flag) {
 		if f.Name == name {
 			found = true
 		}